@@ -0,0 +1,139 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// addCommand implements the 'add' subcommand.
+type addCommand struct {
+	Task  string `long:"task" description:"Task whose RPC server receives the torrent" required:"yes"`
+	Force bool   `long:"force" description:"Add even if the infohash has been added before"`
+	Args  struct {
+		URLs []string `positional-arg-name:"url" required:"1"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	parser.AddCommand("add",
+		"Add torrents manually",
+		"Add magnet links or .torrent URLs to the RPC server of a task and record their infohashes in the cache, "+
+			"so feeds don't add them again.",
+		&addCommand{})
+}
+
+// Execute adds the URLs to the RPC server of the task.
+func (c *addCommand) Execute(args []string) error {
+	tasks, err := LoadConfig(opt.Config)
+	if err != nil {
+		return err
+	}
+	var t *Task
+	for _, task := range *tasks {
+		if task.Name == c.Task {
+			t = task
+		}
+	}
+	if t == nil {
+		return errors.New("no such task: " + c.Task)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	t.ctx = ctx
+	defer torrentInfoHashes.Flush()
+
+	// While the daemon runs it owns the cache, so records are handed over through the pending store.
+	lock, err := AcquireLock(false)
+	daemonRunning := errors.Is(err, errLockHeld)
+	if err != nil && !daemonRunning {
+		return err
+	}
+	if !daemonRunning {
+		defer lock.Release()
+	}
+	cache, err := NewCache()
+	if err != nil {
+		return err
+	}
+	pending, err := NewPendingStore()
+	if err != nil {
+		return err
+	}
+
+	client, err := t.createRpcClient()
+	if err != nil {
+		return err
+	}
+	defer client.CloseRpc()
+
+	knownInfoHashes := t.knownInfoHashes(cache)
+	added := make(map[string][]string)
+	var history []*HistoryEntry
+	for _, uri := range c.Args.URLs {
+		infoHashes, err := parseMagnetURI(uri)
+		if err != nil {
+			infoHashes, _ = parseTorrentURIWithTimeout(ctx, nil, uri, t.parserConfig.Archive)
+		}
+		if !c.Force && allKnown(infoHashes, knownInfoHashes) {
+			fmt.Printf("skipped %s: already added\n", uri)
+			continue
+		}
+		if err := client.AddTorrent(uri); err != nil {
+			return fmt.Errorf("failed to add %s: %w", uri, err)
+		}
+		fmt.Printf("added %s\n", uri)
+		added[uri] = infoHashes
+		history = append(history, t.newHistoryEntry(uri, uri, infoHashes, "", "added manually"))
+	}
+	t.recordHistory(history)
+	if len(added) == 0 {
+		return nil
+	}
+
+	if !daemonRunning {
+		var infoHashes []string
+		for _, hashes := range added {
+			infoHashes = append(infoHashes, hashes...)
+		}
+		t.recordInfoHashes(infoHashes)
+		cache.Set(manualCacheKey, added, true)
+		return cache.Flush()
+	}
+	return pending.Update(func(items map[string][]*PendingItem) error {
+		for uri, infoHashes := range added {
+			items[t.Name] = append(items[t.Name], &PendingItem{
+				ID:         pendingItemID(t.Name, uri),
+				Feed:       manualCacheKey,
+				GUID:       uri,
+				Title:      uri,
+				URL:        uri,
+				InfoHashes: infoHashes,
+				Parked:     time.Now(),
+				Status:     addedStatus,
+			})
+		}
+		return nil
+	})
+}
+
+// allKnown reports whether infoHashes is not empty and all of its hashes are in known.
+func allKnown(infoHashes []string, known map[string]struct{}) bool {
+	if len(infoHashes) == 0 {
+		return false
+	}
+	for _, infoHash := range infoHashes {
+		if _, exists := known[infoHash]; !exists {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// parseAge parses an age of the filter section: minutes as an integer, or a number with the unit m, h or d.
+func parseAge(key string, v interface{}) (time.Duration, error) {
+	invalid := errors.New("invalid '" + key + "' in filter: must be minutes or a duration such as 12h or 7d")
+	if minutes, ok := v.(int); ok {
+		if minutes < 0 {
+			return 0, invalid
+		}
+		return time.Duration(minutes) * time.Minute, nil
+	}
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return 0, invalid
+	}
+	units := map[byte]time.Duration{'m': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour}
+	unit, exists := units[s[len(s)-1]]
+	if !exists {
+		return 0, invalid
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(s[:len(s)-1]))
+	if err != nil || n < 0 {
+		return 0, invalid
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// itemAge returns how long ago the item was published or, failing that, updated. It returns false if
+// the item has no date.
+func itemAge(item *gofeed.Item, now time.Time) (time.Duration, bool) {
+	date := item.PublishedParsed
+	if date == nil {
+		date = item.UpdatedParsed
+	}
+	if date == nil {
+		return 0, false
+	}
+	return now.Sub(*date), true
+}
+
+// FilterAge checks the age of the item against maxAge and minAge. Items without a date pass.
+// An item too old is skipped for good; an item too new is held, to be checked again on a later fetch.
+// It also returns the reason of the decision.
+func (f *Feed) FilterAge(item *gofeed.Item, now time.Time) (skip bool, hold bool, reason string) {
+	if f.MaxAge == 0 && f.MinAge == 0 {
+		return false, false, ""
+	}
+	age, ok := itemAge(item, now)
+	if !ok {
+		return false, false, ""
+	}
+	if f.MaxAge > 0 && age > f.MaxAge {
+		return true, false, "older than maxAge (" + age.Round(time.Minute).String() + ")"
+	}
+	if f.MinAge > 0 && age < f.MinAge {
+		return false, true, "newer than minAge (" + age.Round(time.Minute).String() + ")"
+	}
+	return false, false, ""
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+// pendingCommand implements the 'pending' subcommand listing items awaiting approval.
+type pendingCommand struct {
+	Task string `long:"task" description:"Only list items of this task"`
+}
+
+// decideCommand implements the 'approve' and 'reject' subcommands.
+type decideCommand struct {
+	status string
+	All    bool   `long:"all" description:"Decide all pending items, of --task or --tag only if given"`
+	Task   string `long:"task" description:"Restrict --all to this task"`
+	Tag    string `long:"tag" description:"Restrict --all to the tasks with this tag"`
+	Args   struct {
+		IDs []string `positional-arg-name:"id"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	parser.AddCommand("pending",
+		"List items awaiting approval",
+		"List the matched items of tasks with 'approval: manual' that wait for a decision.",
+		&pendingCommand{})
+	parser.AddCommand("approve",
+		"Approve pending items",
+		"Approve pending items by ID, or all with --all. They are added by the daemon on the next fetch of their task.",
+		&decideCommand{status: approvedStatus})
+	parser.AddCommand("reject",
+		"Reject pending items",
+		"Reject pending items by ID, or all with --all. They are dropped by the daemon on the next fetch of their task.",
+		&decideCommand{status: rejectedStatus})
+}
+
+// Execute prints the pending items as a table.
+func (c *pendingCommand) Execute(args []string) error {
+	store, err := NewPendingStore()
+	if err != nil {
+		return err
+	}
+	pending, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	tasks := make([]string, 0, len(pending))
+	for task := range pending {
+		if c.Task == "" || c.Task == task {
+			tasks = append(tasks, task)
+		}
+	}
+	sort.Strings(tasks)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTASK\tSTATUS\tPARKED\tTITLE")
+	for _, task := range tasks {
+		for _, item := range pending[task] {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", item.ID, task, item.Status, item.Parked.Format("2006-01-02 15:04"), item.Title)
+		}
+	}
+	return w.Flush()
+}
+
+// Execute sets the status of the given pending items.
+func (c *decideCommand) Execute(args []string) error {
+	if c.All == (len(c.Args.IDs) > 0) {
+		return errors.New("specify either item IDs or --all")
+	}
+	var tagged map[string]bool
+	if c.Tag != "" {
+		var err error
+		if tagged, err = taggedTasks(c.Tag); err != nil {
+			return err
+		}
+	}
+	store, err := NewPendingStore()
+	if err != nil {
+		return err
+	}
+
+	return store.Update(func(pending map[string][]*PendingItem) error {
+		if c.All {
+			for task, items := range pending {
+				if (c.Task != "" && c.Task != task) || (tagged != nil && !tagged[task]) {
+					continue
+				}
+				for _, item := range items {
+					if item.Status == pendingStatus {
+						item.Status = c.status
+						fmt.Printf("%s %s: %s\n", c.status, task, item.Title)
+					}
+				}
+			}
+			return nil
+		}
+
+		remaining := make(map[string]struct{}, len(c.Args.IDs))
+		for _, id := range c.Args.IDs {
+			remaining[id] = struct{}{}
+		}
+		for task, items := range pending {
+			for _, item := range items {
+				if _, wanted := remaining[item.ID]; wanted {
+					item.Status = c.status
+					delete(remaining, item.ID)
+					fmt.Printf("%s %s: %s\n", c.status, task, item.Title)
+				}
+			}
+		}
+		if len(remaining) > 0 {
+			ids := make([]string, 0, len(remaining))
+			for id := range remaining {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			return fmt.Errorf("unknown pending item IDs: %v", ids)
+		}
+		return nil
+	})
+}
+
+// taggedTasks returns the names of the configured tasks with the tag.
+func taggedTasks(tag string) (map[string]bool, error) {
+	tasks, err := LoadConfig(opt.Config)
+	if err != nil {
+		return nil, err
+	}
+	tagged := make(map[string]bool)
+	for _, task := range *tasks {
+		if task.HasTag(tag) {
+			tagged[task.Name] = true
+		}
+	}
+	return tagged, nil
+}
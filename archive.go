@@ -0,0 +1,196 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// archivePath returns the path of the torrent with the infoHash in the archive directory.
+func archivePath(dir, infoHash string) string {
+	return filepath.Join(dir, infoHash+".torrent")
+}
+
+// archived reports whether a torrent with one of the infoHashes is in the archive directory.
+func archived(dir string, infoHashes []string) bool {
+	for _, infoHash := range infoHashes {
+		if _, err := os.Stat(archivePath(dir, infoHash)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// archivedName returns the name of the archived torrent with the infoHash, or "" if it isn't archived.
+func archivedName(dir, infoHash string) string {
+	mi, err := metainfo.LoadFromFile(archivePath(dir, infoHash))
+	if err != nil {
+		return ""
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return ""
+	}
+	return info.BestName()
+}
+
+// archiveTorrent stores the torrent in the archive directory as <infohash>.torrent, unless it is there already.
+func archiveTorrent(dir string, mi *metainfo.MetaInfo) error {
+	path := archivePath(dir, mi.HashInfoBytes().HexString())
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	err = mi.Write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// archiveCommand groups the torrent archive subcommands, it has no action of its own.
+type archiveCommand struct{}
+
+// archiveOptions selects the archive directory, either directly or through a task.
+type archiveOptions struct {
+	Task string `long:"task" description:"Use the archive directory of this task"`
+	Dir  string `long:"dir" description:"Archive directory"`
+}
+
+// archiveListCommand implements the 'archive list' subcommand.
+type archiveListCommand struct {
+	archiveOptions
+}
+
+// archiveGetCommand implements the 'archive get' subcommand.
+type archiveGetCommand struct {
+	archiveOptions
+	Output string `short:"o" long:"output" description:"File to write the torrent to, '-' for stdout" default:"-"`
+	Args   struct {
+		InfoHash string `positional-arg-name:"infohash" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	cmd, _ := parser.AddCommand("archive",
+		"Access archived .torrent files",
+		"Access the .torrent files stored by tasks with an 'archive' directory, keyed by infohash.",
+		&archiveCommand{})
+	cmd.AddCommand("list",
+		"List archived torrents",
+		"Print the infohash and name of every archived torrent.",
+		&archiveListCommand{})
+	cmd.AddCommand("get",
+		"Retrieve an archived torrent",
+		"Write the archived .torrent file of an infohash, e.g. to add it again to a rebuilt downloader.",
+		&archiveGetCommand{})
+}
+
+// dir returns the archive directory selected by the options.
+func (o *archiveOptions) dir() (string, error) {
+	if o.Dir != "" {
+		return o.Dir, nil
+	}
+	if o.Task == "" {
+		return "", errors.New("either --task or --dir is required")
+	}
+	tasks, err := LoadConfig(opt.Config)
+	if err != nil {
+		return "", err
+	}
+	for _, task := range *tasks {
+		if task.Name != o.Task {
+			continue
+		}
+		if task.parserConfig.Archive == "" {
+			return "", errors.New("task has no archive directory: " + o.Task)
+		}
+		return task.parserConfig.Archive, nil
+	}
+	return "", errors.New("no such task: " + o.Task)
+}
+
+// Execute lists the archived torrents.
+func (c *archiveListCommand) Execute(args []string) error {
+	dir, err := c.dir()
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".torrent") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INFOHASH\tNAME")
+	for _, name := range names {
+		title := archivedName(dir, strings.TrimSuffix(name, ".torrent"))
+		if title == "" {
+			title = "?"
+		}
+		fmt.Fprintf(w, "%s\t%s\n", strings.TrimSuffix(name, ".torrent"), title)
+	}
+	return w.Flush()
+}
+
+// Execute writes the archived torrent of the infohash.
+func (c *archiveGetCommand) Execute(args []string) error {
+	dir, err := c.dir()
+	if err != nil {
+		return err
+	}
+	infoHash, err := regulateInfoHash(c.Args.InfoHash)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(filepath.Join(dir, infoHash+".torrent"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if c.Output == "-" {
+		_, err = io.Copy(os.Stdout, file)
+		return err
+	}
+	out, err := os.Create(c.Output)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, file); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -8,6 +8,9 @@ package main
 
 import (
 	"context"
+	"errors"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/zyxar/argo/rpc"
@@ -16,26 +19,150 @@ import (
 // Aria2c handle the aria2c api request
 type Aria2c struct {
 	rpc.Client
-	ctx context.Context
+	ctx     context.Context
+	options map[string]string
 }
 
 // NewAria2c return a new Aria2c object
-func NewAria2c(ctx context.Context, url string, token string) (*Aria2c, error) {
-	c, err := rpc.New(ctx, url, token, 30*time.Second, nil)
+func NewAria2c(ctx context.Context, url string, token string, options AddOptions) (*Aria2c, error) {
+	// Calls don't take a context, they time out on their own no later than ctx
+	timeout := 30 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline))
+	}
+	c, err := rpc.New(ctx, url, token, timeout, nil)
 
 	if err != nil {
 		return nil, err
 	}
-	return &Aria2c{c, ctx}, nil
+	return &Aria2c{c, ctx, aria2cOptions(options)}, nil
+}
+
+// aria2cOptions converts the add options to aria2 input options. Labels have no aria2 equivalent.
+func aria2cOptions(options AddOptions) map[string]string {
+	m := make(map[string]string)
+	if options.Dir != "" {
+		m["dir"] = options.Dir
+	}
+	if options.SeedRatio > 0 {
+		m["seed-ratio"] = strconv.FormatFloat(options.SeedRatio, 'f', -1, 64)
+	}
+	if options.SeedTime > 0 {
+		m["seed-time"] = strconv.Itoa(options.SeedTime)
+	}
+	if options.DownloadLimit > 0 {
+		m["max-download-limit"] = strconv.Itoa(options.DownloadLimit) + "K"
+	}
+	if options.UploadLimit > 0 {
+		m["max-upload-limit"] = strconv.Itoa(options.UploadLimit) + "K"
+	}
+	return m
 }
 
 // Add add a new link to the aria2c server
 func (a *Aria2c) AddTorrent(uri string) error {
 	// AddURI expects a slice of URIs, so wrap the single URI in a slice.
-	_, err := a.AddURI([]string{uri})
+	_, err := a.AddURI([]string{uri}, a.options)
 	return err
 }
 
+// AddTorrentPaused adds a new link to the aria2c server in paused state and returns its gid
+func (a *Aria2c) AddTorrentPaused(uri string) (string, error) {
+	options := map[string]string{"pause": "true"}
+	for k, v := range a.options {
+		options[k] = v
+	}
+	return a.AddURI([]string{uri}, options)
+}
+
+// Resume unpauses the downloads with the given gids
+func (a *Aria2c) Resume(gids []string) error {
+	var errs []error
+	for _, gid := range gids {
+		if _, err := a.Unpause(gid); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Completed returns the infoHashes among the given ones of the downloads that finished, seeding or stopped.
+// The metadata downloads of magnet links, followed by the download of the torrent, are not counted.
+func (a *Aria2c) Completed(infoHashes []string) ([]string, error) {
+	keys := []string{"status", "infoHash", "seeder", "followedBy"}
+	active, err := a.TellActive(keys...)
+	if err != nil {
+		return nil, err
+	}
+	stopped, err := a.TellStopped(0, 1000, keys...)
+	if err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]bool, len(infoHashes))
+	for _, infoHash := range infoHashes {
+		wanted[infoHash] = true
+	}
+	var finished []string
+	for _, info := range append(active, stopped...) {
+		infoHash := strings.ToLower(info.InfoHash)
+		if !wanted[infoHash] {
+			continue
+		}
+		if (info.Status == "active" && info.Seeder == "true") || (info.Status == "complete" && len(info.FollowedBy) == 0) {
+			finished = append(finished, infoHash)
+			wanted[infoHash] = false
+		}
+	}
+	return finished, nil
+}
+
+// Remove removes the downloads of the given infoHashes, waiting or not, and their results once stopped.
+// Downloaded files are kept.
+func (a *Aria2c) Remove(infoHashes []string) error {
+	if len(infoHashes) == 0 {
+		return nil
+	}
+	keys := []string{"gid", "infoHash"}
+	active, err := a.TellActive(keys...)
+	if err != nil {
+		return err
+	}
+	waiting, err := a.TellWaiting(0, 1000, keys...)
+	if err != nil {
+		return err
+	}
+	stopped, err := a.TellStopped(0, 1000, keys...)
+	if err != nil {
+		return err
+	}
+	wanted := make(map[string]bool, len(infoHashes))
+	for _, infoHash := range infoHashes {
+		wanted[infoHash] = true
+	}
+	var errs []error
+	for _, info := range append(active, waiting...) {
+		if wanted[strings.ToLower(info.InfoHash)] {
+			if _, err := a.ForceRemove(info.Gid); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	for _, info := range stopped {
+		if wanted[strings.ToLower(info.InfoHash)] {
+			if _, err := a.RemoveDownloadResult(info.Gid); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Version returns the version of the aria2c server, failing if it is unreachable
+func (a *Aria2c) Version() (string, error) {
+	info, err := a.GetVersion()
+	return info.Version, err
+}
+
 // CleanUp purges completed/error/removed downloads
 func (a *Aria2c) CleanUp() {
 	a.PurgeDownloadResult()
@@ -0,0 +1,175 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSonarrUrl = "http://localhost:8989"
+	defaultRadarrUrl = "http://localhost:7878"
+)
+
+// arrTimeout bounds each request to Sonarr or Radarr, which check the release before answering a push.
+const arrTimeout = 60 * time.Second
+
+// releasePusher is implemented by downloaders that take releases by title rather than bare torrent
+// URLs, such as Sonarr and Radarr.
+type releasePusher interface {
+	PushRelease(title, uri string) error
+}
+
+// Arr hands torrents over to Sonarr or Radarr as pushed releases, which pick the torrent client,
+// rename the files and import them into the library.
+type Arr struct {
+	ctx    context.Context
+	kind   string // "sonarr" or "radarr"
+	url    string
+	apiKey string
+}
+
+// NewArr returns an Arr pushing releases to the Sonarr or Radarr instance at url.
+func NewArr(ctx context.Context, kind, url, apiKey string) (*Arr, error) {
+	return &Arr{ctx: ctx, kind: kind, url: strings.TrimSuffix(url, "/"), apiKey: apiKey}, nil
+}
+
+// arrRelease is a release pushed to Sonarr or Radarr.
+type arrRelease struct {
+	Title       string `json:"title"`
+	DownloadUrl string `json:"downloadUrl,omitempty"`
+	MagnetUrl   string `json:"magnetUrl,omitempty"`
+	InfoHash    string `json:"infoHash,omitempty"`
+	Protocol    string `json:"protocol"`
+	PublishDate string `json:"publishDate"`
+	Indexer     string `json:"indexer"`
+}
+
+// arrDecision is the answer to a pushed release.
+type arrDecision struct {
+	Approved   bool     `json:"approved"`
+	Rejected   bool     `json:"rejected"`
+	Rejections []string `json:"rejections"`
+}
+
+// PushRelease pushes the torrent as a release with the title, which Sonarr and Radarr parse to find the
+// series or movie. A release they reject, e.g. one not wanted, is an error.
+func (a *Arr) PushRelease(title, uri string) error {
+	release := arrRelease{Title: title, Protocol: "torrent", PublishDate: time.Now().UTC().Format(time.RFC3339), Indexer: "at-rss"}
+	if strings.HasPrefix(uri, "magnet:") {
+		release.MagnetUrl = uri
+		if infoHashes, err := parseMagnetURI(uri); err == nil && len(infoHashes) > 0 {
+			release.InfoHash = infoHashes[0]
+		}
+	} else {
+		release.DownloadUrl = uri
+	}
+	var decisions []arrDecision
+	if err := a.call(http.MethodPost, "/api/v3/release/push", release, &decisions); err != nil {
+		return err
+	}
+	for _, decision := range decisions {
+		if decision.Rejected {
+			return fmt.Errorf("%s rejected the release: %s", a.kind, strings.Join(decision.Rejections, "; "))
+		}
+	}
+	return nil
+}
+
+// AddTorrent pushes the URL as a release titled after the display name of the magnet link.
+func (a *Arr) AddTorrent(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "magnet" || u.Query().Get("dn") == "" {
+		return fmt.Errorf("%s needs the title of the release, only magnet links with a display name can be added", a.kind)
+	}
+	return a.PushRelease(u.Query().Get("dn"), uri)
+}
+
+// AddTorrentPaused pushes the URL as AddTorrent does, the torrent client chosen by Sonarr or Radarr
+// is out of reach to pause it
+func (a *Arr) AddTorrentPaused(uri string) (string, error) {
+	return "", a.AddTorrent(uri)
+}
+
+// Resume does nothing but satisfy RpcClient interface
+func (a *Arr) Resume(ids []string) error {
+	return nil
+}
+
+// Completed reports no torrent, Sonarr and Radarr track the downloads they import
+func (a *Arr) Completed(infoHashes []string) ([]string, error) {
+	return nil, nil
+}
+
+// Remove does nothing, Sonarr and Radarr manage the downloads of the releases pushed to them
+func (a *Arr) Remove(infoHashes []string) error {
+	return nil
+}
+
+// Version returns the version of the Sonarr or Radarr instance, failing if it is unreachable
+func (a *Arr) Version() (string, error) {
+	var status struct {
+		Version string `json:"version"`
+	}
+	err := a.call(http.MethodGet, "/api/v3/system/status", nil, &status)
+	return status.Version, err
+}
+
+// CleanUp does nothing but satisfy RpcClient interface
+func (a *Arr) CleanUp() {}
+
+// CloseRpc does nothing but satisfy RpcClient interface
+func (a *Arr) CloseRpc() {}
+
+// call sends a request with a JSON body, if any, to the API and decodes the JSON response into result.
+func (a *Arr) call(method, path string, body, result interface{}) error {
+	ctx, cancel := context.WithTimeout(a.ctx, arrTimeout)
+	defer cancel()
+	var content io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.url+path, content)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Api-Key", a.apiKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return errors.New(a.kind + ": invalid API key")
+	}
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s: %s", a.kind, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// isArr reports whether the RPC type hands torrents over to Sonarr or Radarr.
+func isArr(rpcType string) bool {
+	return rpcType == "sonarr" || rpcType == "radarr"
+}
@@ -0,0 +1,215 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Directories of a backup archive: config files by absolute path, and state files by name.
+const (
+	backupConfigDir = "config/"
+	backupStateDir  = "state/"
+)
+
+// stateFileNames are the files holding the state of at-rss, relative to the home directory.
+var stateFileNames = []string{cacheFileName, cacheFileName + cacheBackupSuffix, pendingFileName, qualityFileName, episodeFileName, titleFileName, infoHashIndexFileName, historyFileName, pausedFileName, downloadsFileName, torrentCacheFileName}
+
+// backupCommand groups the backup subcommands, it has no action of its own.
+type backupCommand struct{}
+
+// backupCreateCommand implements the 'backup create' subcommand.
+type backupCreateCommand struct {
+	Output string `short:"o" long:"output" description:"Archive to write, a .tar.gz file" required:"yes"`
+}
+
+// backupRestoreCommand implements the 'backup restore' subcommand.
+type backupRestoreCommand struct {
+	StateOnly bool `long:"state-only" description:"Only restore the cache and pending items, not the config files"`
+	DryRun    bool `long:"dry-run" description:"Only print the files that would be restored"`
+	Args      struct {
+		Archive string `positional-arg-name:"archive" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	cmd, _ := parser.AddCommand("backup",
+		"Back up or restore the config and state",
+		"Move an instance to a new server: the archive holds the config files given by --conf with their includes "+
+			"and watchlists, the cache of processed items and the pending items.",
+		&backupCommand{})
+	cmd.AddCommand("create",
+		"Create a backup archive",
+		"Write the config files, the cache and the pending items to a .tar.gz archive. "+
+			"Secret files referenced by the config and archived .torrent files are not included.",
+		&backupCreateCommand{})
+	cmd.AddCommand("restore",
+		"Restore a backup archive",
+		"Write the files of a backup archive back in place: config files to their original paths, "+
+			"state files to the cache directory of the current user. The daemon must not be running.",
+		&backupRestoreCommand{})
+}
+
+// Execute writes the backup archive.
+func (c *backupCreateCommand) Execute(args []string) error {
+	src, err := loadConfigFiles(opt.Config)
+	if err != nil {
+		return err
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(c.Output)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	err = func() error {
+		for _, name := range src.Files {
+			abs, err := filepath.Abs(name)
+			if err != nil {
+				return err
+			}
+			if err := addBackupFile(tw, backupConfigDir+strings.TrimPrefix(filepath.ToSlash(abs), "/"), abs); err != nil {
+				return err
+			}
+		}
+		for _, name := range stateFileNames {
+			err := addBackupFile(tw, backupStateDir+path.Base(name), filepath.Join(homeDir, name))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		if err := tw.Close(); err != nil {
+			return err
+		}
+		return gz.Close()
+	}()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(c.Output)
+	}
+	return err
+}
+
+// addBackupFile adds the file at path to the archive under name.
+func addBackupFile(tw *tar.Writer, name, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{Name: name, Mode: int64(info.Mode().Perm()), Size: int64(len(content)), ModTime: info.ModTime()}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := tw.Write(content); err != nil {
+		return err
+	}
+	fmt.Println("added " + name)
+	return nil
+}
+
+// Execute restores the files of the backup archive.
+func (c *backupRestoreCommand) Execute(args []string) error {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	if !c.DryRun {
+		// The daemon would overwrite the restored state with its own
+		lock, err := AcquireLock(false)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+	}
+
+	file, err := os.Open(c.Args.Archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target, err := backupTarget(header.Name, homeDir)
+		if err != nil {
+			return err
+		}
+		if target == "" || (c.StateOnly && strings.HasPrefix(header.Name, backupConfigDir)) {
+			continue
+		}
+		if c.DryRun {
+			fmt.Println("would restore " + target)
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		tmpPath := target + ".tmp"
+		if err := os.WriteFile(tmpPath, content, os.FileMode(header.Mode).Perm()); err != nil {
+			return err
+		}
+		os.Chtimes(tmpPath, time.Now(), header.ModTime)
+		if err := os.Rename(tmpPath, target); err != nil {
+			return err
+		}
+		fmt.Println("restored " + target)
+	}
+}
+
+// backupTarget returns where the archive entry is restored, or "" if the entry is unknown.
+func backupTarget(name, homeDir string) (string, error) {
+	switch {
+	case strings.HasPrefix(name, backupConfigDir):
+		target := "/" + strings.TrimPrefix(name, backupConfigDir)
+		if path.Clean(target) != target {
+			return "", errors.New("invalid path in backup archive: " + name)
+		}
+		return filepath.FromSlash(target), nil
+	case strings.HasPrefix(name, backupStateDir):
+		base := strings.TrimPrefix(name, backupStateDir)
+		for _, stateName := range stateFileNames {
+			if path.Base(stateName) == base {
+				return filepath.Join(homeDir, stateName), nil
+			}
+		}
+	}
+	return "", nil
+}
@@ -7,6 +7,7 @@
 package main
 
 import (
+	"errors"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -17,6 +18,15 @@ import (
 
 const cacheFileName = ".cache/at-rss.yml"
 
+// cacheBackupSuffix names the last known good copy of the cache file, used when the cache file is corrupted.
+const cacheBackupSuffix = ".bak"
+
+// cacheCorruptSuffix names a corrupted cache file set aside, so that 'cache repair' can salvage its entries.
+const cacheCorruptSuffix = ".corrupt"
+
+// manualCacheKey is the cache key of torrents added with the 'add' subcommand, keyed by their URL.
+const manualCacheKey = "manual"
+
 // Cache manages the storage and retrieval of RSS feed items.
 // The `data` map contains feed URLs as keys, each associated with a map of GUIDs (Globally Unique Identifiers) and their torrent infoHashes if added to rpc client.
 // The `filePath` stores the location for saving or loading the cache data.
@@ -24,10 +34,20 @@ type Cache struct {
 	mu       sync.RWMutex
 	data     map[string]map[string][]string // inner map value is a slice of added torrent infoHashes
 	filePath string
+	fileGood bool        // whether the file at filePath is known to be valid and may become the backup
+	remote   *redisCache // shared store used instead of data and the file, nil to use the file
 }
 
-// NewCache initializes and returns a Cache instance.
+// NewCache initializes and returns a Cache instance, kept in Redis if --redis is given.
 func NewCache() (*Cache, error) {
+	if opt.Redis != "" {
+		remote, err := newRedisCache(opt.Redis)
+		if err != nil {
+			slog.Error("Failed to open Redis cache.", "err", err)
+			return nil, err
+		}
+		return &Cache{remote: remote}, nil
+	}
 	cache := &Cache{
 		data: make(map[string]map[string][]string),
 	}
@@ -39,8 +59,27 @@ func NewCache() (*Cache, error) {
 	}
 	cache.filePath = filepath.Join(homeDir, cacheFileName)
 
-	if err := loadCache(cache.filePath, &cache.data); err != nil {
+	err = loadCache(cache.filePath, &cache.data)
+	switch {
+	case err == nil:
+		cache.fileGood = true
+	case errors.Is(err, os.ErrNotExist):
 		slog.Warn("Failed to load cache, initializing empty cache.", "err", err)
+	default:
+		// Set the broken file aside, the next flush would replace it while it may still be repaired
+		if renameErr := os.Rename(cache.filePath, cache.filePath+cacheCorruptSuffix); renameErr != nil {
+			slog.Warn("Failed to set corrupted cache file aside.", "err", renameErr)
+		}
+		cache.data = make(map[string]map[string][]string)
+		if backupErr := loadCache(cache.filePath+cacheBackupSuffix, &cache.data); backupErr == nil {
+			slog.Warn("Failed to load cache, using last known good copy. Run 'at-rss cache repair' to salvage newer entries.", "err", err, "corrupt", cache.filePath+cacheCorruptSuffix)
+		} else {
+			cache.data = make(map[string]map[string][]string)
+			slog.Warn("Failed to load cache, initializing empty cache. Run 'at-rss cache repair' to salvage entries.", "err", err, "corrupt", cache.filePath+cacheCorruptSuffix)
+		}
+	}
+	if cache.data == nil {
+		cache.data = make(map[string]map[string][]string)
 	}
 
 	return cache, nil
@@ -48,6 +87,14 @@ func NewCache() (*Cache, error) {
 
 // Get returns a copy of the map associated with the given key or an empty map if the key doesn't exist.
 func (c *Cache) Get(key string) map[string][]string {
+	if c.remote != nil {
+		value, err := c.remote.get(key)
+		if err != nil {
+			slog.Warn("Failed to read cache from Redis. May download duplicate files.", "key", key, "err", err)
+			return make(map[string][]string)
+		}
+		return value
+	}
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
@@ -68,6 +115,12 @@ func (c *Cache) Set(key string, value map[string][]string, overwrite bool) {
 	if len(value) == 0 {
 		return
 	}
+	if c.remote != nil {
+		if err := c.remote.set(key, value, overwrite); err != nil {
+			slog.Warn("Failed to write cache to Redis. May download duplicate files.", "key", key, "err", err)
+		}
+		return
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -91,6 +144,12 @@ func (c *Cache) RemoveNotIn(key string, validEntries map[string][]string) {
 	if len(validEntries) == 0 {
 		return
 	}
+	if c.remote != nil {
+		if err := c.remote.removeNotIn(key, validEntries); err != nil {
+			slog.Warn("Failed to remove expired cache entries from Redis.", "key", key, "err", err)
+		}
+		return
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -102,34 +161,107 @@ func (c *Cache) RemoveNotIn(key string, validEntries map[string][]string) {
 	}
 }
 
+// Delete removes the map associated with the given key from the cache.
+func (c *Cache) Delete(key string) {
+	if c.remote != nil {
+		if err := c.remote.del(key); err != nil {
+			slog.Warn("Failed to delete cache key from Redis.", "key", key, "err", err)
+		}
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.data, key)
+}
+
+// AllInfoHashes collects the infoHashes of all torrents recorded in the cache.
+func (c *Cache) AllInfoHashes() map[string]struct{} {
+	if c.remote != nil {
+		infoHashSet := make(map[string]struct{})
+		keys, err := c.remote.keys()
+		if err != nil {
+			slog.Warn("Failed to read cache from Redis. May download duplicate files.", "err", err)
+		}
+		for _, key := range keys {
+			for _, infoHashes := range c.Get(key) {
+				for _, infoHash := range infoHashes {
+					infoHashSet[infoHash] = struct{}{}
+				}
+			}
+		}
+		return infoHashSet
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	size := 0
+	for _, items := range c.data {
+		size += len(items)
+	}
+	infoHashSet := make(map[string]struct{}, size)
+	for _, items := range c.data {
+		for _, infoHashes := range items {
+			for _, infoHash := range infoHashes {
+				infoHashSet[infoHash] = struct{}{}
+			}
+		}
+	}
+	return infoHashSet
+}
+
 // Flush serializes the cache data and writes it to disk at the specified file path.
+// A cache kept in Redis is written on every change and has nothing to flush.
 func (c *Cache) Flush() error {
+	if c.remote != nil {
+		return nil
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	return saveCache(c.filePath, c.data)
+	if err := saveCache(c.filePath, c.data, c.fileGood); err != nil {
+		return err
+	}
+	c.fileGood = true
+	return nil
 }
 
-// saveCache creates necessary directories and serializes the given object to a file using gob encoding.
+// saveCache creates necessary directories and serializes the given object to a file using YAML encoding.
+// The file is replaced atomically; if keepBackup is true, the replaced file is kept as the backup.
 // It returns an error if directory creation or file writing fails.
-func saveCache(filePath string, object interface{}) error {
+func saveCache(filePath string, object interface{}, keepBackup bool) error {
 	if err := os.MkdirAll(filepath.Dir(filePath), 0744); err != nil {
 		slog.Warn("Failed to create directory for cache file.", "err", err)
 		return err
 	}
 
-	file, err := os.Create(filePath)
+	tmpPath := filePath + ".tmp"
+	file, err := os.Create(tmpPath)
 	if err != nil {
 		slog.Warn("Failed to write cache to disk. May download duplicate files.", "err", err)
 		return err
 	}
-	defer file.Close()
-
 	encoder := yaml.NewEncoder(file)
-	defer encoder.Close()
-	return encoder.Encode(object)
+	err = encoder.Encode(object)
+	if closeErr := encoder.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		slog.Warn("Failed to write cache to disk. May download duplicate files.", "err", err)
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if keepBackup {
+		if err := os.Rename(filePath, filePath+cacheBackupSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Failed to keep backup of cache file.", "err", err)
+		}
+	}
+	return os.Rename(tmpPath, filePath)
 }
 
-// loadCache opens a file and deserializes its contents into the provided object using gob encoding.
+// loadCache opens a file and deserializes its contents into the provided object using YAML encoding.
 // Returns an error if the file cannot be opened or if decoding fails.
 func loadCache(filePath string, object interface{}) error {
 	file, err := os.Open(filePath)
@@ -0,0 +1,164 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// cacheCommand groups the cache maintenance subcommands, it has no action of its own.
+type cacheCommand struct{}
+
+// cacheRepairCommand implements the 'cache repair' subcommand.
+type cacheRepairCommand struct{}
+
+func init() {
+	cmd, _ := parser.AddCommand("cache",
+		"Maintain the cache file",
+		"Maintain the cache of processed feed items and added infohashes.",
+		&cacheCommand{})
+	cmd.AddCommand("repair",
+		"Salvage entries from a corrupted cache file",
+		"Parse the corrupted cache file feed by feed and keep every entry that can still be read. "+
+			"The daemon sets a corrupted cache file aside with a .corrupt suffix; its entries are merged into "+
+			"the current cache. Otherwise the cache file itself is repaired and the original kept with a .corrupt suffix.",
+		&cacheRepairCommand{})
+}
+
+// Execute repairs the cache file of the current user.
+func (c *cacheRepairCommand) Execute(args []string) error {
+	lock, err := AcquireLock(false)
+	if err != nil {
+		return fmt.Errorf("stop the daemon before repairing the cache: %w", err)
+	}
+	defer lock.Release()
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	filePath := filepath.Join(homeDir, cacheFileName)
+	corruptPath := filePath + cacheCorruptSuffix
+
+	// A file set aside by the daemon is merged into the cache it started afresh
+	content, err := os.ReadFile(corruptPath)
+	setAside := err == nil
+	if errors.Is(err, os.ErrNotExist) {
+		content, err = os.ReadFile(filePath)
+	}
+	if err != nil {
+		return err
+	}
+
+	data, dropped := salvageCache(content)
+	if !setAside && dropped == 0 {
+		fmt.Println("cache file is valid, nothing to repair")
+		return nil
+	}
+	feeds, items := len(data), 0
+	for _, entries := range data {
+		items += len(entries)
+	}
+
+	if setAside {
+		current := make(map[string]map[string][]string)
+		if err := loadCache(filePath, &current); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("current cache file: %w", err)
+		}
+		mergeCache(current, data)
+		data = current
+	} else if err := os.Rename(filePath, corruptPath); err != nil {
+		return err
+	}
+	if err := saveCache(filePath, data, setAside); err != nil {
+		return err
+	}
+	fmt.Printf("salvaged %d feeds with %d items from %s, dropped %d unreadable lines\n", feeds, items, corruptPath, dropped)
+	return nil
+}
+
+// mergeCache adds the entries of salvaged to data, keeping those of data which are more recent.
+func mergeCache(data, salvaged map[string]map[string][]string) {
+	for feed, entries := range salvaged {
+		if data[feed] == nil {
+			data[feed] = make(map[string][]string, len(entries))
+		}
+		for guid, infoHashes := range entries {
+			if _, exists := data[feed][guid]; !exists {
+				data[feed][guid] = infoHashes
+			}
+		}
+	}
+}
+
+// salvageCache decodes as much as possible of a cache file. The file is split into one block per feed,
+// and each block is decoded on its own; a block that fails is cut back line by line until its head decodes.
+// It returns the salvaged data and the number of lines dropped.
+func salvageCache(content []byte) (map[string]map[string][]string, int) {
+	data := make(map[string]map[string][]string)
+	if err := yaml.Unmarshal(content, &data); err == nil {
+		return data, 0
+	}
+
+	data = make(map[string]map[string][]string)
+	dropped := 0
+	for _, block := range splitTopLevelBlocks(content) {
+		lines := bytes.SplitAfter(block, []byte("\n"))
+		if len(lines[len(lines)-1]) == 0 {
+			// Not a line, the block ended with a newline
+			lines = lines[:len(lines)-1]
+		}
+		for n := len(lines); n > 0; n-- {
+			part := make(map[string]map[string][]string)
+			if err := yaml.Unmarshal(bytes.Join(lines[:n], nil), &part); err == nil {
+				for feed, entries := range part {
+					if entries != nil {
+						data[feed] = entries
+					}
+				}
+				break
+			}
+			dropped++
+		}
+	}
+	return data, dropped
+}
+
+// splitTopLevelBlocks splits a YAML mapping document before every line starting a top-level key.
+func splitTopLevelBlocks(content []byte) [][]byte {
+	var blocks [][]byte
+	var current []byte
+	for _, line := range bytes.SplitAfter(content, []byte("\n")) {
+		if isTopLevelKey(line) && len(current) > 0 {
+			blocks = append(blocks, current)
+			current = nil
+		}
+		current = append(current, line...)
+	}
+	if len(current) > 0 {
+		blocks = append(blocks, current)
+	}
+	return blocks
+}
+
+// isTopLevelKey reports whether the line starts a key of the top-level mapping.
+func isTopLevelKey(line []byte) bool {
+	if len(line) == 0 {
+		return false
+	}
+	switch line[0] {
+	case ' ', '\t', '\n', '\r', '#', '-', '.':
+		return false
+	}
+	return true
+}
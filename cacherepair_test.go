@@ -0,0 +1,66 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSalvageCache(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]map[string][]string
+		dropped int
+	}{
+		{
+			name:    "valid",
+			content: "http://a/rss:\n  g1:\n  - hash1\n  g2: []\n",
+			want:    map[string]map[string][]string{"http://a/rss": {"g1": {"hash1"}, "g2": {}}},
+		},
+		{
+			name:    "empty",
+			content: "",
+			want:    map[string]map[string][]string{},
+		},
+		{
+			name:    "truncated last feed",
+			content: "http://a/rss:\n  g1:\n  - hash1\nhttp://b/rss:\n  g2:\n  - hash2\n  g3:\n  - \"hash",
+			want:    map[string]map[string][]string{"http://a/rss": {"g1": {"hash1"}}, "http://b/rss": {"g2": {"hash2"}, "g3": nil}},
+			dropped: 1,
+		},
+		{
+			name:    "garbage between feeds",
+			content: "http://a/rss:\n  g1: []\n\x00\x00: [\nhttp://b/rss:\n  g2: []\n",
+			want:    map[string]map[string][]string{"http://a/rss": {"g1": {}}, "http://b/rss": {"g2": {}}},
+			dropped: 1,
+		},
+		{
+			name:    "nothing left of a feed",
+			content: "http://a/rss:\n  g1: [\"hash1\n",
+			want:    map[string]map[string][]string{},
+			dropped: 1,
+		},
+	}
+	for _, tt := range tests {
+		got, dropped := salvageCache([]byte(tt.content))
+		if !reflect.DeepEqual(got, tt.want) || dropped != tt.dropped {
+			t.Errorf("%s: salvageCache() = %v, %d dropped, want %v, %d dropped", tt.name, got, dropped, tt.want, tt.dropped)
+		}
+	}
+}
+
+func TestMergeCache(t *testing.T) {
+	data := map[string]map[string][]string{"http://a/rss": {"g1": {"new"}}}
+	salvaged := map[string]map[string][]string{"http://a/rss": {"g1": {"old"}, "g2": nil}, "http://b/rss": {"g3": {"hash3"}}}
+	mergeCache(data, salvaged)
+	want := map[string]map[string][]string{"http://a/rss": {"g1": {"new"}, "g2": nil}, "http://b/rss": {"g3": {"hash3"}}}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("mergeCache() = %v, want %v", data, want)
+	}
+}
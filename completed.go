@@ -0,0 +1,54 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// completedIndex maps the normalized names of the entries of a completed downloads directory to the entries.
+type completedIndex map[string]string
+
+// scanCompletedDir lists the folders and files of the completed downloads directory.
+// The extension of files is ignored, so a single-file release matches its title too.
+func scanCompletedDir(dir string) (completedIndex, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	index := make(completedIndex, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() {
+			name = strings.TrimSuffix(name, filepath.Ext(name))
+		}
+		if normalized := normalizeReleaseName(name); normalized != "" {
+			index[normalized] = entry.Name()
+		}
+	}
+	return index, nil
+}
+
+// Find returns the entry matching the release name, or "" if there is none.
+func (c completedIndex) Find(release string) string {
+	return c[normalizeReleaseName(release)]
+}
+
+// normalizeReleaseName lowercases the name and keeps only letters and digits, so that names differing
+// in punctuation, brackets or separators such as '.', '_' and ' ' compare equal.
+func normalizeReleaseName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
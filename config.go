@@ -10,13 +10,15 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/liuzl/gocc"
-	"gopkg.in/yaml.v3"
+	"github.com/robfig/cron/v3"
 )
 
 const (
@@ -33,111 +35,329 @@ var validTags = map[string]struct{}{
 type Tasks []*Task
 
 // LoadConfig returns a Tasks object based on the given filename.
+// Every problem of every task is reported, not only the first one.
 func LoadConfig(filename string) (*Tasks, error) {
-	config, err := loadYAMLConfig(filename)
+	src, err := loadYAMLConfig(filename)
 	if err != nil {
 		return nil, err
 	}
 
-	// The filtering criteria ignore the distinction between traditional and simplified Chinese,
-	// so here the Include and Exclude keywords are converted to simplified Chinese.
-	cc, err := gocc.New("t2s") // "t2s" traditional Chinese -> simplified Chinese
-	if err != nil {
-		slog.Warn("Failed to initialize Chinese converter.", "err", err)
-	}
-
+	cc := newConverter()
 	tasks := Tasks{}
-	for _, value := range config {
-		task, ok := value.(map[string]interface{})
-		if !ok {
+	var errs []error
+	for _, name := range src.Names() {
+		taskObj, taskErrs := src.ParseTask(name, cc)
+		if len(taskErrs) > 0 {
+			for _, err := range taskErrs {
+				slog.Error("Configuration file error.", "err", err)
+			}
+			errs = append(errs, taskErrs...)
 			continue
 		}
-
-		taskObj, err := parseTask(task, cc)
-		if err != nil {
-			slog.Error("Configuration file error.", "err", err)
-			return nil, err
-		}
-
 		tasks = append(tasks, taskObj)
 	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
 	return &tasks, nil
 }
 
-// loadYAMLConfig reads and unmarshals a YAML configuration file.
-func loadYAMLConfig(filename string) (map[string]interface{}, error) {
-	source, err := os.ReadFile(filename)
-	if err != nil {
-		slog.Error("Failed to read config file.", "err", err)
-		return nil, err
-	}
+// newConverter returns the traditional to simplified Chinese converter, or nil if it can't be initialized.
+// The filtering criteria ignore the distinction between traditional and simplified Chinese,
+// so the Include and Exclude keywords and the titles are converted to simplified Chinese.
+// A task may choose another conversion in its normalize section.
+func newConverter() *gocc.OpenCC {
+	return converter("t2s") // "t2s" traditional Chinese -> simplified Chinese
+}
 
-	var config map[string]interface{}
-	if err := yaml.Unmarshal(source, &config); err != nil {
-		slog.Error("Failed to unmarshal config file.", "err", err)
+// loadYAMLConfig reads and unmarshals a YAML configuration file, or every config file of a directory,
+// along with the files they include.
+func loadYAMLConfig(filename string) (*configSource, error) {
+	src, err := loadConfigFiles(filename)
+	if err != nil {
+		slog.Error("Failed to load config file.", "err", err)
 		return nil, err
 	}
+	return src, nil
+}
 
-	return config, nil
+// KeyError is a problem with the value of a key of a task.
+type KeyError struct {
+	Key string
+	Err error
 }
 
+func (e *KeyError) Error() string { return e.Err.Error() }
+
+func (e *KeyError) Unwrap() error { return e.Err }
+
 // parseTask processes each task in the configuration.
-func parseTask(task map[string]interface{}, cc *gocc.OpenCC) (*Task, error) {
-	_, hasAria2c := task["aria2c"]
-	_, hasTransmission := task["transmission"]
+func parseTask(name string, task map[string]interface{}, cc *gocc.OpenCC) (*Task, error) {
+	var servers []string
+	for _, serverKey := range serverKeys {
+		if _, exists := task[serverKey]; exists {
+			servers = append(servers, serverKey)
+		}
+	}
 
-	if hasAria2c && hasTransmission {
-		return nil, errors.New("both aria2c and transmission RPC servers specified; only one allowed")
-	} else if !hasAria2c && !hasTransmission {
-		return nil, errors.New("neither aria2c nor transmission RPC server specified")
+	// Problems are collected rather than returned one by one, so that they can all be fixed at once
+	var errs []error
+	if len(servers) > 1 {
+		errs = append(errs, fmt.Errorf("both %s specified; only one allowed", strings.Join(servers, " and ")))
+	} else if len(servers) == 0 {
+		errs = append(errs, fmt.Errorf("no RPC server specified; one of %s required", strings.Join(serverKeys, ", ")))
 	}
 
 	if _, hasFeed := task["feed"]; !hasFeed {
-		return nil, errors.New("feed section missing")
+		errs = append(errs, errors.New("feed section missing"))
+	}
+
+	_, hasInterval := task["interval"]
+	_, hasSchedule := task["schedule"]
+	if hasInterval && hasSchedule {
+		errs = append(errs, &KeyError{Key: "schedule", Err: errors.New("both interval and schedule specified; only one allowed")})
 	}
 
-	t := &Task{parserConfig: &ParserConfig{}, FetchInterval: defaultFetchInterval * time.Minute}
+	pc := &ParserConfig{normalizer: &textNormalizer{cc: cc}}
+	t := &Task{Name: name, parserConfig: pc, FetchInterval: defaultFetchInterval * time.Minute, FetchWorkers: defaultFetchWorkers, Jitter: -1, Notify: &NotifyConfig{}}
 
+	// Vars and the normalization of keywords are needed by other keys, so they are parsed first
+	var vars map[string]string
 	for k, v := range task {
+		var err error
 		switch strings.ToLower(k) {
-		case "aria2c":
-			parseAria2cConfig(t, v)
-		case "transmission":
-			parseTransmissionConfig(t, v)
+		case "vars":
+			vars, err = parseVarsConfig(v)
+		case "normalize":
+			pc.normalizer, err = parseNormalizeConfig(v, cc)
+		}
+		if err != nil {
+			errs = append(errs, &KeyError{Key: k, Err: err})
+		}
+	}
+	if pc.normalizer.costly() {
+		pc.titles = newTitleMemo(defaultTitleMemoSize)
+	}
+
+	for k, v := range task {
+		switch strings.ToLower(k) {
+		case "aria2c", "transmission", "sonarr", "radarr":
+			if err := parseServerConfig(t, k, v); err != nil {
+				errs = append(errs, &KeyError{Key: k, Err: err})
+			}
+		case fallbacksKey:
+			fallbacks, err := parseFallbacksConfig(v)
+			if err != nil {
+				errs = append(errs, &KeyError{Key: k, Err: err})
+				continue
+			}
+			t.Fallbacks = fallbacks
 		case "feed":
-			if urls := parseFeedsConfig(v); urls == nil {
-				return nil, errors.New("feed URL missing or contains non url")
-			} else {
-				t.FeedUrls = urls
+			urls, intervals, err := parseFeedsConfig(v)
+			if err != nil {
+				errs = append(errs, &KeyError{Key: k, Err: err})
+				continue
 			}
+			t.FeedUrls = urls
+			t.FeedIntervals = intervals
 		case "interval":
 			t.FetchInterval = time.Duration(getIntOrDefault(v, defaultFetchInterval)) * time.Minute
+		case "schedule":
+			spec, ok := v.(string)
+			if !ok || spec == "" {
+				errs = append(errs, &KeyError{Key: k, Err: errors.New("missing cron expression in schedule")})
+				continue
+			}
+			schedule, err := cron.ParseStandard(spec)
+			if err != nil {
+				errs = append(errs, &KeyError{Key: k, Err: errors.New("invalid 'schedule': " + spec)})
+				continue
+			}
+			t.Schedule = schedule
+			t.ScheduleSpec = spec
+		case "workers":
+			t.FetchWorkers = getIntOrDefault(v, defaultFetchWorkers)
+		case "quiet":
+			quiet, err := parseQuietConfig(v)
+			if err != nil {
+				errs = append(errs, &KeyError{Key: k, Err: err})
+				continue
+			}
+			t.Quiet = quiet
+		case "jitter":
+			t.Jitter = getPercentOrDefault(v, 0)
+		case "approval":
+			if err := parseApprovalConfig(t, v); err != nil {
+				errs = append(errs, &KeyError{Key: k, Err: err})
+			}
+		case "completed":
+			dir, ok := v.(string)
+			if !ok || dir == "" {
+				errs = append(errs, &KeyError{Key: k, Err: errors.New("invalid 'completed': must be a directory")})
+				continue
+			}
+			t.CompletedDir = dir
+		case "options":
+			options, err := parseOptionsConfig(v)
+			if err != nil {
+				errs = append(errs, &KeyError{Key: k, Err: err})
+				continue
+			}
+			t.Options = *options
+		case "archive":
+			dir, ok := v.(string)
+			if !ok || dir == "" {
+				errs = append(errs, &KeyError{Key: k, Err: errors.New("invalid 'archive': must be a directory")})
+				continue
+			}
+			pc.Archive = dir
+		case "tags":
+			tags, err := parseTagsConfig(v)
+			if err != nil {
+				errs = append(errs, &KeyError{Key: k, Err: err})
+				continue
+			}
+			t.Tags = tags
+		case "lenient":
+			t.parserConfig.Lenient = getBoolOrDefault(v, false)
+		case "episodes":
+			t.Episodes = getBoolOrDefault(v, false)
+		case "notify":
+			notify, err := parseNotifyConfig(v)
+			if err != nil {
+				errs = append(errs, &KeyError{Key: k, Err: err})
+				continue
+			}
+			t.Notify = notify
+		case "fuzzy":
+			fuzzy, err := parseFuzzyConfig(v)
+			if err != nil {
+				errs = append(errs, &KeyError{Key: k, Err: err})
+				continue
+			}
+			t.Fuzzy = fuzzy
+		case "dedup":
+			dedup, err := parseDedupConfig(v)
+			if err != nil {
+				errs = append(errs, &KeyError{Key: k, Err: err})
+				continue
+			}
+			t.Dedup = dedup
+		case "quality":
+			quality, err := parseQualityConfig(v)
+			if err != nil {
+				errs = append(errs, &KeyError{Key: k, Err: err})
+				continue
+			}
+			t.Quality = quality
 		case "filter":
-			parseFilterConfig(t, v, cc)
+			v, err := interpolateVars(v, vars)
+			if err != nil {
+				errs = append(errs, &KeyError{Key: k, Err: errors.New("invalid 'filter': " + err.Error())})
+				continue
+			}
+			if err := parseFilterConfig(t, v); err != nil {
+				errs = append(errs, &KeyError{Key: k, Err: err})
+			}
+		case "when":
+			v, err := interpolateVars(v, vars)
+			if err == nil {
+				pc.When, err = parseWhen(v)
+			}
+			if err != nil {
+				errs = append(errs, &KeyError{Key: k, Err: err})
+			}
 		case "extracter":
+			v, err := interpolateVars(v, vars)
+			if err != nil {
+				errs = append(errs, &KeyError{Key: k, Err: errors.New("invalid 'extracter': " + err.Error())})
+				continue
+			}
 			if err := parseExtracterConfig(t, v); err != nil {
-				return nil, err
+				errs = append(errs, &KeyError{Key: k, Err: err})
 			}
 		}
 	}
+	for _, fallback := range t.Fallbacks {
+		if t.ServerConfig.RpcType != "" && isArr(fallback.RpcType) != isArr(t.ServerConfig.RpcType) {
+			errs = append(errs, &KeyError{Key: fallbacksKey, Err: fmt.Errorf("fallback %s can't take over from %s: torrent clients and sonarr or radarr can't be mixed", fallback.RpcType, t.ServerConfig.RpcType)})
+			break
+		}
+	}
 
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
 	return t, nil
 }
 
+// parseServerConfig processes the RPC server section key of a task.
+func parseServerConfig(t *Task, key string, v interface{}) error {
+	switch kind := strings.ToLower(key); kind {
+	case "aria2c":
+		return parseAria2cConfig(t, v)
+	case "transmission":
+		return parseTransmissionConfig(t, v)
+	case "sonarr", "radarr":
+		return parseArrConfig(t, kind, v)
+	default:
+		return fmt.Errorf("unknown RPC server '%s', expected one of %s", key, strings.Join(serverKeys, ", "))
+	}
+}
+
+// parseFallbacksConfig processes the fallbacks of a task, a list of RPC server sections such as
+// {aria2c: {url: ...}} tried in turn when the server of the task fails.
+func parseFallbacksConfig(v interface{}) ([]ServerConfig, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("invalid 'fallbacks': must be a list of RPC servers")
+	}
+	var fallbacks []ServerConfig
+	for _, item := range list {
+		server, ok := item.(map[string]interface{})
+		if !ok || len(server) != 1 {
+			return nil, fmt.Errorf("invalid 'fallbacks': each must be a section with one of %s", strings.Join(serverKeys, ", "))
+		}
+		fallback := &Task{}
+		for k, v := range server {
+			if err := parseServerConfig(fallback, k, v); err != nil {
+				return nil, err
+			}
+		}
+		fallbacks = append(fallbacks, fallback.ServerConfig)
+	}
+	return fallbacks, nil
+}
+
 // parseAria2cConfig processes the aria2c configuration.
-func parseAria2cConfig(t *Task, v interface{}) {
+func parseAria2cConfig(t *Task, v interface{}) error {
 	server, ok := v.(map[string]interface{})
 	if !ok || server == nil {
 		t.ServerConfig.Url = defaultAria2cRpcUrl
 	} else {
 		t.ServerConfig.Url = getStringOrDefault(server["url"], defaultAria2cRpcUrl)
-		t.ServerConfig.Token = convertToString(server["token"])
+		token, err := getSecret(server, "token")
+		if err != nil {
+			return err
+		}
+		t.ServerConfig.Token = token
 	}
 	t.ServerConfig.RpcType = "aria2c"
+
+	u, err := url.Parse(t.ServerConfig.Url)
+	if err != nil || u.Host == "" {
+		return errors.New("invalid aria2c 'url': " + t.ServerConfig.Url)
+	}
+	switch u.Scheme {
+	case "ws", "wss", "http", "https":
+		return nil
+	default:
+		return errors.New("unsupported aria2c 'url' scheme: " + u.Scheme)
+	}
 }
 
 // parseTransmissionConfig processes the transmission configuration.
-func parseTransmissionConfig(t *Task, v interface{}) {
+func parseTransmissionConfig(t *Task, v interface{}) error {
 	server, ok := v.(map[string]interface{})
 	if !ok || server == nil {
 		t.ServerConfig.Host = defaultTransmissionRpcHost
@@ -145,88 +365,295 @@ func parseTransmissionConfig(t *Task, v interface{}) {
 	} else {
 		t.ServerConfig.Host = getStringOrDefault(server["host"], defaultTransmissionRpcHost)
 		t.ServerConfig.Port = uint16(getIntOrDefault(server["port"], defaultTransmissionRpcPort))
-		t.ServerConfig.Username = convertToString(server["username"])
-		t.ServerConfig.Password = convertToString(server["password"])
+		username, err := getSecret(server, "username")
+		if err != nil {
+			return err
+		}
+		t.ServerConfig.Username = username
+		password, err := getSecret(server, "password")
+		if err != nil {
+			return err
+		}
+		t.ServerConfig.Password = password
 	}
 	t.ServerConfig.RpcType = "transmission"
+	return nil
+}
+
+// parseArrConfig processes the configuration of a Sonarr or Radarr instance.
+func parseArrConfig(t *Task, kind string, v interface{}) error {
+	defaultUrl := defaultSonarrUrl
+	if kind == "radarr" {
+		defaultUrl = defaultRadarrUrl
+	}
+	server, ok := v.(map[string]interface{})
+	if !ok || server == nil {
+		return fmt.Errorf("%s 'apiKey' missing", kind)
+	}
+	t.ServerConfig.Url = getStringOrDefault(server["url"], defaultUrl)
+	apiKey, err := getSecret(server, "apiKey")
+	if err != nil {
+		return err
+	}
+	if apiKey == "" {
+		return fmt.Errorf("%s 'apiKey' missing", kind)
+	}
+	t.ServerConfig.Token = apiKey
+	t.ServerConfig.RpcType = kind
+
+	u, err := url.Parse(t.ServerConfig.Url)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("invalid %s 'url': %s", kind, t.ServerConfig.Url)
+	}
+	return nil
+}
+
+// getSecret returns the secret stored under key, or read from the file named by key + "File" (or
+// key + "_file"), such as a mounted Docker or Kubernetes secret. Trailing newlines of the file are removed.
+// Relative paths were made relative to the config file by resolveSecretFiles.
+func getSecret(server map[string]interface{}, key string) (string, error) {
+	fileKey := key + "File"
+	if _, exists := server[fileKey]; !exists {
+		fileKey = key + "_file"
+	}
+	file := convertToString(server[fileKey])
+	if file == "" {
+		return convertToString(server[key]), nil
+	}
+	if _, exists := server[key]; exists {
+		return "", errors.New("both '" + key + "' and '" + fileKey + "' specified; only one allowed")
+	}
+	secret, err := os.ReadFile(file)
+	if err != nil {
+		return "", errors.New("invalid '" + fileKey + "': " + err.Error())
+	}
+	return strings.TrimRight(string(secret), "\r\n"), nil
+}
+
+// resolveSecretFiles makes the relative paths of the secret files found in value, under keys ending in 'File'
+// or '_file', relative to dir, the directory of the config file, rather than to the working directory.
+func resolveSecretFiles(value interface{}, dir string) {
+	section, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for key, v := range section {
+		if file, ok := v.(string); ok && (strings.HasSuffix(key, "File") || strings.HasSuffix(key, "_file")) {
+			if file != "" && !filepath.IsAbs(file) {
+				section[key] = filepath.Join(dir, file)
+			}
+			continue
+		}
+		resolveSecretFiles(v, dir)
+	}
 }
 
 // parseFeedConfig processes the feed configuration.
-func parseFeedsConfig(v interface{}) []string {
+// A feed is either a URL string or an object with 'url' and an optional 'interval' overriding the task interval.
+func parseFeedsConfig(v interface{}) ([]string, map[string]time.Duration, error) {
 	var urls []string
+	intervals := make(map[string]time.Duration)
 	switch v := v.(type) {
 	case []interface{}:
 		urls = make([]string, len(v))
 		for i, item := range v {
-			if url, ok := item.(string); ok {
-				urls[i] = url
-			} else {
-				return nil
+			switch item := item.(type) {
+			case string:
+				urls[i] = item
+			case map[string]interface{}:
+				feedUrl, ok := item["url"].(string)
+				if !ok || feedUrl == "" {
+					return nil, nil, errors.New("feed URL missing")
+				}
+				urls[i] = feedUrl
+				if interval := getIntOrDefault(item["interval"], 0); interval > 0 {
+					intervals[feedUrl] = time.Duration(interval) * time.Minute
+				}
+			default:
+				return nil, nil, fmt.Errorf("invalid feed %v: must be a URL or a map with 'url'", item)
 			}
 		}
 	case string:
 		urls = []string{v}
 	}
-	return urls
+	for _, feedUrl := range urls {
+		if u, err := url.Parse(feedUrl); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, nil, errors.New("invalid feed URL '" + feedUrl + "': must be an http or https URL")
+		}
+	}
+	if len(urls) == 0 {
+		return nil, nil, errors.New("feed URL missing")
+	}
+	return urls, intervals, nil
 }
 
 // parseFilterConfig processes the filter configuration.
-func parseFilterConfig(t *Task, v interface{}, cc *gocc.OpenCC) {
+// 'include' and 'exclude' apply to the title, 'fields' holds the filters of other fields.
+func parseFilterConfig(t *Task, v interface{}) error {
 	if rawMap, ok := v.(map[string]interface{}); ok {
 		filter := convertToStringSliceMap(rawMap)
-		t.parserConfig.Include = normalizeAndSimplifyTexts(cc, filter["include"])
-		t.parserConfig.Exclude = normalizeAndSimplifyTexts(cc, filter["exclude"])
+		n := t.parserConfig.normalizer
+		t.parserConfig.Include = normalizeAndSimplifyTexts(n, filter["include"])
+		t.parserConfig.Exclude = normalizeAndSimplifyTexts(n, filter["exclude"])
+		if fields, exists := rawMap["fields"]; exists {
+			var err error
+			if t.parserConfig.Fields, err = parseFieldFilters(fields, n); err != nil {
+				return err
+			}
+		}
+		for key, age := range map[string]*time.Duration{"maxAge": &t.parserConfig.MaxAge, "minAge": &t.parserConfig.MinAge} {
+			if v, exists := rawMap[key]; exists {
+				var err error
+				if *age, err = parseAge(key, v); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// parseTagsConfig processes the tags of a task, a single tag or a list of tags.
+func parseTagsConfig(v interface{}) ([]string, error) {
+	var tags []string
+	switch v := v.(type) {
+	case string:
+		tags = []string{v}
+	case []interface{}:
+		for _, tag := range v {
+			tags = append(tags, convertToString(tag))
+		}
+	default:
+		return nil, errors.New("invalid 'tags': must be a list")
+	}
+	for _, tag := range tags {
+		if tag == "" {
+			return nil, errors.New("invalid 'tags': empty tag")
+		}
+	}
+	return tags, nil
+}
+
+// parseQuietConfig processes the quiet hours configuration.
+// 'false' disables the global quiet hours for the task.
+func parseQuietConfig(v interface{}) (*QuietHours, error) {
+	if enabled, ok := v.(bool); ok && !enabled {
+		return &QuietHours{}, nil
+	}
+	quiet, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid 'quiet'")
+	}
+	hours, ok := quiet["hours"].(string)
+	if !ok || hours == "" {
+		return nil, errors.New("missing 'hours' in quiet")
 	}
+	return ParseQuietHours(hours, convertToString(quiet["mode"]))
 }
 
-// parseExtracterConfig processes and validates the extracter configuration.
+// parseApprovalConfig processes the approval configuration, either a mode or an object with 'mode' and 'expire' in days.
+func parseApprovalConfig(t *Task, v interface{}) error {
+	mode := v
+	if approval, ok := v.(map[string]interface{}); ok {
+		mode = approval["mode"]
+		if days := getIntOrDefault(approval["expire"], 0); days > 0 {
+			t.ApprovalExpiry = time.Duration(days) * 24 * time.Hour
+		}
+	}
+	switch mode := strings.ToLower(convertToString(mode)); mode {
+	case "auto", "":
+	case "manual":
+		t.ManualApproval = true
+	default:
+		return errors.New("invalid 'approval': " + mode)
+	}
+	return nil
+}
+
+// parseExtracterConfig processes and validates the extracter configuration, either a single extracter
+// or a list of extracters tried in order.
 func parseExtracterConfig(t *Task, v interface{}) error {
+	list, isList := v.([]interface{})
+	if !isList {
+		list = []interface{}{v}
+	} else if len(list) == 0 {
+		return errors.New("invalid 'extracter': empty list")
+	}
+	extracters := make([]*Extracter, 0, len(list))
+	for _, v := range list {
+		e, err := parseExtracter(v)
+		if err != nil {
+			return err
+		}
+		extracters = append(extracters, e)
+	}
+	t.parserConfig.Extracters = extracters
+	return nil
+}
+
+// parseExtracter processes and validates a single extracter.
+func parseExtracter(v interface{}) (*Extracter, error) {
+	if mode, ok := v.(string); ok && strings.ToLower(mode) == autoExtracter {
+		return &Extracter{Tag: autoExtracter}, nil
+	}
 	extract, ok := v.(map[string]interface{})
 	if !ok {
-		return errors.New("invalid 'extracter'")
+		return nil, errors.New("invalid 'extracter'")
 	}
 
 	tag, tagOk := extract["tag"].(string)
 	if !tagOk || tag == "" {
-		return errors.New("missing 'tag' in extracter")
+		return nil, errors.New("missing 'tag' in extracter")
 	}
 	tag = strings.ToLower(tag)
 	if _, valid := validTags[tag]; !valid {
-		return errors.New("invalid 'tag': " + tag + " in extracter")
+		return nil, errors.New("invalid 'tag': " + tag + " in extracter")
+	}
+
+	e := &Extracter{Tag: tag}
+	if selector, exists := extract["selector"]; exists {
+		if e.Selector, _ = selector.(string); e.Selector == "" {
+			return nil, errors.New("invalid 'selector' in extracter: must be a string")
+		}
+		var err error
+		if e.sel, e.attr, err = parseSelector(e.Selector); err != nil {
+			return nil, err
+		}
+		// The selected values may be used as they are
+		if _, exists := extract["pattern"]; !exists {
+			return e, nil
+		}
 	}
-	t.parserConfig.Tag = tag
 
 	pattern, patternOk := extract["pattern"].(string)
 	if !patternOk || pattern == "" {
-		return errors.New("missing 'pattern' in extracter")
+		return nil, errors.New("missing 'pattern' in extracter")
 	}
 	r, err := regexp.Compile(pattern)
 	if err != nil {
-		return errors.New("invalid 'pattern': " + pattern + " in extracter")
+		return nil, errors.New("invalid 'pattern' in extracter: " + err.Error())
 	}
-	t.parserConfig.Pattern = pattern
-	t.parserConfig.r = r
-
-	t.parserConfig.Trick = true
-
-	return nil
-}
+	e.Pattern, e.r = pattern, r
 
-// normalizeAndSimplifyTexts converts given []string to lowercase and applies Chinese simplification if needed.
-func normalizeAndSimplifyTexts(cc *gocc.OpenCC, texts []string) []string {
-	if cc == nil {
-		return texts
+	if text, exists := extract["template"]; exists {
+		if e.Template, _ = text.(string); e.Template == "" {
+			return nil, errors.New("invalid 'template' in extracter: must be a string")
+		}
+		if e.t, err = parseExtracterTemplate(e.Template, r); err != nil {
+			return nil, err
+		}
+	} else if r.NumSubexp() == 0 {
+		return nil, errors.New("invalid 'pattern' in extracter: needs a group capturing the hash")
 	}
+	return e, nil
+}
 
-	var simplified []string
+// normalizeAndSimplifyTexts converts given []string to lowercase and applies the Chinese conversion
+// and other normalizations of the task.
+func normalizeAndSimplifyTexts(n *textNormalizer, texts []string) []string {
+	simplified := make([]string, 0, len(texts))
 	for _, text := range texts {
-		text = strings.TrimSpace(strings.ToLower(text))
-		result, err := cc.Convert(text)
-		if err != nil {
-			simplified = append(simplified, text)
-		} else {
-			simplified = append(simplified, result)
-		}
+		simplified = append(simplified, n.Normalize(strings.TrimSpace(text)))
 	}
 	return simplified
 }
@@ -280,3 +707,19 @@ func getIntOrDefault(v interface{}, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// getPercentOrDefault tries to get an integer between 0 and 100 from a interface or returns a default value.
+func getPercentOrDefault(v interface{}, defaultValue int) int {
+	if value, ok := v.(int); ok && value >= 0 && value <= 100 {
+		return value
+	}
+	return defaultValue
+}
+
+// getBoolOrDefault tries to get a boolean from a interface or returns a default value.
+func getBoolOrDefault(v interface{}, defaultValue bool) bool {
+	if value, ok := v.(bool); ok {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,238 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const infoHashIndexFileName = ".cache/at-rss-infohashes.yml"
+
+// infoHashIndexRetention is how long an added torrent is remembered, long after its item left the feed.
+const infoHashIndexRetention = 180 * 24 * time.Hour
+
+// claimRetention is how long a claim outlives the recording of its torrent in the cache and the index, so
+// that fetches that started before still see it.
+const claimRetention = time.Hour
+
+// Scopes of the torrents a task checks new torrents against.
+const (
+	dedupGlobal = "global" // Torrents added by any task, the default
+	dedupTask   = "task"   // Torrents added by the task itself
+	dedupOff    = "off"    // No check; items are still processed once
+)
+
+var (
+	claimedMu sync.Mutex
+	// claimedInfoHashes are the infoHashes being or recently added by the tasks of this process, so that tasks
+	// fetching overlapping feeds at the same time don't both add a torrent
+	claimedInfoHashes = make(map[string]*infoHashClaim)
+)
+
+// infoHashClaim is the reservation of an infoHash by the task adding its torrent.
+type infoHashClaim struct {
+	task     string
+	recorded time.Time // when the torrent was recorded in the cache and the index, zero until then
+}
+
+// parseDedupConfig processes the dedup scope of a task.
+func parseDedupConfig(v interface{}) (string, error) {
+	switch scope := strings.ToLower(convertToString(v)); scope {
+	case dedupGlobal, dedupTask, dedupOff:
+		return scope, nil
+	case "false":
+		return dedupOff, nil
+	default:
+		return "", errors.New("invalid 'dedup': must be global, task or off")
+	}
+}
+
+// InfoHashEntry records which task added a torrent and when.
+type InfoHashEntry struct {
+	Task  string    `yaml:"task"`
+	Added time.Time `yaml:"added"`
+}
+
+// InfoHashIndex persists the infoHashes of the torrents added by all tasks, so that duplicates are
+// recognized after their items expired from the cache.
+type InfoHashIndex struct {
+	filePath string
+}
+
+// NewInfoHashIndex returns an InfoHashIndex stored in the user's cache directory.
+func NewInfoHashIndex() (*InfoHashIndex, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return &InfoHashIndex{filePath: filepath.Join(homeDir, infoHashIndexFileName)}, nil
+}
+
+// Load returns the indexed infoHashes.
+func (x *InfoHashIndex) Load() (map[string]*InfoHashEntry, error) {
+	entries := make(map[string]*InfoHashEntry)
+	if err := loadCache(x.filePath, &entries); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Add records the infoHashes as added by the task and forgets those older than the retention.
+func (x *InfoHashIndex) Add(task string, infoHashes []string) error {
+	unlock, err := lockFile(x.filePath + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := x.Load()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, infoHash := range infoHashes {
+		if _, exists := entries[infoHash]; !exists {
+			entries[infoHash] = &InfoHashEntry{Task: task, Added: now}
+		}
+	}
+	for infoHash, entry := range entries {
+		if now.Sub(entry.Added) > infoHashIndexRetention {
+			delete(entries, infoHash)
+		}
+	}
+	return writeFileAtomic(x.filePath, entries)
+}
+
+// knownInfoHashes returns the infoHashes new torrents of the task are checked against, according to its
+// dedup scope: those in the cache and the index, of every task or of the task only.
+func (t *Task) knownInfoHashes(cache *Cache) map[string]struct{} {
+	switch t.Dedup {
+	case dedupOff:
+		return make(map[string]struct{})
+	case dedupTask:
+		infoHashSet := make(map[string]struct{})
+		for _, key := range t.FeedUrls {
+			for _, infoHashes := range cache.Get(key) {
+				for _, infoHash := range infoHashes {
+					infoHashSet[infoHash] = struct{}{}
+				}
+			}
+		}
+		t.addIndexedInfoHashes(infoHashSet, t.Name)
+		return infoHashSet
+	default:
+		infoHashSet := cache.AllInfoHashes()
+		t.addIndexedInfoHashes(infoHashSet, "")
+		return infoHashSet
+	}
+}
+
+// addIndexedInfoHashes adds the infoHashes of the index to infoHashSet, only those added by task if it isn't empty.
+func (t *Task) addIndexedInfoHashes(infoHashSet map[string]struct{}, task string) {
+	index, err := NewInfoHashIndex()
+	var entries map[string]*InfoHashEntry
+	if err == nil {
+		entries, err = index.Load()
+	}
+	if err != nil {
+		slog.Warn("Failed to load infoHash index", "task", t.Name, "err", err)
+		return
+	}
+	for infoHash, entry := range entries {
+		if task == "" || entry.Task == task {
+			infoHashSet[infoHash] = struct{}{}
+		}
+	}
+}
+
+// recordInfoHashes adds the infoHashes of torrents added by the task to the index.
+func (t *Task) recordInfoHashes(infoHashes []string) {
+	if len(infoHashes) == 0 {
+		return
+	}
+	index, err := NewInfoHashIndex()
+	if err == nil {
+		err = index.Add(t.Name, infoHashes)
+	}
+	if err != nil {
+		slog.Warn("Failed to update infoHash index", "task", t.Name, "err", err)
+	}
+}
+
+// claimInfoHashes reserves the infoHashes of a torrent to be added by the task. It returns false if the task
+// checks torrents added by every task and all the infoHashes were reserved by another task, or by another
+// instance sharing the cache in Redis.
+func (t *Task) claimInfoHashes(infoHashes []string) bool {
+	claimedMu.Lock()
+	defer claimedMu.Unlock()
+	now := time.Now()
+	for infoHash, claim := range claimedInfoHashes {
+		if !claim.recorded.IsZero() && now.Sub(claim.recorded) > claimRetention {
+			delete(claimedInfoHashes, infoHash)
+		}
+	}
+	if t.Dedup == "" || t.Dedup == dedupGlobal {
+		claimed := len(infoHashes) > 0
+		for _, infoHash := range infoHashes {
+			if claim, exists := claimedInfoHashes[infoHash]; !exists || claim.task == t.Name {
+				claimed = false
+			}
+		}
+		if claimed {
+			return false
+		}
+		if t.cache != nil && t.cache.remote != nil {
+			claimed, err := t.cache.remote.claim(claimOwner(t.Name), infoHashes, infoHashIndexRetention)
+			if err != nil {
+				slog.Warn("Failed to claim infoHashes in Redis. May download duplicate files.", "task", t.Name, "err", err)
+			} else if !claimed {
+				return false
+			}
+		}
+	}
+	for _, infoHash := range infoHashes {
+		if _, exists := claimedInfoHashes[infoHash]; !exists {
+			claimedInfoHashes[infoHash] = &infoHashClaim{task: t.Name}
+		}
+	}
+	return true
+}
+
+// settleInfoHashes marks the claims of the task for torrents now recorded in the cache and the index, which
+// are dropped after claimRetention.
+func (t *Task) settleInfoHashes(infoHashes []string) {
+	claimedMu.Lock()
+	defer claimedMu.Unlock()
+	now := time.Now()
+	for _, infoHash := range infoHashes {
+		if claim, exists := claimedInfoHashes[infoHash]; exists && claim.task == t.Name && claim.recorded.IsZero() {
+			claim.recorded = now
+		}
+	}
+}
+
+// releaseInfoHashes drops the reservations of the task for the infoHashes of a torrent that failed to add.
+func (t *Task) releaseInfoHashes(infoHashes []string) {
+	claimedMu.Lock()
+	defer claimedMu.Unlock()
+	for _, infoHash := range infoHashes {
+		if claim, exists := claimedInfoHashes[infoHash]; exists && claim.task == t.Name {
+			delete(claimedInfoHashes, infoHash)
+		}
+	}
+	if t.cache != nil && t.cache.remote != nil {
+		if err := t.cache.remote.release(claimOwner(t.Name), infoHashes); err != nil {
+			slog.Warn("Failed to release infoHashes in Redis", "task", t.Name, "err", err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClaimInfoHashes(t *testing.T) {
+	saved := claimedInfoHashes
+	claimedInfoHashes = make(map[string]*infoHashClaim)
+	t.Cleanup(func() { claimedInfoHashes = saved })
+
+	a, b := &Task{Name: "a"}, &Task{Name: "b"}
+	hash := []string{infoHashOf(1)}
+	if !a.claimInfoHashes(hash) {
+		t.Fatal("claimInfoHashes() = false for an unclaimed torrent")
+	}
+	if b.claimInfoHashes(hash) {
+		t.Error("claimInfoHashes() = true for a torrent being added by another task")
+	}
+	a.settleInfoHashes(hash)
+	if b.claimInfoHashes(hash) {
+		t.Error("claimInfoHashes() = true for a torrent just recorded by another task")
+	}
+	claimedInfoHashes[infoHashOf(1)].recorded = time.Now().Add(-claimRetention - time.Minute)
+	if !b.claimInfoHashes([]string{infoHashOf(2)}) {
+		t.Fatal("claimInfoHashes() = false for an unclaimed torrent")
+	}
+	if _, exists := claimedInfoHashes[infoHashOf(1)]; exists {
+		t.Error("claim kept after the retention")
+	}
+	b.releaseInfoHashes([]string{infoHashOf(2)})
+	if len(claimedInfoHashes) != 0 {
+		t.Errorf("claims = %v after releasing, want none", claimedInfoHashes)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// defaultsKey is the top-level key holding settings inherited by every task. It is not a task.
+const defaultsKey = "defaults"
+
+// serverKeys are the RPC server settings of a task.
+var serverKeys = []string{"aria2c", "transmission", "sonarr", "radarr"}
+
+// exclusiveKeys are groups of settings a task may only use one of. A task setting one of a group
+// inherits none of them.
+var exclusiveKeys = [][]string{{"aria2c", "transmission", "sonarr", "radarr", "downloader", "downloaders", fallbacksKey}, {"interval", "schedule"}}
+
+// applyDefaults removes the defaults section from the config and copies its settings to every task
+// that doesn't set them. Sections such as 'filter' are merged one level deep, so a task may override
+// 'include' and still inherit 'exclude'.
+func applyDefaults(config map[string]interface{}) error {
+	value, exists := config[defaultsKey]
+	if !exists {
+		return nil
+	}
+	delete(config, defaultsKey)
+	defaults, ok := value.(map[string]interface{})
+	if !ok {
+		if value == nil {
+			return nil
+		}
+		return errors.New("invalid 'defaults': must be a map of task settings")
+	}
+
+	for _, value := range config {
+		task, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for key, defaultValue := range defaults {
+			if overridden(task, key) {
+				continue
+			}
+			taskKey, exists := lookupKey(task, key)
+			if !exists {
+				task[key] = defaultValue
+				continue
+			}
+			taskSection, ok := task[taskKey].(map[string]interface{})
+			defaultSection, isSection := defaultValue.(map[string]interface{})
+			if !ok || !isSection {
+				continue
+			}
+			merged := make(map[string]interface{}, len(defaultSection)+len(taskSection))
+			for k, v := range defaultSection {
+				merged[k] = v
+			}
+			for k, v := range taskSection {
+				merged[k] = v
+			}
+			task[taskKey] = merged
+		}
+	}
+	return nil
+}
+
+// lookupKey finds key in the task ignoring case, as task keys are matched case-insensitively.
+func lookupKey(task map[string]interface{}, key string) (string, bool) {
+	for k := range task {
+		if strings.EqualFold(k, key) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// overridden reports whether the task sets another setting of the exclusive group of key.
+func overridden(task map[string]interface{}, key string) bool {
+	for _, group := range exclusiveKeys {
+		inGroup, set := false, false
+		for _, k := range group {
+			if strings.EqualFold(k, key) {
+				inGroup = true
+			} else if _, exists := lookupKey(task, k); exists {
+				set = true
+			}
+		}
+		if inGroup && set {
+			return true
+		}
+	}
+	return false
+}
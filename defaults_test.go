@@ -0,0 +1,88 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyDefaults(t *testing.T) {
+	type section = map[string]interface{}
+	tests := []struct {
+		name           string
+		defaults, task section
+		want           section
+	}{
+		{
+			name:     "inherited",
+			defaults: section{"interval": 10, "aria2c": section{"url": "ws://nas:6800/jsonrpc"}},
+			task:     section{"feed": "http://a/rss"},
+			want:     section{"feed": "http://a/rss", "interval": 10, "aria2c": section{"url": "ws://nas:6800/jsonrpc"}},
+		},
+		{
+			name:     "overridden",
+			defaults: section{"interval": 10, "lenient": true},
+			task:     section{"interval": 30},
+			want:     section{"interval": 30, "lenient": true},
+		},
+		{
+			name:     "sections merged",
+			defaults: section{"filter": section{"include": []interface{}{"1080p"}, "exclude": []interface{}{"cam"}}},
+			task:     section{"Filter": section{"include": []interface{}{"720p"}}},
+			want:     section{"Filter": section{"include": []interface{}{"720p"}, "exclude": []interface{}{"cam"}}},
+		},
+		{
+			name:     "section replaced by a scalar",
+			defaults: section{"quiet": section{"hours": "01:00-07:00"}},
+			task:     section{"quiet": false},
+			want:     section{"quiet": false},
+		},
+		{
+			name:     "other server",
+			defaults: section{"aria2c": nil, "interval": 10},
+			task:     section{"transmission": section{"host": "nas"}},
+			want:     section{"transmission": section{"host": "nas"}, "interval": 10},
+		},
+		{
+			name:     "downloader reference",
+			defaults: section{"downloader": "nas"},
+			task:     section{"sonarr": section{"apiKey": "k"}},
+			want:     section{"sonarr": section{"apiKey": "k"}},
+		},
+		{
+			name:     "schedule",
+			defaults: section{"interval": 10},
+			task:     section{"Schedule": "0 * * * *"},
+			want:     section{"Schedule": "0 * * * *"},
+		},
+	}
+	for _, tt := range tests {
+		config := map[string]interface{}{defaultsKey: tt.defaults, "task": tt.task, "other": "not a task"}
+		if err := applyDefaults(config); err != nil {
+			t.Errorf("%s: applyDefaults() failed: %v", tt.name, err)
+			continue
+		}
+		want := map[string]interface{}{"task": tt.want, "other": "not a task"}
+		if !reflect.DeepEqual(config, want) {
+			t.Errorf("%s: applyDefaults() = %v, want %v", tt.name, config, want)
+		}
+	}
+}
+
+func TestApplyDefaultsInvalid(t *testing.T) {
+	for _, defaults := range []interface{}{nil, "aria2c", []interface{}{"aria2c"}} {
+		config := map[string]interface{}{defaultsKey: defaults, "task": map[string]interface{}{}}
+		err := applyDefaults(config)
+		if (err == nil) != (defaults == nil) {
+			t.Errorf("applyDefaults(%v) = %v", defaults, err)
+		}
+		if _, exists := config[defaultsKey]; exists {
+			t.Errorf("applyDefaults(%v) left the defaults section", defaults)
+		}
+	}
+}
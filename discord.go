@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// discordKeys are the settings of a Discord channel.
+var discordKeys = []string{"url", "urlFile", "url_file", "username"}
+
+// Colors of the embeds of the events, the default one for errors.
+const (
+	discordColorAdded     = 0x2ecc71
+	discordColorCompleted = 0x3498db
+	discordColorError     = 0xe74c3c
+	discordColorApproval  = 0xf1c40f
+)
+
+// discordNotifier posts events to a Discord webhook as rich embeds.
+type discordNotifier struct {
+	url      string // Webhook URL, which embeds its secret token
+	username string // Name the messages are posted under, the name of the webhook if empty
+}
+
+// discordEmbed is an embed of a Discord webhook message.
+type discordEmbed struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description,omitempty"`
+	URL         string              `json:"url,omitempty"`
+	Color       int                 `json:"color"`
+	Fields      []discordEmbedField `json:"fields,omitempty"`
+	Timestamp   string              `json:"timestamp"`
+}
+
+// discordEmbedField is a field of an embed.
+type discordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// newDiscordNotifier creates a Discord channel from its settings: the webhook URL and an optional username.
+func newDiscordNotifier(settings map[string]interface{}) (Notifier, error) {
+	if err := checkNotifierSettings("discord", settings, discordKeys, "url"); err != nil {
+		return nil, err
+	}
+	webhook, err := getSecret(settings, "url")
+	if err != nil {
+		return nil, err
+	}
+	if u, err := url.Parse(webhook); err != nil || u.Host == "" {
+		return nil, errors.New("invalid 'url' in discord: must be a webhook URL")
+	}
+	return &discordNotifier{url: webhook, username: convertToString(settings["username"])}, nil
+}
+
+// Notify posts the event as an embed.
+func (n *discordNotifier) Notify(ctx context.Context, e *Event) error {
+	embed := discordEmbed{Title: truncate(e.Subject(), 256), Color: discordColorError, Timestamp: e.Time.Format(time.RFC3339)}
+	fields := [][2]string{{"Task", e.Task}}
+	switch e.Type {
+	case eventAdded, eventCompleted:
+		embed.Color = discordColorAdded
+		if e.Type == eventCompleted {
+			embed.Color = discordColorCompleted
+		}
+		if strings.HasPrefix(e.Torrent.URL, "http") {
+			embed.URL = e.Torrent.URL
+		}
+		if e.Torrent.Size > 0 {
+			fields = append(fields, [2]string{"Size", formatSize(e.Torrent.Size)})
+		}
+		fields = append(fields, [2]string{"Downloader", e.Torrent.Downloader})
+		if e.Torrent.Name != "" {
+			fields = append(fields, [2]string{"Torrent", e.Torrent.Name})
+		}
+		embed.Description = e.Torrent.Reason
+	case eventApproval:
+		embed.Color = discordColorApproval
+		embed.Description = "Decide with 'at-rss approve' or 'at-rss reject'"
+	default:
+		embed.Description = truncate(e.Error, 4096)
+	}
+	for _, field := range fields {
+		embed.Fields = append(embed.Fields, discordEmbedField{Name: field[0], Value: truncate(field[1], 1024), Inline: true})
+	}
+
+	body := map[string]interface{}{"embeds": []discordEmbed{embed}}
+	if n.username != "" {
+		body["username"] = n.username
+	}
+	if err := postJSON(ctx, n.url, body, nil); err != nil {
+		// The webhook token is part of the URL quoted by connection errors
+		return errors.New(strings.ReplaceAll(err.Error(), n.url, redactWebhook(n.url)))
+	}
+	return nil
+}
+
+// redactWebhook returns the webhook URL without its path, which holds the token.
+func redactWebhook(webhook string) string {
+	u, err := url.Parse(webhook)
+	if err != nil {
+		return "<webhook>"
+	}
+	return u.Scheme + "://" + u.Host + "/..."
+}
+
+// truncate shortens text to at most n runes, as limited by some providers.
+func truncate(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n-1]) + "…"
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// downloadersKey is the top-level key holding named RPC server definitions. It is not a task.
+const downloadersKey = "downloaders"
+
+// fallbacksKey is the task setting listing the RPC servers tried in turn when the server of the task fails.
+// References to several downloaders resolve to it.
+const fallbacksKey = "fallbacks"
+
+// resolveDownloaders removes the downloaders section from the config and replaces the 'downloader' (or
+// 'downloaders') reference of every task with the RPC server definitions it names. The first one becomes
+// the server of the task, the others its fallbacks.
+func resolveDownloaders(config map[string]interface{}) error {
+	definitions := make(map[string]interface{})
+	if value, exists := config[downloadersKey]; exists {
+		delete(config, downloadersKey)
+		if value != nil {
+			var ok bool
+			if definitions, ok = value.(map[string]interface{}); !ok {
+				return errors.New("invalid 'downloaders': must be a map of names to RPC servers")
+			}
+		}
+	}
+
+	for name, value := range config {
+		task, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var keys []string
+		for _, refKey := range []string{"downloader", "downloaders"} {
+			if key, exists := lookupKey(task, refKey); exists {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		if len(keys) > 1 {
+			return fmt.Errorf("task '%s': both downloader and downloaders specified; only one allowed", name)
+		}
+		key := keys[0]
+		refs, err := parseDownloaderRefs(task[key])
+		if err != nil {
+			return fmt.Errorf("task '%s': invalid '%s': %w", name, key, err)
+		}
+		for _, serverKey := range slices.Concat(serverKeys, []string{fallbacksKey}) {
+			if _, exists := lookupKey(task, serverKey); exists {
+				return fmt.Errorf("task '%s': both %s and %s specified; only one allowed", name, key, serverKey)
+			}
+		}
+		var fallbacks []interface{}
+		for i, ref := range refs {
+			server, err := downloaderServer(definitions, ref)
+			if err != nil {
+				return fmt.Errorf("task '%s': %w", name, err)
+			}
+			if i == 0 {
+				maps.Copy(task, server)
+			} else {
+				fallbacks = append(fallbacks, server)
+			}
+		}
+		if len(fallbacks) > 0 {
+			task[fallbacksKey] = fallbacks
+		}
+		delete(task, key)
+	}
+	return nil
+}
+
+// parseDownloaderRefs processes a downloader name or a list of names, tried in that order.
+func parseDownloaderRefs(v interface{}) ([]string, error) {
+	var refs []string
+	switch v := v.(type) {
+	case string:
+		refs = []string{v}
+	case []interface{}:
+		for _, ref := range v {
+			refs = append(refs, convertToString(ref))
+		}
+	default:
+		return nil, errors.New("must be a name or a list of names")
+	}
+	if len(refs) == 0 {
+		return nil, errors.New("empty list")
+	}
+	for _, ref := range refs {
+		if ref == "" {
+			return nil, errors.New("empty name")
+		}
+	}
+	return refs, nil
+}
+
+// downloaderServer returns the server section of the downloader named ref, e.g. {aria2c: {url: ...}}.
+func downloaderServer(definitions map[string]interface{}, ref string) (map[string]interface{}, error) {
+	definition, ok := definitions[ref].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unknown downloader '%s'", ref)
+	}
+	server := make(map[string]interface{})
+	for _, serverKey := range serverKeys {
+		if defKey, exists := lookupKey(definition, serverKey); exists {
+			server[serverKey] = definition[defKey]
+		}
+	}
+	if len(server) != 1 {
+		return nil, fmt.Errorf("downloader '%s' must define one of %s", ref, strings.Join(serverKeys, ", "))
+	}
+	return server, nil
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// downloadsFileName holds the torrents added by the tasks that are still downloading, by infoHash.
+const downloadsFileName = ".cache/at-rss-downloads.yml"
+
+// downloadWatchExpiry is how long a torrent is watched, e.g. when it was removed from the downloader unfinished.
+const downloadWatchExpiry = 30 * 24 * time.Hour
+
+// DownloadWatch persists the torrents the tasks wait for to finish downloading, to notify their completion
+// across restarts of the daemon.
+type DownloadWatch struct {
+	filePath string
+}
+
+// NewDownloadWatch returns a DownloadWatch stored in the user's cache directory.
+func NewDownloadWatch() (*DownloadWatch, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return &DownloadWatch{filePath: filepath.Join(homeDir, downloadsFileName)}, nil
+}
+
+// Load returns the watched torrents, by their first infoHash.
+func (w *DownloadWatch) Load() (map[string]*HistoryEntry, error) {
+	downloads := make(map[string]*HistoryEntry)
+	if err := loadCache(w.filePath, &downloads); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return downloads, nil
+}
+
+// Update loads the watched torrents, lets fn modify them and saves the result, holding a lock on the file meanwhile.
+func (w *DownloadWatch) Update(fn func(downloads map[string]*HistoryEntry)) error {
+	unlock, err := lockFile(w.filePath + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	downloads, err := w.Load()
+	if err != nil {
+		return err
+	}
+	fn(downloads)
+	return writeFileAtomic(w.filePath, downloads)
+}
+
+// watchDownloads watches the torrents added by the task until they finish downloading. Torrents are only
+// watched by tasks notifying their completion.
+func (t *Task) watchDownloads(entries []*HistoryEntry) {
+	// Sonarr and Radarr track the downloads they import
+	if len(t.Notifiers) == 0 || !t.Notify.notifies(eventCompleted) || isArr(t.ServerConfig.RpcType) || len(entries) == 0 {
+		return
+	}
+	watch, err := NewDownloadWatch()
+	if err == nil {
+		err = watch.Update(func(downloads map[string]*HistoryEntry) {
+			for _, entry := range entries {
+				if len(entry.InfoHashes) > 0 {
+					downloads[entry.InfoHashes[0]] = entry
+				}
+			}
+		})
+	}
+	if err != nil {
+		rpcLog.Warn("Failed to record downloads to watch", "task", t.Name, "err", err)
+	}
+}
+
+// checkDownloads asks the downloader which torrents watched by the task finished and notifies their
+// completion. It creates an RPC client if client is nil and the task has torrents to check.
+func (t *Task) checkDownloads(client RpcClient) {
+	watch, err := NewDownloadWatch()
+	if err != nil {
+		return
+	}
+	downloads, err := watch.Load()
+	if err != nil {
+		rpcLog.Warn("Failed to read watched downloads", "task", t.Name, "err", err)
+		return
+	}
+	var infoHashes []string
+	for _, entry := range downloads {
+		if entry.Task == t.Name {
+			infoHashes = append(infoHashes, entry.InfoHashes...)
+		}
+	}
+	if len(infoHashes) == 0 {
+		return
+	}
+	if client == nil {
+		if client, err = t.createRpcClient(); err != nil {
+			rpcLog.Warn("Failed to create RPC client", "rpcType", t.ServerConfig.RpcType, "err", err)
+			return
+		}
+		defer client.CloseRpc()
+	}
+	finished, err := client.Completed(infoHashes)
+	if err != nil {
+		rpcLog.Warn("Failed to check downloads", "task", t.Name, "err", err)
+		return
+	}
+	done := make(map[string]struct{}, len(finished))
+	for _, infoHash := range finished {
+		done[infoHash] = struct{}{}
+	}
+
+	var completed []*HistoryEntry
+	now := time.Now()
+	err = watch.Update(func(downloads map[string]*HistoryEntry) {
+		for key, entry := range downloads {
+			if entry.Task != t.Name {
+				continue
+			}
+			for _, infoHash := range entry.InfoHashes {
+				if _, exists := done[infoHash]; exists {
+					completed = append(completed, entry)
+					delete(downloads, key)
+					break
+				}
+			}
+			if now.Sub(entry.Time) > downloadWatchExpiry {
+				delete(downloads, key)
+			}
+		}
+	})
+	if err != nil {
+		rpcLog.Warn("Failed to update watched downloads", "task", t.Name, "err", err)
+		return
+	}
+	for _, entry := range completed {
+		rpcLog.Info("Download completed", "task", t.Name, "title", entry.Title)
+		t.notify(&Event{Type: eventCompleted, Torrent: entry})
+	}
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const episodeFileName = ".cache/at-rss-episodes.yml"
+
+// episodeRetention is how long a grabbed episode is remembered, long after its item left the feed.
+const episodeRetention = 180 * 24 * time.Hour
+
+// episodeCacheKeyPrefix prefixes the cache key the episodes grabbed by a task were kept under before the
+// episode store, keyed by series and episode.
+const episodeCacheKeyPrefix = "episodes/"
+
+// Episode numbers in titles, most specific first. Each pattern has the season, if any, and the episode
+// as its last two groups.
+var episodePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\bS(\d{1,2})\s?E(\d{1,4})(?:v\d)?\b`),
+	regexp.MustCompile(`第()\s*(\d{1,4})\s*[话話集]`),
+	regexp.MustCompile(`(?i)\b(?:EP?|Episode)()\s?(\d{1,4})(?:v\d)?\b`),
+	// Absolute numbering of fansub releases, e.g. "Show - 05v2" or "[Show][05]"
+	regexp.MustCompile(`(?:\s-\s|\[|【)()(\d{1,4})(?:v\d)?(?:\s|\]|】|$)`),
+}
+
+// rangeEnd matches the end of an episode range following an episode number, e.g. "-12" in "EP01-12" or
+// "-S01E12" in "S01E01-S01E12".
+var rangeEnd = regexp.MustCompile(`(?i)^\s*[-~]\s*(?:S\d{1,2})?(?:EP?)?\d{1,4}(?:v\d)?\b`)
+
+// leadingGroup matches a bracketed release group or tag at the start of a title.
+var leadingGroup = regexp.MustCompile(`^\s*(?:\[[^\]]*\]|【[^】]*】)\s*`)
+
+// parseEpisode returns the series and episode of a title as a key such as "show|S1E5" or "show|E5",
+// or "" if the title has no episode number or is a batch of several episodes. Proper, repack and v2 releases
+// give the same key as the original.
+func parseEpisode(title string) string {
+	for _, pattern := range episodePatterns {
+		for _, m := range pattern.FindAllStringSubmatchIndex(title, -1) {
+			episode, _ := strconv.Atoi(title[m[4]:m[5]])
+			if m[2] == m[3] && episode >= 1900 && episode < 2100 {
+				continue // A year rather than an absolute episode number
+			}
+			if rangeEnd.MatchString(title[m[1]:]) {
+				return ""
+			}
+			key := fmt.Sprintf("E%d", episode)
+			if m[2] != m[3] {
+				season, _ := strconv.Atoi(title[m[2]:m[3]])
+				key = fmt.Sprintf("S%dE%d", season, episode)
+			}
+			return seriesName(title[:m[0]]) + "|" + key
+		}
+	}
+	return ""
+}
+
+// seriesName normalizes the part of a title before the episode number. Leading release groups are dropped
+// unless nothing else is left, e.g. in "[Group][Show][05]".
+func seriesName(prefix string) string {
+	for {
+		loc := leadingGroup.FindStringIndex(prefix)
+		if loc == nil || normalizeReleaseName(prefix[loc[1]:]) == "" {
+			break
+		}
+		prefix = prefix[loc[1]:]
+	}
+	return normalizeReleaseName(strings.TrimSpace(prefix))
+}
+
+// episodeCacheKey returns the cache key of the episodes grabbed by the task before the episode store.
+func (t *Task) episodeCacheKey() string {
+	return episodeCacheKeyPrefix + t.Name
+}
+
+// EpisodeEntry records when an episode was first grabbed and the infoHashes of its torrent.
+type EpisodeEntry struct {
+	Grabbed    time.Time `yaml:"grabbed"`
+	InfoHashes []string  `yaml:"infoHashes,omitempty"`
+}
+
+// EpisodeStore persists the episodes grabbed by tasks per task name and episode key.
+type EpisodeStore struct {
+	filePath string
+}
+
+// NewEpisodeStore returns an EpisodeStore stored in the user's cache directory.
+func NewEpisodeStore() (*EpisodeStore, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return &EpisodeStore{filePath: filepath.Join(homeDir, episodeFileName)}, nil
+}
+
+// Load returns the grabbed episodes.
+func (s *EpisodeStore) Load() (map[string]map[string]*EpisodeEntry, error) {
+	episodes := make(map[string]map[string]*EpisodeEntry)
+	if err := loadCache(s.filePath, &episodes); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return episodes, nil
+}
+
+// Add records episodes grabbed by the task, keeping the first grab of an episode, and forgets those older
+// than the retention.
+func (s *EpisodeStore) Add(task string, episodes map[string]*EpisodeEntry) error {
+	unlock, err := lockFile(s.filePath + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	all, err := s.Load()
+	if err != nil {
+		return err
+	}
+	if all[task] == nil {
+		all[task] = make(map[string]*EpisodeEntry)
+	}
+	for episode, entry := range episodes {
+		if _, exists := all[task][episode]; !exists {
+			all[task][episode] = entry
+		}
+	}
+	now := time.Now()
+	for name, entries := range all {
+		for episode, entry := range entries {
+			if now.Sub(entry.Grabbed) > episodeRetention {
+				delete(entries, episode)
+			}
+		}
+		if len(entries) == 0 {
+			delete(all, name)
+		}
+	}
+	return writeFileAtomic(s.filePath, all)
+}
+
+// loadEpisodes returns the episodes grabbed by the task. Episodes still kept in the cache are moved to the
+// episode store first.
+func (t *Task) loadEpisodes(cache *Cache) map[string]*EpisodeEntry {
+	store, err := NewEpisodeStore()
+	if err != nil {
+		slog.Warn("Failed to load grabbed episodes", "task", t.Name, "err", err)
+		return make(map[string]*EpisodeEntry)
+	}
+	if legacy := cache.Get(t.episodeCacheKey()); len(legacy) > 0 {
+		imported := make(map[string]*EpisodeEntry, len(legacy))
+		now := time.Now()
+		for episode, infoHashes := range legacy {
+			imported[episode] = &EpisodeEntry{Grabbed: now, InfoHashes: infoHashes}
+		}
+		if err := store.Add(t.Name, imported); err != nil {
+			slog.Warn("Failed to move grabbed episodes out of the cache", "task", t.Name, "err", err)
+		} else {
+			cache.Delete(t.episodeCacheKey())
+		}
+	}
+	all, err := store.Load()
+	if err != nil {
+		slog.Warn("Failed to load grabbed episodes", "task", t.Name, "err", err)
+	}
+	if all[t.Name] == nil {
+		return make(map[string]*EpisodeEntry)
+	}
+	return all[t.Name]
+}
+
+// recordEpisodes adds the episodes grabbed by the task to the episode store.
+func (t *Task) recordEpisodes(episodes map[string]*EpisodeEntry) {
+	if len(episodes) == 0 {
+		return
+	}
+	store, err := NewEpisodeStore()
+	if err == nil {
+		err = store.Add(t.Name, episodes)
+	}
+	if err != nil {
+		slog.Warn("Failed to record grabbed episodes", "task", t.Name, "err", err)
+	}
+}
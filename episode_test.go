@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseEpisode(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Show S01E05 1080p WEB-DL", "show|S1E5"},
+		{"Show.s1e05v2.1080p", "show|S1E5"},
+		{"Show S01E05 PROPER", "show|S1E5"},
+		{"Show S2 E12", "show|S2E12"},
+		{"[Group] Show - 05 [1080p]", "show|E5"},
+		{"[Group] Show - 05v2 [1080p]", "show|E5"},
+		{"[Group][Show][05][1080p]", "show|E5"},
+		{"[Group] Show - 1024 [1080p]", "show|E1024"},
+		{"【Group】Show 第5话 简体", "show|E5"},
+		{"Show 第 12 集", "show|E12"},
+		{"Show 第05話", "show|E5"},
+		{"Show EP05", "show|E5"},
+		{"Show Episode 12", "show|E12"},
+		{"[Group] Other Show - 05 [1080p]", "othershow|E5"},
+		{"[Group] Show - 05 (2023)", "show|E5"},
+		// Years are not absolute episode numbers
+		{"Show (2023) - 05", "show2023|E5"},
+		{"Show - 1999", ""},
+		{"Movie 2023 1080p", ""},
+		// Batches of several episodes
+		{"[Group] Show - 01-12 [Batch]", ""},
+		{"[Group] Show [01-12][1080p]", ""},
+		{"[Group] Show [01~12]", ""},
+		{"Show 第01-12话", ""},
+		{"show ep01-12", ""},
+		{"show - 01 ~ 12", ""},
+		{"show s01e01-02", ""},
+		{"show S01E01-S01E12", ""},
+		{"show E01-E12", ""},
+		{"Show S01E05 - 1080p", "show|S1E5"},
+		{"[Group] Show - 05 - Title [1080p]", "show|E5"},
+		{"Show S01 Complete", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := parseEpisode(tt.title); got != tt.want {
+			t.Errorf("parseEpisode(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestEpisodeStore(t *testing.T) {
+	isolateHome(t)
+	task := &Task{Name: "task"}
+	cache := &Cache{data: map[string]map[string][]string{task.episodeCacheKey(): {"show|E1": {infoHashOf(1)}}}}
+	if episodes := task.loadEpisodes(cache); episodes["show|E1"] == nil {
+		t.Errorf("loadEpisodes() = %v, want the episode kept in the cache", episodes)
+	}
+	if _, exists := cache.data[task.episodeCacheKey()]; exists {
+		t.Error("episodes left in the cache after moving them to the episode store")
+	}
+
+	store, err := NewEpisodeStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Add("task", map[string]*EpisodeEntry{
+		"show|E1": {Grabbed: time.Now(), InfoHashes: []string{infoHashOf(2)}},
+		"show|E2": {Grabbed: time.Now().Add(-episodeRetention - time.Hour)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	episodes := task.loadEpisodes(cache)
+	if entry := episodes["show|E1"]; entry == nil || !reflect.DeepEqual(entry.InfoHashes, []string{infoHashOf(1)}) {
+		t.Errorf("episode show|E1 = %+v, want the first grab kept", entry)
+	}
+	if entry, exists := episodes["show|E2"]; exists {
+		t.Errorf("episode show|E2 = %+v, want it forgotten after the retention", entry)
+	}
+}
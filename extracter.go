@@ -0,0 +1,205 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/mmcdole/gofeed"
+	"golang.org/x/net/html"
+)
+
+// autoExtracter is the extracter looking for a magnet link or an infoHash in the title, link, description and
+// enclosures of an item, in that order.
+const autoExtracter = "auto"
+
+var (
+	magnetPattern = regexp.MustCompile(`magnet:\?[^\s"'<>]+`)
+	hashPattern   = regexp.MustCompile(`(?i)\b([0-9a-f]{40})\b|btih:([a-z2-7]{32})\b`)
+)
+
+// hashGroup is the name of the capture group holding the infoHash in an extracter pattern without template.
+// Patterns without such a group use their first group.
+const hashGroup = "hash"
+
+// Extracter finds the torrent of an item with a pattern applied to one of its tags. Without template the
+// pattern captures an infoHash a magnet link is built from; with a template the named groups of the pattern
+// fill in the URL to download, a magnet link or the URL of a .torrent file.
+// With a selector, the tag is parsed as HTML and the pattern applies to the selected attributes or texts;
+// without pattern, they are the URLs to download.
+type Extracter struct {
+	Tag      string
+	Selector string // CSS selector, optionally followed by /@attr
+	Pattern  string
+	Template string
+	sel      cascadia.Selector
+	attr     string // Attribute of the selected elements, "" for their text
+	r        *regexp.Regexp
+	t        *template.Template
+}
+
+// parseSelector splits a selector such as "a[href^='magnet:']/@href" into the compiled CSS selector and the
+// attribute whose value is taken, "" for the text of the elements.
+func parseSelector(s string) (cascadia.Selector, string, error) {
+	css, attr := s, ""
+	if i := strings.LastIndex(s, "/@"); i >= 0 {
+		css, attr = s[:i], s[i+2:]
+		if attr == "" {
+			return nil, "", errors.New("invalid 'selector' in extracter: missing attribute after /@")
+		}
+	}
+	sel, err := cascadia.Compile(css)
+	if err != nil {
+		return nil, "", errors.New("invalid 'selector' in extracter: " + err.Error())
+	}
+	return sel, attr, nil
+}
+
+// values returns the values of the item the extracter applies to: those of its tag or, with a selector,
+// the attributes or texts of the elements selected in them.
+func (e *Extracter) values(item *gofeed.Item) []string {
+	if e.Tag == autoExtracter {
+		var values []string
+		for _, tag := range []string{"title", "link", "description", "enclosure"} {
+			values = append(values, getTagValue(item, tag)...)
+		}
+		return values
+	}
+	values := getTagValue(item, e.Tag)
+	if e.sel == nil {
+		return values
+	}
+	var selected []string
+	for _, value := range values {
+		doc, err := html.Parse(strings.NewReader(value))
+		if err != nil {
+			continue
+		}
+		for _, n := range e.sel.MatchAll(doc) {
+			if e.attr == "" {
+				selected = append(selected, strings.TrimSpace(nodeText(n)))
+				continue
+			}
+			for _, a := range n.Attr {
+				if a.Key == e.attr {
+					selected = append(selected, strings.TrimSpace(a.Val))
+				}
+			}
+		}
+	}
+	return selected
+}
+
+// nodeText returns the text content of an HTML node.
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(nodeText(c))
+	}
+	return b.String()
+}
+
+// parseExtracterTemplate compiles the template of an extracter, which may refer to the named groups of
+// pattern r and to the title of the item as {{.title}}.
+func parseExtracterTemplate(text string, r *regexp.Regexp) (*template.Template, error) {
+	t, err := template.New("extracter").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, errors.New("invalid 'template' in extracter: " + err.Error())
+	}
+	// Execute on empty captures to report references to groups the pattern doesn't have
+	if err := t.Execute(&strings.Builder{}, extracterData(r, make([]string, r.NumSubexp()+1), "")); err != nil {
+		return nil, errors.New("invalid 'template' in extracter: " + err.Error())
+	}
+	return t, nil
+}
+
+// extracterData returns the values a template is executed with: the named groups of the match and the title.
+func extracterData(r *regexp.Regexp, match []string, title string) map[string]string {
+	data := map[string]string{"title": title}
+	for i, name := range r.SubexpNames() {
+		if name != "" {
+			data[name] = match[i]
+		}
+	}
+	return data
+}
+
+// extract applies the extracter to a value of its tag. It returns nil if the pattern doesn't match.
+func (f *Feed) extract(e *Extracter, value, title string) (*TorrentInfo, error) {
+	if e.Tag == autoExtracter {
+		return f.extractAuto(value, title), nil
+	}
+	if e.r == nil {
+		if value == "" {
+			return nil, nil
+		}
+		return f.torrentFromURL(value), nil
+	}
+	match := e.r.FindStringSubmatch(value)
+	if match == nil {
+		return nil, nil
+	}
+	if e.t == nil {
+		group := e.r.SubexpIndex(hashGroup)
+		if group < 0 {
+			group = 1
+		}
+		infoHash, err := regulateInfoHash(match[group])
+		if err != nil {
+			return nil, errors.New("matched infoHash not valid: " + err.Error())
+		}
+		return &TorrentInfo{URL: buildMagnet(infoHash, f.displayName(infoHash, title)), InfoHashes: []string{infoHash}}, nil
+	}
+
+	var b strings.Builder
+	if err := e.t.Execute(&b, extracterData(e.r, match, title)); err != nil {
+		return nil, err
+	}
+	return f.torrentFromURL(strings.TrimSpace(b.String())), nil
+}
+
+// extractAuto returns the torrent of the first valid magnet link in value or, failing that, of the first
+// infoHash. It returns nil if there is none.
+func (f *Feed) extractAuto(value, title string) *TorrentInfo {
+	for _, magnet := range magnetPattern.FindAllString(value, -1) {
+		if infoHashes, err := parseMagnetURI(magnet); err == nil && len(infoHashes) > 0 {
+			return &TorrentInfo{URL: magnet, InfoHashes: infoHashes}
+		}
+	}
+	for _, match := range hashPattern.FindAllStringSubmatch(value, -1) {
+		if infoHash, err := regulateInfoHash(match[1] + strings.ToUpper(match[2])); err == nil {
+			return &TorrentInfo{URL: buildMagnet(infoHash, f.displayName(infoHash, title)), InfoHashes: []string{infoHash}}
+		}
+	}
+	return nil
+}
+
+// displayName returns the name of the magnet link constructed for the infoHash: the name of the torrent if
+// its torrent file was downloaded or archived before, the item title otherwise.
+func (f *Feed) displayName(infoHash, title string) string {
+	if name := torrentName(infoHash, f.Archive); name != "" {
+		return name
+	}
+	return title
+}
+
+// torrentFromURL returns the torrent of a magnet link or .torrent URL. As for enclosures, the infoHashes of
+// a .torrent URL are only known if it can be downloaded.
+func (f *Feed) torrentFromURL(torrentURL string) *TorrentInfo {
+	infoHashes, err := parseMagnetURI(torrentURL)
+	if err != nil {
+		infoHashes, _ = parseTorrentURIWithTimeout(f.ctx, f.hosts, torrentURL, f.Archive)
+	}
+	return &TorrentInfo{URL: torrentURL, InfoHashes: infoHashes}
+}
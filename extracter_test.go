@@ -0,0 +1,213 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/mmcdole/gofeed"
+)
+
+func TestExtractAuto(t *testing.T) {
+	isolateHome(t)
+	const infoHash = "0123456789abcdef0123456789abcdef01234567"
+	f := &Feed{ParserConfig: &ParserConfig{}}
+	tests := []struct {
+		name  string
+		value string
+		want  *TorrentInfo
+	}{
+		{"nothing", "[Group] Show - 01 [1080p]", nil},
+		{
+			"magnet",
+			`<a href="magnet:?xt=urn:btih:` + infoHash + `&dn=Show">link</a>`,
+			&TorrentInfo{URL: "magnet:?xt=urn:btih:" + infoHash + "&dn=Show", InfoHashes: []string{infoHash}},
+		},
+		{
+			"magnet before hash",
+			"fedcba9876543210fedcba9876543210fedcba98 magnet:?xt=urn:btih:" + infoHash,
+			&TorrentInfo{URL: "magnet:?xt=urn:btih:" + infoHash, InfoHashes: []string{infoHash}},
+		},
+		{
+			"invalid magnet skipped",
+			"magnet:?xt=urn:btih:1234 Hash: " + infoHash,
+			&TorrentInfo{URL: "magnet:?xt=urn:btih:" + infoHash + "&dn=Show+01", InfoHashes: []string{infoHash}},
+		},
+		{
+			"hex hash",
+			"Hash: 0123456789ABCDEF0123456789ABCDEF01234567",
+			&TorrentInfo{URL: "magnet:?xt=urn:btih:" + infoHash + "&dn=Show+01", InfoHashes: []string{infoHash}},
+		},
+		{
+			"base32 hash",
+			"btih:aeruKZ4JVPG66AJDIVTYTK6N54ASGRLH",
+			&TorrentInfo{URL: "magnet:?xt=urn:btih:" + infoHash + "&dn=Show+01", InfoHashes: []string{infoHash}},
+		},
+		{"hash within a longer hex string", "x" + infoHash + "ff", nil},
+		{"base32 without btih", "AERUKZ4JVPG66AJDIVTYTK6N54ASGRLH", nil},
+	}
+	for _, tt := range tests {
+		if got := f.extractAuto(tt.value, "Show 01"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: extractAuto(%q) = %+v, want %+v", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRegulateInfoHash(t *testing.T) {
+	const infoHash = "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		s    string
+		want string // "" if invalid
+	}{
+		{infoHash, infoHash},
+		{"0123456789ABCDEF0123456789ABCDEF01234567", infoHash},
+		{"AERUKZ4JVPG66AJDIVTYTK6N54ASGRLH", infoHash},
+		{"0123456789abcdef0123456789abcdef0123456", ""},
+		{"g123456789abcdef0123456789abcdef01234567", ""},
+		{"AERUKZ4JVPG66AJDIVTYTK6N54ASGRL1", ""},
+	}
+	for _, tt := range tests {
+		got, err := regulateInfoHash(tt.s)
+		if (err != nil) != (tt.want == "") || got != tt.want {
+			t.Errorf("regulateInfoHash(%q) = %q, %v, want %q", tt.s, got, err, tt.want)
+		}
+	}
+}
+
+// torrentFile returns a torrent file of a single file and its infoHash.
+func torrentFile(t *testing.T, name string) ([]byte, string) {
+	t.Helper()
+	infoBytes, err := bencode.Marshal(metainfo.Info{Name: name, PieceLength: 1 << 14, Pieces: make([]byte, 20), Length: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi := metainfo.MetaInfo{InfoBytes: infoBytes}
+	var b bytes.Buffer
+	if err := mi.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes(), mi.HashInfoBytes().HexString()
+}
+
+func TestParseExtracter(t *testing.T) {
+	type section = map[string]interface{}
+	tests := []struct {
+		name    string
+		v       interface{}
+		wantErr bool
+	}{
+		{"first group", section{"tag": "link", "pattern": `btih:(\w+)`}, false},
+		{"hash group", section{"tag": "link", "pattern": `(?P<id>\d+)-(?P<hash>\w+)`}, false},
+		{"template", section{"tag": "link", "pattern": `id=(?P<id>\d+)`, "template": "https://tracker/download/{{.id}}.torrent"}, false},
+		{"template with the title", section{"tag": "link", "pattern": `btih:(?P<hash>\w+)`, "template": "magnet:?xt=urn:btih:{{.hash}}&dn={{.title}}"}, false},
+		{"template with a missing group", section{"tag": "link", "pattern": `id=(?P<id>\d+)`, "template": "https://tracker/download/{{.hash}}.torrent"}, true},
+		{"template with an unnamed group", section{"tag": "link", "pattern": `id=(\d+)`, "template": "https://tracker/download/{{.id}}.torrent"}, true},
+		{"invalid template", section{"tag": "link", "pattern": `id=(?P<id>\d+)`, "template": "{{.id"}, true},
+		{"empty template", section{"tag": "link", "pattern": `id=(?P<id>\d+)`, "template": ""}, true},
+		{"no group", section{"tag": "link", "pattern": `\d+`}, true},
+		{"invalid pattern", section{"tag": "link", "pattern": `(\d+`}, true},
+		{"invalid tag", section{"tag": "author", "pattern": `(\d+)`}, true},
+	}
+	for _, tt := range tests {
+		if _, err := parseExtracter(tt.v); (err != nil) != tt.wantErr {
+			t.Errorf("%s: parseExtracter() = %v, want an error: %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestExtractTemplate(t *testing.T) {
+	isolateHome(t)
+	torrent, infoHash := torrentFile(t, "Show 01")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/download/42.torrent" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(torrent)
+	}))
+	defer server.Close()
+
+	f := &Feed{ParserConfig: &ParserConfig{}, ctx: context.Background()}
+	tests := []struct {
+		name     string
+		template string
+		value    string
+		want     *TorrentInfo
+	}{
+		{
+			"torrent file",
+			"{{.site}}/download/{{.id}}.torrent",
+			server.URL + "/view/42",
+			&TorrentInfo{URL: server.URL + "/download/42.torrent", InfoHashes: []string{infoHash}},
+		},
+		{
+			"torrent file failing to download",
+			"{{.site}}/download/{{.id}}.torrent",
+			server.URL + "/view/43",
+			&TorrentInfo{URL: server.URL + "/download/43.torrent"},
+		},
+		{"no match", "{{.site}}/download/{{.id}}.torrent", "http://tracker/about", nil},
+		{
+			"magnet",
+			"magnet:?xt=urn:btih:" + infoHash + "&dn={{.title}}",
+			server.URL + "/view/42",
+			&TorrentInfo{URL: "magnet:?xt=urn:btih:" + infoHash + "&dn=Show", InfoHashes: []string{infoHash}},
+		},
+	}
+	for _, tt := range tests {
+		e, err := parseExtracter(map[string]interface{}{"tag": "link", "pattern": `^(?P<site>https?://[^/]+)/view/(?P<id>\d+)$`, "template": tt.template})
+		if err != nil {
+			t.Fatalf("%s: parseExtracter() failed: %v", tt.name, err)
+		}
+		got, err := f.extract(e, tt.value, "Show")
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: extract(%q) = %+v, %v, want %+v", tt.name, tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestExtracterSelector(t *testing.T) {
+	const description = `<p>Show 01 <a class="dl" href="magnet:?xt=urn:btih:1">Magnet</a></p>` +
+		`<p><a href="/view/1">View</a> <a class="dl" href=" https://tracker/1.torrent ">Torrent</a></p>`
+	item := &gofeed.Item{Title: "Show 01", Description: description}
+	tests := []struct {
+		selector string
+		want     []string // nil if the selector is invalid
+	}{
+		{"a.dl/@href", []string{"magnet:?xt=urn:btih:1", "https://tracker/1.torrent"}},
+		{"a[href^='magnet:']/@href", []string{"magnet:?xt=urn:btih:1"}},
+		{"a.dl", []string{"Magnet", "Torrent"}},
+		{"p:first-child", []string{"Show 01 Magnet"}},
+		{"a/@title", []string{}},
+		{"img/@src", []string{}},
+		{"a.dl/@", nil},
+		{"a[href", nil},
+	}
+	for _, tt := range tests {
+		e, err := parseExtracter(map[string]interface{}{"tag": "description", "selector": tt.selector})
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("parseExtracter() with selector %q succeeded, want an error", tt.selector)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseExtracter() with selector %q failed: %v", tt.selector, err)
+			continue
+		}
+		if got := e.values(item); len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("values() with selector %q = %q, want %q", tt.selector, got, tt.want)
+		}
+	}
+}
@@ -7,21 +7,25 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/base32"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"html"
-	"log/slog"
+	"io"
+	"math"
 	"net/http"
 	"net/url"
-	"regexp"
 	"strings"
 	"time"
 
 	"github.com/anacrolix/torrent/metainfo"
-	"github.com/liuzl/gocc"
+	"github.com/expr-lang/expr/vm"
 	"github.com/mmcdole/gofeed"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const btihPrefix = "urn:btih:"
@@ -29,19 +33,26 @@ const btihPrefix = "urn:btih:"
 // Feed manages RSS feed parsing configurations and parsed content.
 type Feed struct {
 	*ParserConfig
-	Content *gofeed.Feed
-	URL     string // Feed URL
-	ctx     context.Context
+	Content    *gofeed.Feed
+	URL        string // Feed URL
+	ParseError error  // Parse error recovered from in lenient mode, nil if the feed was valid
+	ctx        context.Context
+	hosts      *HostLimiter // Limits the downloads of torrent files, nil for none
 }
 
 // ParserConfig holds the parameters read from the configuration file.
 type ParserConfig struct {
-	Include []string
-	Exclude []string
-	Trick   bool // Whether to apply the extractor to reconstruct the magnet link
-	Pattern string
-	Tag     string
-	r       *regexp.Regexp
+	Include    []string
+	Exclude    []string
+	Fields     []FieldFilter   // Filters of fields other than the title
+	Extracters []*Extracter    // Tried in order to reconstruct the magnet link, none to use the enclosures
+	Lenient    bool            // Whether to try recovering feeds that fail to parse
+	Archive    string          // Directory .torrent files are stored in by infoHash, empty to disable
+	MaxAge     time.Duration   // Items published longer ago are skipped, 0 to disable
+	MinAge     time.Duration   // Items published more recently are held back, 0 to disable
+	When       *vm.Program     // Expression an item must satisfy, nil to disable
+	normalizer *textNormalizer // Normalization of titles and keywords
+	titles     *titleMemo      // Normalized titles memoized across fetches, nil if normalizing is cheap
 }
 
 // TorrentInfo represents a single torrent or magnet link found in a feed item.
@@ -51,61 +62,92 @@ type TorrentInfo struct {
 }
 
 // NewFeedParser creates a new Feed object for the specified URL.
-func NewFeedParser(ctx context.Context, url string, pc *ParserConfig) *Feed {
+func NewFeedParser(ctx context.Context, url string, pc *ParserConfig) (*Feed, error) {
 	ctxWithTimeout, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	fp := gofeed.NewParser()
-	contents, err := fp.ParseURLWithContext(url, ctxWithTimeout)
+	fp.Client = httpClient
+	if !pc.Lenient {
+		contents, err := fp.ParseURLWithContext(url, ctxWithTimeout)
+		if err != nil {
+			feedLog.Warn("Failed to fetch feed URL", "url", url, "error", err)
+			return nil, err
+		}
+		return &Feed{ParserConfig: pc, Content: contents, URL: url, ctx: ctx}, nil
+	}
+
+	body, contentType, err := fetchFeedBody(ctxWithTimeout, url, fp.UserAgent)
 	if err != nil {
-		slog.Warn("Failed to fetch feed URL", "url", url, "error", err)
-		return nil
+		feedLog.Warn("Failed to fetch feed URL", "url", url, "error", err)
+		return nil, err
+	}
+	contents, parseErr := fp.Parse(bytes.NewReader(body))
+	if parseErr == nil {
+		return &Feed{ParserConfig: pc, Content: contents, URL: url, ctx: ctx}, nil
+	}
+	contents, err = fp.Parse(bytes.NewReader(recoverFeedBody(body, contentType)))
+	if err != nil {
+		feedLog.Warn("Failed to parse feed", "url", url, "error", parseErr)
+		return nil, parseErr
 	}
-	return &Feed{pc, contents, url, ctx}
+	feedLog.Warn("Recovered invalid feed", "url", url, "error", parseErr)
+	return &Feed{ParserConfig: pc, Content: contents, URL: url, ParseError: parseErr, ctx: ctx}, nil
 }
 
 // ProcessFeedItem processes a single feed item to extract relevant torrent URLs.
 // It returns a TorrentInfo object containing the URL and related info hashes.
 func (f *Feed) ProcessFeedItem(item *gofeed.Item, ignoredInfoHashSet map[string]struct{}) *TorrentInfo {
-	// Apply include and exclude filters on the title
-	cc, _ := gocc.New("t2s") // Convert Traditional Chinese to Simplified Chinese
-	var title string
+	// Apply include and exclude filters on the title and the other fields
 	rawTitle := html.UnescapeString(item.Title)
-	if cc != nil {
-		var err error
-		title, err = cc.Convert(rawTitle)
-		if err != nil {
-			slog.Warn("Failed to convert title to simplified Chinese", "title", rawTitle, "error", err)
-			title = rawTitle
-		}
-	} else {
-		title = rawTitle
+	if skip, _ := f.FilterTitle(rawTitle); skip {
+		return nil
 	}
-	if f.shouldSkipItem(strings.ToLower(title)) {
+	if skip, _ := f.FilterFields(item); skip {
+		return nil
+	}
+	if skip, _, _ := f.FilterAge(item, time.Now()); skip {
+		return nil
+	}
+	if skip, _ := f.FilterWhen(item); skip {
 		return nil
 	}
 
-	slog.Info("Processing item", "title", rawTitle, "url", f.URL)
+	feedLog.Info("Processing item", "title", rawTitle, "url", f.URL)
+	ctx, span := tracer.Start(f.ctx, "extract", trace.WithAttributes(attribute.String("title", rawTitle)))
+	defer span.End()
+	// Torrent downloads of the item are traced as part of its extraction
+	traced := *f
+	traced.ctx = ctx
+	return traced.ExtractTorrent(item, ignoredInfoHashSet)
+}
 
-	if f.Trick {
-		for _, value := range getTagValue(item, f.Tag) {
-			matchStrings := f.r.FindStringSubmatch(value)
-			if len(matchStrings) < 2 {
-				slog.Warn("Pattern did not match any hash", "pattern", f.Pattern)
-				continue
-			}
-			// Avoid adding magnet links with duplicate infoHashes when processing multiple feeds.
-			infoHash, err := regulateInfoHash(matchStrings[1])
-			if err != nil {
-				slog.Warn("Matched infoHash not valid", "error", err)
-				continue
-			}
-			if _, exists := ignoredInfoHashSet[infoHash]; exists {
-				continue
+// ExtractTorrent finds the torrent URL of a feed item, either by reconstructing a magnet link with the first
+// extracter finding a hash or from its enclosures. Torrents whose infoHashes are all in ignoredInfoHashSet are skipped.
+func (f *Feed) ExtractTorrent(item *gofeed.Item, ignoredInfoHashSet map[string]struct{}) *TorrentInfo {
+	if len(f.Extracters) > 0 {
+		matched := false
+		for _, e := range f.Extracters {
+			for _, value := range e.values(item) {
+				torrent, err := f.extract(e, value, html.UnescapeString(item.Title))
+				if err != nil {
+					feedLog.Warn("Extracter failed", "pattern", e.Pattern, "error", err)
+					continue
+				}
+				if torrent == nil {
+					continue
+				}
+				matched = true
+				// Avoid adding torrents with duplicate infoHashes when processing multiple feeds.
+				if allKnown(torrent.InfoHashes, ignoredInfoHashSet) {
+					continue
+				}
+				feedLog.Info("Added URL", "url", torrent.URL)
+				return torrent
 			}
-			url := "magnet:?xt=" + btihPrefix + infoHash
-			slog.Info("Added URL", "url", url)
-			return &TorrentInfo{URL: url, InfoHashes: []string{infoHash}}
+		}
+		if !matched {
+			feedLog.Warn("No extracter pattern matched", "title", html.UnescapeString(item.Title))
 		}
 	} else {
 		for _, enclosure := range item.Enclosures {
@@ -117,17 +159,17 @@ func (f *Feed) ProcessFeedItem(item *gofeed.Item, ignoredInfoHashSet map[string]
 			enclosureURL := html.UnescapeString(enclosure.URL)
 			infoHashes, err := parseMagnetURI(enclosureURL)
 			if err != nil {
-				infoHashes, _ = parseTorrentURIWithTimeout(f.ctx, enclosureURL)
+				infoHashes, _ = parseTorrentURIWithTimeout(f.ctx, f.hosts, enclosureURL, f.Archive)
 			}
 			// If any error occurs, infoHashes slice is empty. In this case, do not apply infoHash filter.
 			if len(infoHashes) == 0 {
-				slog.Info("Added URL", "url", enclosureURL)
+				feedLog.Info("Added URL", "url", enclosureURL)
 				return &TorrentInfo{URL: enclosureURL, InfoHashes: nil}
 			}
 			for _, infoHash := range infoHashes {
 				// Add to download link list if at least one infoHash hasn't been downloaded.
 				if _, exists := ignoredInfoHashSet[infoHash]; !exists {
-					slog.Info("Added URL", "url", enclosureURL)
+					feedLog.Info("Added URL", "url", enclosureURL)
 					return &TorrentInfo{URL: enclosureURL, InfoHashes: infoHashes}
 				}
 			}
@@ -136,29 +178,46 @@ func (f *Feed) ProcessFeedItem(item *gofeed.Item, ignoredInfoHashSet map[string]
 	return nil
 }
 
-// shouldSkipItem checks if an item should be skipped based on include and exclude filters.
-func (f *Feed) shouldSkipItem(title string) bool {
+// normalizeTitle lowercases the title and applies the Chinese conversion and other normalizations of the task,
+// matching the form of the filter keywords.
+func (f *Feed) normalizeTitle(rawTitle string) string {
+	if f.titles == nil {
+		return f.normalizer.Normalize(rawTitle)
+	}
+	if normalized, exists := f.titles.Get(rawTitle); exists {
+		return normalized
+	}
+	normalized := f.normalizer.Normalize(rawTitle)
+	f.titles.Put(rawTitle, normalized)
+	return normalized
+}
+
+// FilterTitle checks if an item should be skipped based on include and exclude filters applied to its raw title.
+// It also returns the reason of the decision.
+func (f *Feed) FilterTitle(rawTitle string) (bool, string) {
+	title := f.normalizeTitle(rawTitle)
+
 	// Check if all exclude keywords are present; if so, skip the item
 	for _, excludeKeywords := range f.Exclude {
 		if allKeywordsMatch(title, excludeKeywords) {
-			return true
+			return true, "excluded by '" + excludeKeywords + "'"
 		}
 	}
 
 	// If there are no include keywords, do not skip the item
 	if len(f.Include) == 0 {
-		return false
+		return false, "no include filter"
 	}
 
 	// Check if all include keywords are present; if so, do not skip the item
 	for _, includeKeywords := range f.Include {
 		if allKeywordsMatch(title, includeKeywords) {
-			return false
+			return false, "included by '" + includeKeywords + "'"
 		}
 	}
 
 	// If none of the include keywords match, skip the item
-	return true
+	return true, "no include keywords matched"
 }
 
 // RemoveExpiredItems removes items from the cache that are not present in the feed.
@@ -198,14 +257,41 @@ func getTagValue(item *gofeed.Item, tagName string) []string {
 }
 
 // allKeywordsMatch checks if all keywords in a comma-separated list are present in the title.
+// The list is walked in place to avoid allocating a slice for every item.
 func allKeywordsMatch(title, keywords string) bool {
-	keywordList := strings.Split(keywords, ",")
-	for _, keyword := range keywordList {
+	for {
+		keyword, rest, found := strings.Cut(keywords, ",")
 		if !strings.Contains(title, strings.TrimSpace(keyword)) {
 			return false
 		}
+		if !found {
+			return true
+		}
+		keywords = rest
+	}
+}
+
+// torrentName returns the name of the torrent with the infoHash from a torrent file downloaded before or
+// archived in archive, if any. Torrents only known by their infoHash have no name, at-rss doesn't look them
+// up on the DHT.
+func torrentName(infoHash, archive string) string {
+	if name := torrentInfoHashes.Name(infoHash); name != "" {
+		return name
+	}
+	if archive != "" {
+		return archivedName(archive, infoHash)
 	}
-	return true
+	return ""
+}
+
+// buildMagnet constructs a magnet link for the infoHash with the display name, so that downloaders and
+// logs show a name instead of a bare infoHash until the metadata is retrieved.
+func buildMagnet(infoHash, name string) string {
+	magnet := "magnet:?xt=" + btihPrefix + infoHash
+	if name = strings.TrimSpace(name); name != "" {
+		magnet += "&dn=" + url.QueryEscape(name)
+	}
+	return magnet
 }
 
 // parseMagnetURI parses a URI and returns all infohashes as hex strings if the URI is magnet-formatted.
@@ -262,8 +348,32 @@ func regulateInfoHash(s string) (string, error) {
 
 // parseTorrentURIWithTimeout downloads a torrent file from the specified URI using an HTTP GET request
 // with a context-based timeout. It parses the torrent file's metadata and returns the info hash as a hex string.
+// If archive is not empty, the torrent file is stored there. If hosts is not nil, the download waits for it.
+// A torrent file downloaded before is not downloaded again, its infoHashes are taken from torrentInfoHashes,
+// unless it is missing from the archive.
 // If the request fails or the torrent file cannot be parsed, it returns an error.
-func parseTorrentURIWithTimeout(ctx context.Context, uri string) ([]string, error) {
+func parseTorrentURIWithTimeout(ctx context.Context, hosts *HostLimiter, uri string, archive string) (infoHashes []string, err error) {
+	if entry := torrentInfoHashes.Get(uri); entry != nil && (archive == "" || archived(archive, entry.InfoHashes)) {
+		// The limit may have been lowered since the torrent file was downloaded
+		if limit := maxTorrentBytes(); limit > 0 && entry.Size > limit {
+			err = fmt.Errorf("%w: %d bytes", errTorrentTooLarge, entry.Size)
+			feedLog.Warn("Skipped torrent file", "url", uri, "err", err)
+			return nil, err
+		}
+		return entry.InfoHashes, nil
+	}
+
+	ctx, span := tracer.Start(ctx, "torrent.download", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attribute.String("url", uri)))
+	defer func() { endSpan(span, err) }()
+
+	if hosts != nil {
+		release, err := hosts.Acquire(ctx, uri)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
 	ctxWithTimeout, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
@@ -272,16 +382,83 @@ func parseTorrentURIWithTimeout(ctx context.Context, uri string) ([]string, erro
 		return nil, err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	metaInfo, err := metainfo.Load(resp.Body)
+	// Torrent files are small, don't let a misconfigured or malicious feed make the daemon read a huge body
+	body := &sizeLimitedReader{r: resp.Body, remaining: math.MaxInt64}
+	if limit := maxTorrentBytes(); limit > 0 {
+		if resp.ContentLength > limit {
+			err = fmt.Errorf("%w: %d bytes", errTorrentTooLarge, resp.ContentLength)
+			feedLog.Warn("Skipped torrent file", "url", uri, "err", err)
+			return nil, err
+		}
+		body.remaining = limit
+	}
+	metaInfo, err := metainfo.Load(body)
 	if err != nil {
+		// The bencode decoder doesn't wrap the errors of the reader
+		if body.exceeded {
+			err = errTorrentTooLarge
+			feedLog.Warn("Skipped torrent file", "url", uri, "err", err)
+		}
 		return nil, err
 	}
+	if archive != "" {
+		if err := archiveTorrent(archive, metaInfo); err != nil {
+			feedLog.Warn("Failed to archive torrent", "url", uri, "err", err)
+		}
+	}
+
+	infoHashes = []string{metaInfo.HashInfoBytes().HexString()}
+	var name string
+	if info, err := metaInfo.UnmarshalInfo(); err == nil {
+		name = info.BestName()
+	}
+	torrentInfoHashes.Put(uri, infoHashes, name, body.read)
+	return infoHashes, nil
+}
+
+// maxTorrentBytes returns the size limit of torrent files set by --max-torrent-size, 0 for none.
+func maxTorrentBytes() int64 {
+	return int64(opt.MaxTorrentSize) << 20
+}
+
+// errTorrentTooLarge is returned when a torrent file exceeds --max-torrent-size.
+var errTorrentTooLarge = errors.New("torrent file larger than --max-torrent-size")
 
-	return []string{metaInfo.HashInfoBytes().HexString()}, nil
+// sizeLimitedReader reads from r until remaining bytes were read and fails beyond, unlike io.LimitReader
+// which ends silently so that the parser would report a truncated torrent file instead.
+type sizeLimitedReader struct {
+	r         io.Reader
+	remaining int64
+	read      int64 // bytes read so far
+	exceeded  bool  // whether the body is larger than the limit
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Tell a body ending right at the limit from a larger one, readers may return no byte and no error
+		var probe [1]byte
+		for {
+			n, err := l.r.Read(probe[:])
+			if n > 0 {
+				l.exceeded = true
+				return 0, errTorrentTooLarge
+			}
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	l.read += int64(n)
+	return n, err
 }
@@ -0,0 +1,227 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Size of the fixture of the benchmarks: 10k items across 100 feeds, what a user following many trackers
+// accumulates in the cache.
+const (
+	benchFeeds        = 100
+	benchItemsPerFeed = 100
+)
+
+// benchFixture is the feeds shared by the benchmarks.
+type benchFixture struct {
+	urls    []string
+	bodies  [][]byte                       // RSS of each feed
+	items   [][]*gofeed.Item               // parsed items of each feed
+	titles  []string                       // titles of all items
+	entries map[string]map[string][]string // cache entries of each feed
+}
+
+// benchData returns the fixture, built once for all benchmarks.
+var benchData = sync.OnceValue(func() *benchFixture {
+	fixture := &benchFixture{entries: make(map[string]map[string][]string, benchFeeds)}
+	for feed := range benchFeeds {
+		url := fmt.Sprintf("http://tracker%d.localhost/feed.xml", feed)
+		body := benchFeedBody(feed, benchItemsPerFeed)
+		content, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+		if err != nil {
+			panic(err)
+		}
+		entries := make(map[string][]string, len(content.Items))
+		for i, item := range content.Items {
+			fixture.titles = append(fixture.titles, item.Title)
+			entries[item.GUID] = []string{infoHashOf(feed*benchItemsPerFeed + i)}
+		}
+		fixture.urls = append(fixture.urls, url)
+		fixture.bodies = append(fixture.bodies, body)
+		fixture.items = append(fixture.items, content.Items)
+		fixture.entries[url] = entries
+	}
+	return fixture
+})
+
+// benchFeedBody returns the RSS of a feed of n items with magnet enclosures, every other one in 1080p.
+func benchFeedBody(feed, n int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?><rss version="2.0"><channel><title>bench</title>`)
+	for i := range n {
+		quality := "720p"
+		if i%2 == 0 {
+			quality = "1080p"
+		}
+		fmt.Fprintf(&buf, `<item><title>[Group] 葬送的芙莉蓮 %d - %02d [%s][繁體]</title><guid>g%d-%d</guid>`, feed, i, quality, feed, i)
+		fmt.Fprintf(&buf, `<enclosure url="magnet:?xt=urn:btih:%s" type="application/x-bittorrent" length="1"/></item>`, infoHashOf(feed*n+i))
+	}
+	buf.WriteString(`</channel></rss>`)
+	return buf.Bytes()
+}
+
+// infoHashOf returns a distinct infoHash for n.
+func infoHashOf(n int) string {
+	return fmt.Sprintf("%040x", n)
+}
+
+// newBenchCache returns a cache holding the entries of the fixture, flushed to a temporary directory.
+func newBenchCache(b *testing.B) *Cache {
+	cache := &Cache{data: make(map[string]map[string][]string, benchFeeds), filePath: filepath.Join(b.TempDir(), "cache.yml")}
+	for url, entries := range benchData().entries {
+		cache.Set(url, entries, true)
+	}
+	return cache
+}
+
+// newBenchFeed returns a feed filtered as configured by a task including 1080p releases.
+func newBenchFeed(tb testing.TB) *Feed {
+	tb.Helper()
+	task := map[string]interface{}{
+		"aria2c": nil,
+		"feed":   "http://localhost/feed.xml",
+		"filter": map[string]interface{}{"include": []interface{}{"1080p, 简体", "1080p, 繁體"}, "exclude": []interface{}{"cam"}},
+	}
+	t, err := parseTask("bench", task, newConverter())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return &Feed{ParserConfig: t.parserConfig, URL: "http://localhost/feed.xml", ctx: context.Background()}
+}
+
+// discardFeedLogs silences the logs of processed items for the duration of the test.
+func discardFeedLogs(tb testing.TB) {
+	saved := feedLog
+	feedLog = slog.New(slog.NewTextHandler(io.Discard, nil))
+	tb.Cleanup(func() { feedLog = saved })
+}
+
+func BenchmarkParseFeed(b *testing.B) {
+	discardFeedLogs(b)
+	fixture := benchData()
+	f := newBenchFeed(b)
+	ignored := make(map[string]struct{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		for _, body := range fixture.bodies {
+			content, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+			if err != nil {
+				b.Fatal(err)
+			}
+			for _, item := range content.Items {
+				f.ProcessFeedItem(item, ignored)
+			}
+		}
+	}
+}
+
+func BenchmarkProcessFeedItem(b *testing.B) {
+	discardFeedLogs(b)
+	fixture := benchData()
+	f := newBenchFeed(b)
+	ignored := make(map[string]struct{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		for _, items := range fixture.items {
+			for _, item := range items {
+				f.ProcessFeedItem(item, ignored)
+			}
+		}
+	}
+}
+
+func BenchmarkFilterTitle(b *testing.B) {
+	fixture := benchData()
+	f := newBenchFeed(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		for _, title := range fixture.titles {
+			f.FilterTitle(title)
+		}
+	}
+}
+
+func BenchmarkCacheGet(b *testing.B) {
+	fixture := benchData()
+	cache := newBenchCache(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		for _, url := range fixture.urls {
+			cache.Get(url)
+		}
+	}
+}
+
+func BenchmarkCacheSet(b *testing.B) {
+	fixture := benchData()
+	cache := newBenchCache(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		for _, url := range fixture.urls {
+			cache.Set(url, fixture.entries[url], false)
+		}
+	}
+}
+
+func BenchmarkCacheFlush(b *testing.B) {
+	cache := newBenchCache(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if err := cache.Flush(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetAllInfoHashes(b *testing.B) {
+	cache := newBenchCache(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if infoHashSet := cache.AllInfoHashes(); len(infoHashSet) != benchFeeds*benchItemsPerFeed {
+			b.Fatalf("%d infoHashes, want %d", len(infoHashSet), benchFeeds*benchItemsPerFeed)
+		}
+	}
+}
+
+func TestFilterTitleAllocs(t *testing.T) {
+	f := newBenchFeed(t)
+	tests := []struct {
+		title  string
+		skip   bool
+		allocs float64 // the reason quoting the keywords matched
+	}{
+		{"[Group] 葬送的芙莉蓮 - 01 [1080p][繁體]", false, 1},
+		{"[Group] 葬送的芙莉蓮 - 01 [1080p][CAM]", true, 1},
+		{"[Group] 葬送的芙莉蓮 - 01 [720p][繁體]", true, 0},
+	}
+	for _, tt := range tests {
+		if skip, reason := f.FilterTitle(tt.title); skip != tt.skip {
+			t.Errorf("FilterTitle(%q) = %v (%s), want %v", tt.title, skip, reason, tt.skip)
+		}
+		// Titles seen at a previous fetch are normalized once, filtering them again allocates no more
+		if allocs := testing.AllocsPerRun(100, func() { f.FilterTitle(tt.title) }); allocs > tt.allocs {
+			t.Errorf("FilterTitle(%q) allocates %v times, want at most %v", tt.title, allocs, tt.allocs)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// notAFeed is the format of a feed URL returning a document that is neither RSS, Atom nor JSON Feed,
+// typically an HTML page after a tracker redesign or a login page.
+const notAFeed = "not a feed"
+
+// FeedShape describes the structure of a feed the torrents are extracted from. A change of shape,
+// e.g. after a tracker redesign, usually breaks extraction of every item.
+type FeedShape struct {
+	Format     string // Feed type, or notAFeed
+	Enclosures bool   // Whether items carry .torrent enclosures
+	GUID       string // Predominant GUID format: "url", "hash", "number", "other" or "none"
+	Link       string // Predominant link format: "magnet", "torrent", "url" or "none"
+}
+
+var (
+	hashGUID   = regexp.MustCompile(`^(?i:[0-9a-f]{40}|[2-7a-z]{32})$`)
+	numberGUID = regexp.MustCompile(`^\d+$`)
+)
+
+// feedShape returns the shape of a parsed feed, or false if it has no items to tell it from.
+func feedShape(feed *gofeed.Feed) (FeedShape, bool) {
+	if len(feed.Items) == 0 {
+		return FeedShape{}, false
+	}
+	shape := FeedShape{Format: feed.FeedType}
+	guids := make(map[string]int)
+	links := make(map[string]int)
+	for _, item := range feed.Items {
+		for _, enclosure := range item.Enclosures {
+			if enclosure.Type == "application/x-bittorrent" {
+				shape.Enclosures = true
+			}
+		}
+		switch guid := strings.TrimSpace(item.GUID); {
+		case guid == "":
+			guids["none"]++
+		case strings.HasPrefix(guid, "http://") || strings.HasPrefix(guid, "https://"):
+			guids["url"]++
+		case hashGUID.MatchString(guid):
+			guids["hash"]++
+		case numberGUID.MatchString(guid):
+			guids["number"]++
+		default:
+			guids["other"]++
+		}
+		switch link := strings.TrimSpace(item.Link); {
+		case link == "":
+			links["none"]++
+		case strings.HasPrefix(link, "magnet:"):
+			links["magnet"]++
+		case strings.HasSuffix(strings.SplitN(link, "?", 2)[0], ".torrent"):
+			links["torrent"]++
+		default:
+			links["url"]++
+		}
+	}
+	shape.GUID = predominant(guids)
+	shape.Link = predominant(links)
+	return shape, true
+}
+
+// predominant returns the most frequent key of the counts, the lexically first on a tie.
+func predominant(counts map[string]int) string {
+	var result string
+	for key, count := range counts {
+		if result == "" || count > counts[result] || (count == counts[result] && key < result) {
+			result = key
+		}
+	}
+	return result
+}
+
+// changes describes how the shape differs from the previous one, or returns nil if they are equal.
+func (s FeedShape) changes(previous FeedShape) []string {
+	var changes []string
+	if s.Format != previous.Format {
+		changes = append(changes, "format "+previous.Format+" -> "+s.Format)
+	}
+	if s.Format == notAFeed || previous.Format == notAFeed {
+		return changes
+	}
+	if s.Enclosures != previous.Enclosures {
+		if s.Enclosures {
+			changes = append(changes, "torrent enclosures appeared")
+		} else {
+			changes = append(changes, "torrent enclosures disappeared")
+		}
+	}
+	if s.GUID != previous.GUID {
+		changes = append(changes, "guid "+previous.GUID+" -> "+s.GUID)
+	}
+	if s.Link != previous.Link {
+		changes = append(changes, "link "+previous.Link+" -> "+s.Link)
+	}
+	return changes
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fetchRequestFileName holds the tasks asked to fetch now by the 'fetch-now' subcommand, with the time of the request.
+const fetchRequestFileName = ".cache/at-rss-fetch.yml"
+
+// fetchRequestExpiry is how long a request is kept when no running task takes it.
+const fetchRequestExpiry = 10 * clockCheckInterval
+
+// FetchRequests passes requests for an immediate fetch from the CLI to the running tasks. Tasks look for
+// requests each time they wake up, at least every clockCheckInterval.
+type FetchRequests struct {
+	filePath string
+}
+
+// NewFetchRequests returns FetchRequests stored in the user's cache directory.
+func NewFetchRequests() (*FetchRequests, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return &FetchRequests{filePath: filepath.Join(homeDir, fetchRequestFileName)}, nil
+}
+
+// update loads the requests, lets fn modify them and saves the result, holding a lock on the file meanwhile.
+func (r *FetchRequests) update(fn func(requests map[string]time.Time)) error {
+	unlock, err := lockFile(r.filePath + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	requests := make(map[string]time.Time)
+	if err := loadCache(r.filePath, &requests); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	fn(requests)
+	if len(requests) == 0 {
+		if err := os.Remove(r.filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return writeFileAtomic(r.filePath, requests)
+}
+
+// Request asks the tasks to fetch now.
+func (r *FetchRequests) Request(tasks []string) error {
+	now := time.Now()
+	return r.update(func(requests map[string]time.Time) {
+		for _, task := range tasks {
+			requests[task] = now
+		}
+	})
+}
+
+// Take removes the request of the task and reports whether there was one.
+func (r *FetchRequests) Take(task string) (bool, error) {
+	// Most of the time there is no request at all, don't lock the file then
+	if _, err := os.Stat(r.filePath); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	requested := false
+	err := r.update(func(requests map[string]time.Time) {
+		_, requested = requests[task]
+		delete(requests, task)
+		// Requests of tasks removed from the config would never be taken
+		for name, at := range requests {
+			if time.Since(at) > fetchRequestExpiry {
+				delete(requests, name)
+			}
+		}
+	})
+	return requested, err
+}
+
+// takeFetchRequest reports whether the task was asked to fetch now.
+func (t *Task) takeFetchRequest() bool {
+	requests, err := NewFetchRequests()
+	if err != nil {
+		return false
+	}
+	requested, err := requests.Take(t.Name)
+	if err != nil {
+		slog.Warn("Failed to read fetch requests", "task", t.Name, "err", err)
+	}
+	return requested
+}
+
+// fetchNowCommand implements the 'fetch-now' subcommand.
+type fetchNowCommand struct {
+	Task []string `long:"task" description:"Task to fetch; may be repeated"`
+	Tag  string   `long:"tag" description:"Fetch the tasks with this tag"`
+}
+
+func init() {
+	parser.AddCommand("fetch-now",
+		"Make the daemon fetch tasks now",
+		"Ask the running daemon to fetch all feeds of the tasks outside their schedule, all tasks by default. "+
+			"The tasks fetch within a minute; 'at-rss status' shows the result.",
+		&fetchNowCommand{})
+}
+
+// Execute records the fetch requests for the daemon.
+func (c *fetchNowCommand) Execute(args []string) error {
+	if !daemonRunning() {
+		return errors.New("no daemon is running, use --once to fetch the tasks a single time")
+	}
+	names, err := selectTaskNames(c.Task, c.Tag)
+	if err != nil {
+		return err
+	}
+
+	requests, err := NewFetchRequests()
+	if err != nil {
+		return err
+	}
+	if err := requests.Request(names); err != nil {
+		return err
+	}
+	fmt.Printf("Requested a fetch of %d tasks, starting within %s.\n", len(names), clockCheckInterval)
+	return nil
+}
+
+// selectTaskNames returns the names of the configured tasks among names, all if names is empty,
+// with the tag if it is not empty.
+func selectTaskNames(names []string, tag string) ([]string, error) {
+	tasks, err := LoadConfig(opt.Config)
+	if err != nil {
+		return nil, err
+	}
+	var configured, selected []string
+	for _, task := range *tasks {
+		configured = append(configured, task.Name)
+		if (len(names) == 0 || containsTask(names, task.Name)) && (tag == "" || task.HasTag(tag)) {
+			selected = append(selected, task.Name)
+		}
+	}
+	for _, name := range names {
+		if !containsTask(configured, name) {
+			return nil, fmt.Errorf("task not found: %s", name)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, errors.New("no task matches")
+	}
+	return selected, nil
+}
+
+// containsTask reports whether names contains name.
+func containsTask(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"html"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// FieldFilter applies include and exclude keywords to a field of the item other than the title.
+type FieldFilter struct {
+	Field   string // "category", "description", "author", "link", "dc.<name>" or "ext.<prefix>.<name>"
+	Include []string
+	Exclude []string
+}
+
+// parseFieldFilters processes the 'fields' list of the filter section.
+func parseFieldFilters(v interface{}, n *textNormalizer) ([]FieldFilter, error) {
+	rules, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("invalid 'fields' in filter: must be a list")
+	}
+	filters := make([]FieldFilter, 0, len(rules))
+	for _, rule := range rules {
+		rawMap, ok := rule.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("invalid 'fields' in filter: each entry needs a 'field'")
+		}
+		field := convertToString(rawMap["field"])
+		if !validField(field) {
+			return nil, errors.New("invalid field in filter: '" + field + "'")
+		}
+		keywords := convertToStringSliceMap(rawMap)
+		filters = append(filters, FieldFilter{
+			Field:   field,
+			Include: normalizeAndSimplifyTexts(n, keywords["include"]),
+			Exclude: normalizeAndSimplifyTexts(n, keywords["exclude"]),
+		})
+	}
+	return filters, nil
+}
+
+// validField reports whether the field can be filtered on.
+func validField(field string) bool {
+	switch field {
+	case "category", "description", "author", "link":
+		return true
+	}
+	if name, found := strings.CutPrefix(field, "dc."); found {
+		return name != "" && !strings.Contains(name, ".")
+	}
+	prefix, name, found := strings.Cut(strings.TrimPrefix(field, "ext."), ".")
+	return strings.HasPrefix(field, "ext.") && found && prefix != "" && name != ""
+}
+
+// fieldValues returns the values of the field of an item. Fields such as categories may have several values.
+func fieldValues(item *gofeed.Item, field string) []string {
+	var values []string
+	switch {
+	case field == "category":
+		values = append(values, item.Categories...)
+	case field == "description":
+		values = append(values, item.Description)
+	case field == "author":
+		for _, author := range item.Authors {
+			values = append(values, strings.TrimSpace(author.Name+" "+author.Email))
+		}
+	case field == "link":
+		values = append(values, item.Links...)
+		if len(item.Links) == 0 && item.Link != "" {
+			values = append(values, item.Link)
+		}
+	case strings.HasPrefix(field, "dc."):
+		// Dublin Core elements, e.g. dc:creator, are kept with the other extensions
+		for _, ext := range item.Extensions["dc"][strings.TrimPrefix(field, "dc.")] {
+			values = append(values, ext.Value)
+		}
+	case strings.HasPrefix(field, "ext."):
+		prefix, name, _ := strings.Cut(strings.TrimPrefix(field, "ext."), ".")
+		for _, ext := range item.Extensions[prefix][name] {
+			values = append(values, ext.Value)
+		}
+	}
+	for i, value := range values {
+		values[i] = html.UnescapeString(value)
+	}
+	return values
+}
+
+// FilterFields checks if an item should be skipped based on the field filters. All of them must pass.
+// It also returns the reason of the decision.
+func (f *Feed) FilterFields(item *gofeed.Item) (bool, string) {
+	for _, filter := range f.Fields {
+		values := fieldValues(item, filter.Field)
+		for i, value := range values {
+			// Not memoized like titles, long descriptions would evict them
+			values[i] = f.normalizer.Normalize(value)
+		}
+		for _, excludeKeywords := range filter.Exclude {
+			for _, value := range values {
+				if allKeywordsMatch(value, excludeKeywords) {
+					return true, filter.Field + " excluded by '" + excludeKeywords + "'"
+				}
+			}
+		}
+		if len(filter.Include) == 0 {
+			continue
+		}
+		included := false
+		for _, includeKeywords := range filter.Include {
+			for _, value := range values {
+				if allKeywordsMatch(value, includeKeywords) {
+					included = true
+				}
+			}
+		}
+		if !included {
+			return true, "no include keywords matched " + filter.Field
+		}
+	}
+	return false, ""
+}
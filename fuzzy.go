@@ -0,0 +1,221 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const titleFileName = ".cache/at-rss-titles.yml"
+
+// titleRetention is how long a grabbed title is compared against, long after its item left the feed.
+const titleRetention = 30 * 24 * time.Hour
+
+// titleCacheKeyPrefix prefixes the cache key the titles grabbed by a task with fuzzy dedup were kept
+// under before the title store, keyed by normalized title.
+const titleCacheKeyPrefix = "titles/"
+
+// defaultFuzzyThreshold is the similarity of 'fuzzy: true'.
+const defaultFuzzyThreshold = 0.8
+
+// parseFuzzyConfig processes the fuzzy dedup setting of a task: true, false or the similarity, above 0
+// and at most 1, from which two titles are considered the same release.
+func parseFuzzyConfig(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return defaultFuzzyThreshold, nil
+		}
+		return 0, nil
+	case float64:
+		if v > 0 && v <= 1 {
+			return v, nil
+		}
+	case int:
+		if v == 1 {
+			return 1, nil
+		}
+	}
+	return 0, errors.New("invalid 'fuzzy': must be true, false or a similarity between 0 and 1")
+}
+
+// titleCacheKey returns the cache key of the titles grabbed by the task before the title store.
+func (t *Task) titleCacheKey() string {
+	return titleCacheKeyPrefix + t.Name
+}
+
+// TitleEntry is a title grabbed by a task with fuzzy dedup, in the form titles are compared in.
+type TitleEntry struct {
+	Grabbed time.Time `yaml:"grabbed"`
+	Episode string    `yaml:"episode,omitempty"` // Episode number, titles of different episodes are never near duplicates
+	Tokens  []string  `yaml:"tokens"`            // Words of the title, see titleTokens
+}
+
+// newTitleEntry parses a normalized title grabbed at the given time.
+func newTitleEntry(title string, grabbed time.Time) *TitleEntry {
+	_, episode, _ := strings.Cut(parseEpisode(title), "|")
+	return &TitleEntry{Grabbed: grabbed, Episode: episode, Tokens: titleTokens(title)}
+}
+
+// TitleStore persists the titles grabbed by tasks with fuzzy dedup per task name and normalized title.
+type TitleStore struct {
+	filePath string
+}
+
+// NewTitleStore returns a TitleStore stored in the user's cache directory.
+func NewTitleStore() (*TitleStore, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return &TitleStore{filePath: filepath.Join(homeDir, titleFileName)}, nil
+}
+
+// Load returns the grabbed titles.
+func (s *TitleStore) Load() (map[string]map[string]*TitleEntry, error) {
+	titles := make(map[string]map[string]*TitleEntry)
+	if err := loadCache(s.filePath, &titles); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return titles, nil
+}
+
+// Add records titles grabbed by the task and forgets those older than the retention.
+func (s *TitleStore) Add(task string, titles map[string]*TitleEntry) error {
+	unlock, err := lockFile(s.filePath + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	all, err := s.Load()
+	if err != nil {
+		return err
+	}
+	if all[task] == nil {
+		all[task] = make(map[string]*TitleEntry)
+	}
+	for title, entry := range titles {
+		all[task][title] = entry
+	}
+	now := time.Now()
+	for name, entries := range all {
+		for title, entry := range entries {
+			if now.Sub(entry.Grabbed) > titleRetention {
+				delete(entries, title)
+			}
+		}
+		if len(entries) == 0 {
+			delete(all, name)
+		}
+	}
+	return writeFileAtomic(s.filePath, all)
+}
+
+// loadTitles returns the titles grabbed by the task. Titles still kept in the cache are moved to the
+// title store first.
+func (t *Task) loadTitles(cache *Cache) map[string]*TitleEntry {
+	store, err := NewTitleStore()
+	if err != nil {
+		slog.Warn("Failed to load grabbed titles", "task", t.Name, "err", err)
+		return make(map[string]*TitleEntry)
+	}
+	if legacy := cache.Get(t.titleCacheKey()); len(legacy) > 0 {
+		imported := make(map[string]*TitleEntry, len(legacy))
+		now := time.Now()
+		for title := range legacy {
+			imported[title] = newTitleEntry(title, now)
+		}
+		if err := store.Add(t.Name, imported); err != nil {
+			slog.Warn("Failed to move grabbed titles out of the cache", "task", t.Name, "err", err)
+		} else {
+			cache.Delete(t.titleCacheKey())
+		}
+	}
+	all, err := store.Load()
+	if err != nil {
+		slog.Warn("Failed to load grabbed titles", "task", t.Name, "err", err)
+	}
+	if all[t.Name] == nil {
+		return make(map[string]*TitleEntry)
+	}
+	return all[t.Name]
+}
+
+// recordTitles adds the titles grabbed by the task to the title store.
+func (t *Task) recordTitles(titles map[string]*TitleEntry) {
+	if len(titles) == 0 {
+		return
+	}
+	store, err := NewTitleStore()
+	if err == nil {
+		err = store.Add(t.Name, titles)
+	}
+	if err != nil {
+		slog.Warn("Failed to record grabbed titles", "task", t.Name, "err", err)
+	}
+}
+
+// checksumToken matches the CRC32 checksum fansub releases put in their titles, which differs between uploads.
+var checksumToken = regexp.MustCompile(`^[0-9a-f]{8}$`)
+
+// titleTokens returns the sorted words of a normalized title, each once and without checksums.
+func titleTokens(title string) []string {
+	var tokens []string
+	for _, token := range strings.FieldsFunc(title, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		if !checksumToken.MatchString(token) {
+			tokens = append(tokens, token)
+		}
+	}
+	slices.Sort(tokens)
+	return slices.Compact(tokens)
+}
+
+// tokenSimilarity returns the share of the words of two titles found in both, from 0 to 1. The words
+// are sorted, as titleTokens returns them.
+func tokenSimilarity(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	common := 0
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch strings.Compare(a[i], b[j]) {
+		case 0:
+			common++
+			i++
+			j++
+		case -1:
+			i++
+		default:
+			j++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
+
+// similarTitle returns the grabbed title the normalized title is a near duplicate of, or "" if there is none.
+// Titles of different episodes are never near duplicates, however similar.
+func (t *Task) similarTitle(grabbed map[string]*TitleEntry, title string) string {
+	if _, exists := grabbed[title]; exists {
+		return title
+	}
+	parsed := newTitleEntry(title, time.Time{})
+	for other, entry := range grabbed {
+		if entry.Episode == parsed.Episode && tokenSimilarity(parsed.Tokens, entry.Tokens) >= t.Fuzzy {
+			return other
+		}
+	}
+	return ""
+}
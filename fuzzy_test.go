@@ -0,0 +1,101 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"", "show", 0},
+		{"show 05", "show 05", 1},
+		{"show 05", "other 06", 0},
+		{"a b c d", "a b c d e", 0.8},
+		{"a b c d e", "a b c d e f", 5.0 / 6},
+		{"subs show 05 1080p", "subs show 05 720p", 0.6},
+		{"show 05 abcd1234", "show 05 deadbeef", 1}, // checksums are ignored
+		{"show 05 05", "show 05", 1},
+	}
+	for _, tt := range tests {
+		if got := tokenSimilarity(titleTokens(tt.a), titleTokens(tt.b)); got != tt.want {
+			t.Errorf("tokenSimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSimilarTitle(t *testing.T) {
+	grabbed := make(map[string]*TitleEntry)
+	for _, title := range []string{"[subs] show - 05 [1080p][abcd1234]", "[subs] a b c d e f g h i - 05 [1080p]", "[subs] other show s01e02 [1080p][x264]"} {
+		grabbed[title] = newTitleEntry(title, time.Now())
+	}
+	tests := []struct {
+		title     string
+		threshold float64
+		want      string
+	}{
+		{"[subs] show - 05 [1080p][abcd1234]", 1, "[subs] show - 05 [1080p][abcd1234]"},
+		{"[subs] show - 05 [1080p][0badf00d]", 1, "[subs] show - 05 [1080p][abcd1234]"},
+		{"[subs] show - 05 [1080p][web]", 0.8, "[subs] show - 05 [1080p][abcd1234]"},
+		{"[subs] show - 05 [1080p][web]", 0.81, ""},
+		{"[subs] show - 05 [720p]", 0.8, ""},
+		{"[subs] other show s01e02 [1080p][hevc]", 0.7, "[subs] other show s01e02 [1080p][x264]"},
+		// Different episodes, however similar the titles
+		{"[subs] a b c d e f g h i - 06 [1080p]", 0.8, ""},
+		{"[subs] other show s01e03 [1080p][x264]", 0.5, ""},
+	}
+	for _, tt := range tests {
+		task := &Task{Fuzzy: tt.threshold}
+		if got := task.similarTitle(grabbed, tt.title); got != tt.want {
+			t.Errorf("similarTitle(%q) with a threshold of %v = %q, want %q", tt.title, tt.threshold, got, tt.want)
+		}
+	}
+}
+
+func TestTitleStore(t *testing.T) {
+	isolateHome(t)
+	store, err := NewTitleStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := map[string]*TitleEntry{"show - 01": newTitleEntry("show - 01", time.Now().Add(-titleRetention-time.Hour))}
+	if err := store.Add("task", old); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add("other", map[string]*TitleEntry{"show - 02": newTitleEntry("show - 02", time.Now())}); err != nil {
+		t.Fatal(err)
+	}
+	titles, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := titles["task"]; exists {
+		t.Errorf("titles of task = %v, want those older than the retention forgotten", titles["task"])
+	}
+	if entry := titles["other"]["show - 02"]; entry == nil || entry.Episode != "E2" || len(entry.Tokens) != 2 {
+		t.Errorf("title of other = %+v, want episode E2 and the words show and 02", entry)
+	}
+}
+
+func TestLoadTitles(t *testing.T) {
+	isolateHome(t)
+	task := &Task{Name: "task"}
+	cache := &Cache{data: map[string]map[string][]string{task.titleCacheKey(): {"show - 01": {infoHashOf(1)}}}}
+	if titles := task.loadTitles(cache); titles["show - 01"] == nil {
+		t.Errorf("loadTitles() = %v, want the title kept in the cache", titles)
+	}
+	if _, exists := cache.data[task.titleCacheKey()]; exists {
+		t.Error("titles left in the cache after moving them to the title store")
+	}
+	if titles := task.loadTitles(cache); titles["show - 01"] == nil {
+		t.Errorf("loadTitles() = %v, want the title moved to the title store", titles)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultDegradedThreshold = 3
+
+// FeedStatus holds the health state of a single feed URL.
+type FeedStatus struct {
+	ConsecutiveFailures int
+	LastError           string
+	LastSuccess         time.Time
+	Degraded            bool
+	ParseErrors         int        // Number of fetches that needed lenient recovery
+	LastParseError      string     // Most recent parse error recovered from
+	Shape               *FeedShape // Structure of the feed at the last fetch it could be told from, nil if unknown
+	LastSchemaChange    string     // Most recent change of the feed structure
+}
+
+// FeedHealth tracks consecutive fetch failures per feed URL, shared by all tasks.
+// A feed is marked degraded once its consecutive failures reach the threshold.
+type FeedHealth struct {
+	mu        sync.Mutex
+	feeds     map[string]*FeedStatus
+	threshold int
+}
+
+// NewFeedHealth returns a FeedHealth marking feeds degraded after threshold consecutive failures.
+func NewFeedHealth(threshold int) *FeedHealth {
+	if threshold <= 0 {
+		threshold = defaultDegradedThreshold
+	}
+	return &FeedHealth{feeds: make(map[string]*FeedStatus), threshold: threshold}
+}
+
+// RecordSuccess resets the failure counter of the feed.
+func (h *FeedHealth) RecordSuccess(url string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := h.status(url)
+	if status.Degraded {
+		feedLog.Info("Feed recovered", "url", url, "failures", status.ConsecutiveFailures)
+	}
+	status.ConsecutiveFailures = 0
+	status.LastError = ""
+	status.LastSuccess = time.Now()
+	status.Degraded = false
+}
+
+// RecordFailure increases the failure counter of the feed and marks it degraded when the threshold is reached.
+func (h *FeedHealth) RecordFailure(url string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := h.status(url)
+	status.ConsecutiveFailures++
+	if err != nil {
+		status.LastError = err.Error()
+	}
+	if !status.Degraded && status.ConsecutiveFailures >= h.threshold {
+		status.Degraded = true
+		feedLog.Error("Feed degraded", "url", url, "failures", status.ConsecutiveFailures, "err", status.LastError)
+	}
+}
+
+// RecordParseError records a parse error the feed was recovered from in lenient mode.
+func (h *FeedHealth) RecordParseError(url string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := h.status(url)
+	status.ParseErrors++
+	status.LastParseError = err.Error()
+}
+
+// RecordShape records the structure of the feed. A change from the previous structure is reported once
+// as a schema change, since it usually breaks the extraction of every item rather than of a single one.
+func (h *FeedHealth) RecordShape(url string, shape FeedShape) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := h.status(url)
+	if status.Shape != nil {
+		if changes := shape.changes(*status.Shape); len(changes) > 0 {
+			status.LastSchemaChange = strings.Join(changes, ", ")
+			feedLog.Error("Feed schema changed, check the filter and extracter of its tasks", "url", url, "changes", status.LastSchemaChange)
+		}
+	}
+	status.Shape = &shape
+}
+
+// Get returns a copy of the health state of the feed.
+func (h *FeedHealth) Get(url string) FeedStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if status, exists := h.feeds[url]; exists {
+		return *status
+	}
+	return FeedStatus{}
+}
+
+// status returns the state of the feed, creating it if needed. The caller must hold h.mu.
+func (h *FeedHealth) status(url string) *FeedStatus {
+	status, exists := h.feeds[url]
+	if !exists {
+		status = &FeedStatus{}
+		h.feeds[url] = status
+	}
+	return status
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// historyFileName holds one JSON entry per line, so that recording a download only appends to it.
+const historyFileName = ".cache/at-rss-history.jsonl"
+
+// HistoryEntry records a torrent added to a downloader, long after its item expired from the feed.
+type HistoryEntry struct {
+	Time       time.Time `json:"time"`
+	Task       string    `json:"task"`
+	Title      string    `json:"title"`
+	Name       string    `json:"name,omitempty"` // Name of the torrent in its metainfo if known and unlike the title
+	URL        string    `json:"url"`
+	InfoHashes []string  `json:"infoHashes,omitempty"`
+	Downloader string    `json:"downloader"`
+	Feed       string    `json:"feed,omitempty"`
+	Reason     string    `json:"reason,omitempty"` // Why the item was added, e.g. the matching include keywords
+	Size       int64     `json:"size,omitempty"`   // Size in bytes given by the feed item, 0 if unknown
+}
+
+// HistoryStore persists the torrents added by all tasks.
+type HistoryStore struct {
+	filePath string
+}
+
+// NewHistoryStore returns a HistoryStore stored in the user's cache directory.
+func NewHistoryStore() (*HistoryStore, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return &HistoryStore{filePath: filepath.Join(homeDir, historyFileName)}, nil
+}
+
+// Append adds the entries to the end of the history.
+func (s *HistoryStore) Append(entries []*HistoryEntry) error {
+	unlock, err := lockFile(s.filePath + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	file, err := os.OpenFile(s.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	for _, entry := range entries {
+		if err = encoder.Encode(entry); err != nil {
+			break
+		}
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Load returns the history, oldest first. Lines that fail to decode, e.g. one cut short by a crash, are skipped.
+func (s *HistoryStore) Load() ([]*HistoryEntry, error) {
+	file, err := os.Open(s.filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []*HistoryEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, scanner.Err()
+}
+
+// newHistoryEntry returns the history entry of a torrent added by the task.
+func (t *Task) newHistoryEntry(title, url string, infoHashes []string, feed, reason string) *HistoryEntry {
+	var name string
+	for _, infoHash := range infoHashes {
+		if name = torrentName(infoHash, t.parserConfig.Archive); name != "" {
+			break
+		}
+	}
+	if name == title {
+		name = ""
+	}
+	return &HistoryEntry{
+		Time:       time.Now(),
+		Task:       t.Name,
+		Title:      title,
+		Name:       name,
+		URL:        url,
+		InfoHashes: infoHashes,
+		Downloader: t.ServerConfig.RpcType + " " + redactedEndpoint(t.ServerConfig),
+		Feed:       feed,
+		Reason:     reason,
+	}
+}
+
+// recordHistory appends the entries of torrents added by the task to the history.
+func (t *Task) recordHistory(entries []*HistoryEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	store, err := NewHistoryStore()
+	if err == nil {
+		err = store.Append(entries)
+	}
+	if err != nil {
+		slog.Warn("Failed to record download history", "task", t.Name, "err", err)
+	}
+}
+
+// historyCommand implements the 'history' subcommand.
+type historyCommand struct {
+	Task   string `long:"task" description:"Only list torrents added by this task"`
+	Search string `long:"search" description:"Only list torrents whose title, URL or infoHash contains this text"`
+	Limit  int    `long:"limit" description:"Maximum number of torrents listed" default:"50"`
+	Offset int    `long:"offset" description:"Number of most recent matching torrents skipped"`
+	Json   bool   `long:"json" description:"Print the torrents as JSON"`
+}
+
+func init() {
+	parser.AddCommand("history",
+		"List the torrents added",
+		"List the torrents added by all tasks, most recent first, with the feed and the reason they were added. "+
+			"Use --limit and --offset to page through the history.",
+		&historyCommand{})
+}
+
+// Execute prints the matching history entries.
+func (c *historyCommand) Execute(args []string) error {
+	store, err := NewHistoryStore()
+	if err != nil {
+		return err
+	}
+	entries, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	search := strings.ToLower(c.Search)
+	matched := []*HistoryEntry{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if c.Task != "" && entry.Task != c.Task {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(entry.Title), search) &&
+			!strings.Contains(strings.ToLower(entry.URL), search) && !strings.Contains(strings.Join(entry.InfoHashes, " "), search) {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+	matched = matched[min(max(c.Offset, 0), len(matched)):]
+	if c.Limit > 0 && len(matched) > c.Limit {
+		matched = matched[:c.Limit]
+	}
+	if c.Json {
+		return printJSON(matched)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tTASK\tTITLE\tREASON")
+	for _, entry := range matched {
+		reason := entry.Reason
+		if reason == "" {
+			reason = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.Time.Local().Format("2006-01-02 15:04"), entry.Task, entry.Title, reason)
+	}
+	return w.Flush()
+}
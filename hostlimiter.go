@@ -0,0 +1,96 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const defaultHostConcurrency = 2
+
+// HostLimiter bounds the number of simultaneous requests to the same host across all tasks, and optionally
+// their rate, so that many feeds or torrent files on the same tracker don't get the user banned.
+type HostLimiter struct {
+	mu    sync.Mutex
+	limit int
+	rate  float64 // requests per second, 0 for no limit
+	burst int     // requests allowed at once after the host was left alone
+	hosts map[string]*hostState
+}
+
+// hostState is the state of the requests to a host: a semaphore of the request slots and a token bucket.
+type hostState struct {
+	sem    chan struct{}
+	tokens float64 // negative when requests are waiting for tokens, guarded by HostLimiter.mu
+	last   time.Time
+}
+
+// NewHostLimiter returns a HostLimiter allowing limit simultaneous requests per host, and perMinute
+// requests per minute per host with bursts of burst requests, if perMinute is positive.
+func NewHostLimiter(limit int, perMinute float64, burst int) *HostLimiter {
+	if limit <= 0 {
+		limit = defaultHostConcurrency
+	}
+	return &HostLimiter{limit: limit, rate: max(perMinute, 0) / 60, burst: max(burst, 1), hosts: make(map[string]*hostState)}
+}
+
+// Acquire blocks until a request slot for the host of rawURL is available and the rate of the host allows
+// another request, or ctx is done. The returned function must be called to release the slot.
+func (l *HostLimiter) Acquire(ctx context.Context, rawURL string) (func(), error) {
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	l.mu.Lock()
+	state, exists := l.hosts[host]
+	if !exists {
+		state = &hostState{sem: make(chan struct{}, l.limit), tokens: float64(l.burst), last: time.Now()}
+		l.hosts[host] = state
+	}
+	delay := l.reserve(state)
+	l.mu.Unlock()
+
+	if delay > 0 {
+		feedLog.Debug("Waiting for the request rate of the host", "host", host, "delay", delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			l.mu.Lock()
+			state.tokens++
+			l.mu.Unlock()
+			return nil, ctx.Err()
+		}
+	}
+
+	select {
+	case state.sem <- struct{}{}:
+		return func() { <-state.sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// reserve takes a token of the bucket of the host and returns how long to wait until it is available.
+func (l *HostLimiter) reserve(state *hostState) time.Duration {
+	if l.rate == 0 {
+		return 0
+	}
+	now := time.Now()
+	state.tokens = min(state.tokens+now.Sub(state.last).Seconds()*l.rate, float64(l.burst))
+	state.last = now
+	state.tokens--
+	if state.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-state.tokens / l.rate * float64(time.Second))
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHostLimiterConcurrency(t *testing.T) {
+	l := NewHostLimiter(2, 0, 0)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	var wg sync.WaitGroup
+	for range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := l.Acquire(ctx, "http://tracker/rss?page=1")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			release()
+		}()
+	}
+	wg.Wait()
+	if peak != 2 {
+		t.Errorf("%d simultaneous requests to the same host, want 2", peak)
+	}
+
+	// The slots of a host don't hold up the others
+	var releases []func()
+	for range 2 {
+		release, err := l.Acquire(ctx, "http://tracker/a.torrent")
+		if err != nil {
+			t.Fatal(err)
+		}
+		releases = append(releases, release)
+	}
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(timeout, "http://tracker/b.torrent"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire() of a third slot = %v, want %v", err, context.DeadlineExceeded)
+	}
+	release, err := l.Acquire(ctx, "http://other/rss")
+	if err != nil {
+		t.Fatalf("Acquire() of another host failed: %v", err)
+	}
+	release()
+	for _, release := range releases {
+		release()
+	}
+}
+
+func TestHostLimiterRate(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	l := NewHostLimiter(10, float64(time.Minute/interval), 2)
+	ctx := context.Background()
+
+	start := time.Now()
+	acquire := func(n int) {
+		for range n {
+			release, err := l.Acquire(ctx, "http://tracker/rss")
+			if err != nil {
+				t.Fatal(err)
+			}
+			release()
+		}
+	}
+	// The burst goes through at once, the requests after it are spaced by the interval
+	acquire(2)
+	if elapsed := time.Since(start); elapsed >= interval {
+		t.Errorf("burst of 2 requests took %v, want less than %v", elapsed, interval)
+	}
+	acquire(3)
+	if elapsed := time.Since(start); elapsed < 3*interval-5*time.Millisecond || elapsed > 10*interval {
+		t.Errorf("5 requests took %v, want about %v", elapsed, 3*interval)
+	}
+
+	// A request given up returns its token
+	timeout, cancel := context.WithTimeout(ctx, interval/5)
+	defer cancel()
+	if _, err := l.Acquire(timeout, "http://tracker/rss"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	start = time.Now()
+	acquire(1)
+	if elapsed := time.Since(start); elapsed > interval+interval/2 {
+		t.Errorf("request after a cancelled one took %v, want at most %v", elapsed, interval)
+	}
+
+	// Other hosts have their own bucket
+	start = time.Now()
+	release, err := l.Acquire(ctx, "http://other/rss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if elapsed := time.Since(start); elapsed >= interval {
+		t.Errorf("request to another host took %v, want less than %v", elapsed, interval)
+	}
+}
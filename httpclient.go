@@ -0,0 +1,41 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// httpClient sends the requests to feeds, torrent files, notification channels, Sonarr and Radarr. Its
+// transport, shared by all tasks, keeps connections open to reuse them across fetches.
+var httpClient = &http.Client{}
+
+// setupHTTP configures the transport of httpClient from the command line options.
+func setupHTTP() {
+	httpClient.Transport = newHTTPTransport()
+}
+
+// newHTTPTransport returns a transport pooling connections as configured by the command line options.
+func newHTTPTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: opt.HTTPConnectTimeout, KeepAlive: 30 * time.Second}
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = opt.HTTPConnectTimeout
+	transport.MaxIdleConns = opt.HTTPMaxIdleConns
+	transport.MaxIdleConnsPerHost = opt.HTTPMaxIdleConnsPerHost
+	transport.MaxConnsPerHost = opt.HTTPMaxConnsPerHost
+	transport.IdleConnTimeout = opt.HTTPIdleTimeout
+	transport.ForceAttemptHTTP2 = !opt.HTTPNoHTTP2
+	if opt.HTTPNoHTTP2 {
+		// A non-nil empty map disables HTTP/2
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return transport
+}
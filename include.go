@@ -0,0 +1,197 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// includeKey is the top-level key listing further config files to load. It is not a task.
+const includeKey = "include"
+
+// configExtensions are the extensions of the files loaded from a config directory.
+var configExtensions = []string{".conf", ".yml", ".yaml"}
+
+// configFiles returns the files to load for the config path. A directory yields its config files in
+// lexical order, anything else is returned as is.
+func configFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		for _, e := range configExtensions {
+			if ext == e {
+				files = append(files, filepath.Join(path, entry.Name()))
+				break
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// configSource is the merged config of a config file or directory and of the files they include.
+type configSource struct {
+	Tasks           map[string]interface{}
+	Files           []string                  // files loaded, in order; watchlist files of the tasks are listed too
+	positions       map[string]*taskPosition  // task name -> where the task is defined
+	notifiers       map[string]*namedNotifier // notification channels by name
+	notifiersSource string                    // notifiers section, compared on reload by the tasks using it
+}
+
+// configLoader merges the tasks of a config file or directory and of the files they include.
+type configLoader struct {
+	*configSource
+	origins map[string]string   // task name -> file defining it
+	loaded  map[string]struct{} // absolute paths of files loaded, to break include cycles
+}
+
+// loadConfigFiles reads the config file or directory at path, following includes.
+// On error, the returned source still lists the files read.
+func loadConfigFiles(path string) (*configSource, error) {
+	l := &configLoader{
+		configSource: &configSource{
+			Tasks:     make(map[string]interface{}),
+			positions: make(map[string]*taskPosition),
+		},
+		origins: make(map[string]string),
+		loaded:  make(map[string]struct{}),
+	}
+	files, err := configFiles(path)
+	if err != nil {
+		return l.configSource, err
+	}
+	for _, file := range files {
+		if err := l.load(file); err != nil {
+			return l.configSource, err
+		}
+	}
+	if l.notifiers, l.notifiersSource, err = parseNotifiers(l.Tasks); err != nil {
+		return l.configSource, err
+	}
+	if err := applyDefaults(l.Tasks); err != nil {
+		return l.configSource, err
+	}
+	if err := resolveDownloaders(l.Tasks); err != nil {
+		return l.configSource, err
+	}
+	if err := resolveProfiles(l.Tasks); err != nil {
+		return l.configSource, err
+	}
+	if err := expandWatchlists(l.Tasks); err != nil {
+		return l.configSource, err
+	}
+	return l.configSource, nil
+}
+
+// load reads a single file into the merged config and then loads the files it includes.
+func (l *configLoader) load(filename string) error {
+	if abs, err := filepath.Abs(filename); err == nil {
+		if _, exists := l.loaded[abs]; exists {
+			return nil
+		}
+		l.loaded[abs] = struct{}{}
+	}
+	l.Files = append(l.Files, filename)
+
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var config map[string]interface{}
+	if err := yaml.Unmarshal(source, &config); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(source, &root); err == nil {
+		l.recordPositions(filename, &root)
+	}
+
+	includes, err := parseIncludes(config[includeKey], filepath.Dir(filename))
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	delete(config, includeKey)
+	for name, task := range config {
+		resolveSecretFiles(task, filepath.Dir(filename))
+		if task, ok := task.(map[string]interface{}); ok {
+			l.Files = append(l.Files, resolveWatchlists(task, filepath.Dir(filename))...)
+		}
+		if origin, exists := l.origins[name]; exists {
+			return fmt.Errorf("task '%s' defined in both %s and %s", name, origin, filename)
+		}
+		l.origins[name] = filename
+		l.Tasks[name] = task
+	}
+
+	for _, include := range includes {
+		if err := l.load(include); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseIncludes expands the include directive, a glob pattern or a list of them, relative to dir.
+func parseIncludes(value interface{}, dir string) ([]string, error) {
+	var patterns []string
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		patterns = []string{v}
+	case []interface{}:
+		for _, pattern := range v {
+			s, ok := pattern.(string)
+			if !ok {
+				return nil, errors.New("invalid 'include': must be a path or a list of paths")
+			}
+			patterns = append(patterns, s)
+		}
+	default:
+		return nil, errors.New("invalid 'include': must be a path or a list of paths")
+	}
+
+	var files []string
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'include' pattern '%s': %w", pattern, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return nil, fmt.Errorf("included file '%s' not found", pattern)
+		}
+		for _, match := range matches {
+			expanded, err := configFiles(match)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, expanded...)
+		}
+	}
+	return files, nil
+}
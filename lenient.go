@@ -0,0 +1,85 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/mmcdole/gofeed"
+	"golang.org/x/net/html/charset"
+)
+
+var utf8BOM = []byte("\ufeff")
+
+var xmlEncodingDecl = regexp.MustCompile(`^(\s*<\?xml[^>]*encoding=["'])([^"']+)(["'])`)
+
+// fetchFeedBody downloads the raw feed document and returns it along with its Content-Type header.
+func fetchFeedBody(ctx context.Context, url string, userAgent string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, "", gofeed.HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	return body, resp.Header.Get("Content-Type"), err
+}
+
+// recoverFeedBody tries to turn a malformed feed document into one the parser accepts.
+// The document is transcoded to UTF-8 based on its XML declaration or sniffed charset,
+// then invalid UTF-8 sequences and control characters not allowed in XML are dropped.
+func recoverFeedBody(body []byte, contentType string) []byte {
+	body = bytes.TrimPrefix(body, utf8BOM)
+
+	var name string
+	if m := xmlEncodingDecl.FindSubmatch(body); m != nil {
+		if enc, canonical := charset.Lookup(string(m[2])); enc != nil {
+			name = canonical
+			if name != "utf-8" {
+				if decoded, err := enc.NewDecoder().Bytes(body); err == nil {
+					body = decoded
+				}
+			}
+		}
+	}
+	if name == "" && !utf8.Valid(body) {
+		enc, canonical, _ := charset.DetermineEncoding(body, contentType)
+		if canonical != "utf-8" {
+			if decoded, err := enc.NewDecoder().Bytes(body); err == nil {
+				body = bytes.TrimPrefix(decoded, utf8BOM)
+			}
+		}
+	}
+	// The document is UTF-8 now, the parser must not transcode it again
+	body = xmlEncodingDecl.ReplaceAll(body, []byte("${1}utf-8${3}"))
+
+	return bytes.Map(func(r rune) rune {
+		switch {
+		case r == utf8.RuneError:
+			return -1
+		case r < 0x20 && r != '\t' && r != '\n' && r != '\r':
+			return -1
+		default:
+			return r
+		}
+	}, body)
+}
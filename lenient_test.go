@@ -0,0 +1,54 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestRecoverFeedBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		want        string
+	}{
+		{"valid", `<rss><title>a</title></rss>`, "", `<rss><title>a</title></rss>`},
+		{"bom", "\ufeff<rss/>", "", "<rss/>"},
+		{"control characters", "<title>a\x00b\x1bc\td</title>", "", "<title>abc\td</title>"},
+		{"invalid utf-8 declared", `<?xml version="1.0" encoding="UTF-8"?><title>a` + "\xff" + `b</title>`, "",
+			`<?xml version="1.0" encoding="utf-8"?><title>ab</title>`},
+		{"gbk declared", `<?xml version="1.0" encoding="gbk"?><title>` + "\xd6\xd0\xce\xc4" + `</title>`, "",
+			`<?xml version="1.0" encoding="utf-8"?><title>中文</title>`},
+		{"charset of content type", "<title>caf\xe9</title>", "text/xml; charset=iso-8859-1", "<title>café</title>"},
+		{"unknown declared encoding", `<?xml version='1.0' encoding='x-unknown'?><t>a` + "\x01" + `</t>`, "",
+			`<?xml version='1.0' encoding='utf-8'?><t>a</t>`},
+	}
+	for _, tt := range tests {
+		if got := string(recoverFeedBody([]byte(tt.body), tt.contentType)); got != tt.want {
+			t.Errorf("%s: recoverFeedBody(%q) = %q, want %q", tt.name, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestRecoverFeedBodyParses(t *testing.T) {
+	body := []byte(`<?xml version="1.0" encoding="big5"?><rss version="2.0"><channel><item><title>` +
+		"\xa4\xa4\xa4\xe5\x0c" + `</title></item></channel></rss>`)
+	if _, err := gofeed.NewParser().Parse(bytes.NewReader(body)); err == nil {
+		t.Fatal("the feed parsed before it was recovered")
+	}
+	feed, err := gofeed.NewParser().Parse(bytes.NewReader(recoverFeedBody(body, "")))
+	if err != nil {
+		t.Fatalf("the recovered feed failed to parse: %v", err)
+	}
+	if got := feed.Items[0].Title; got != "中文" {
+		t.Errorf("title = %q, want %q", got, "中文")
+	}
+}
@@ -0,0 +1,278 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// listCommand implements the 'list' subcommand.
+type listCommand struct {
+	Json bool   `long:"json" description:"Print the tasks as JSON"`
+	Tag  string `long:"tag" description:"Only list the tasks with this tag"`
+}
+
+// showCommand implements the 'show' subcommand.
+type showCommand struct {
+	Json bool `long:"json" description:"Print the task as JSON"`
+	Args struct {
+		Task string `positional-arg-name:"task" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+// TaskSummary is the printable form of a configured task. Credentials are left out.
+type TaskSummary struct {
+	Name       string             `json:"name"`
+	Tags       []string           `json:"tags,omitempty"`
+	RpcType    string             `json:"rpcType"`
+	Rpc        string             `json:"rpc"`
+	Feeds      []FeedSummary      `json:"feeds"`
+	Interval   string             `json:"interval,omitempty"`
+	Schedule   string             `json:"schedule,omitempty"`
+	Workers    int                `json:"workers"`
+	Jitter     int                `json:"jitter"`
+	Quiet      string             `json:"quiet"`
+	Approval   string             `json:"approval"`
+	Lenient    bool               `json:"lenient"`
+	Completed  string             `json:"completed,omitempty"`
+	Include    []string           `json:"include,omitempty"`
+	Exclude    []string           `json:"exclude,omitempty"`
+	Extracters []ExtracterSummary `json:"extracters,omitempty"`
+}
+
+// FeedSummary is the printable form of a feed of a task.
+type FeedSummary struct {
+	URL      string `json:"url"`
+	Interval string `json:"interval,omitempty"` // set if the feed overrides the task interval
+}
+
+// ExtracterSummary is the printable form of an extracter of a task.
+type ExtracterSummary struct {
+	Tag      string `json:"tag"`
+	Pattern  string `json:"pattern"`
+	Selector string `json:"selector,omitempty"`
+	Template string `json:"template,omitempty"`
+}
+
+func init() {
+	parser.AddCommand("list",
+		"List configured tasks",
+		"List the tasks of the config file with their RPC server, feeds, schedule and filters.",
+		&listCommand{})
+	parser.AddCommand("show",
+		"Show a configured task",
+		"Show all settings of a task of the config file.",
+		&showCommand{})
+}
+
+// Execute prints a table of all tasks.
+func (c *listCommand) Execute(args []string) error {
+	summaries, err := loadTaskSummaries()
+	if err != nil {
+		return err
+	}
+	if c.Tag != "" {
+		var tagged []TaskSummary
+		for _, s := range summaries {
+			for _, tag := range s.Tags {
+				if tag == c.Tag {
+					tagged = append(tagged, s)
+					break
+				}
+			}
+		}
+		summaries = tagged
+	}
+	if c.Json {
+		return printJSON(summaries)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTAGS\tRPC\tFEEDS\tSCHEDULE\tFILTER")
+	for _, s := range summaries {
+		schedule := s.Interval
+		if s.Schedule != "" {
+			schedule = s.Schedule
+		}
+		filter := fmt.Sprintf("+%d -%d", len(s.Include), len(s.Exclude))
+		for _, e := range s.Extracters {
+			filter += " extracter:" + e.Tag
+		}
+		tags := strings.Join(s.Tags, ",")
+		if tags == "" {
+			tags = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s %s\t%d\t%s\t%s\n", s.Name, tags, s.RpcType, s.Rpc, len(s.Feeds), schedule, filter)
+	}
+	return w.Flush()
+}
+
+// Execute prints all settings of one task.
+func (c *showCommand) Execute(args []string) error {
+	summaries, err := loadTaskSummaries()
+	if err != nil {
+		return err
+	}
+	var s *TaskSummary
+	for i := range summaries {
+		if summaries[i].Name == c.Args.Task {
+			s = &summaries[i]
+		}
+	}
+	if s == nil {
+		return errors.New("no such task: " + c.Args.Task)
+	}
+	if c.Json {
+		return printJSON(s)
+	}
+
+	fmt.Printf("name:      %s\n", s.Name)
+	if len(s.Tags) > 0 {
+		fmt.Printf("tags:      %s\n", strings.Join(s.Tags, ", "))
+	}
+	fmt.Printf("rpc:       %s %s\n", s.RpcType, s.Rpc)
+	if s.Schedule != "" {
+		fmt.Printf("schedule:  %s\n", s.Schedule)
+	} else {
+		fmt.Printf("interval:  %s\n", s.Interval)
+	}
+	fmt.Printf("workers:   %d\n", s.Workers)
+	fmt.Printf("jitter:    %d%%\n", s.Jitter)
+	fmt.Printf("quiet:     %s\n", s.Quiet)
+	fmt.Printf("approval:  %s\n", s.Approval)
+	fmt.Printf("lenient:   %t\n", s.Lenient)
+	if s.Completed != "" {
+		fmt.Printf("completed: %s\n", s.Completed)
+	}
+	fmt.Println("feeds:")
+	for _, feed := range s.Feeds {
+		if feed.Interval != "" {
+			fmt.Printf("  - %s (every %s)\n", feed.URL, feed.Interval)
+		} else {
+			fmt.Printf("  - %s\n", feed.URL)
+		}
+	}
+	printList("include:", s.Include)
+	printList("exclude:", s.Exclude)
+	for _, e := range s.Extracters {
+		line := "extracter: " + e.Tag
+		if e.Selector != "" {
+			line += fmt.Sprintf(" selector %q", e.Selector)
+		}
+		if e.Pattern != "" {
+			line += fmt.Sprintf(" %q", e.Pattern)
+		}
+		if e.Template != "" {
+			line += fmt.Sprintf(" -> %q", e.Template)
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+// loadTaskSummaries loads the config file given by --conf and returns its tasks sorted by name.
+func loadTaskSummaries() ([]TaskSummary, error) {
+	tasks, err := LoadConfig(opt.Config)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyGlobalOptions(tasks); err != nil {
+		return nil, err
+	}
+
+	summaries := make([]TaskSummary, 0, len(*tasks))
+	for _, t := range *tasks {
+		summaries = append(summaries, summarizeTask(t))
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+	return summaries, nil
+}
+
+// summarizeTask converts a task into its printable form.
+func summarizeTask(t *Task) TaskSummary {
+	s := TaskSummary{
+		Name:      t.Name,
+		Tags:      t.Tags,
+		RpcType:   t.ServerConfig.RpcType,
+		Rpc:       redactedEndpoint(t.ServerConfig),
+		Workers:   t.FetchWorkers,
+		Jitter:    t.Jitter,
+		Quiet:     t.Quiet.String(),
+		Approval:  "auto",
+		Lenient:   t.parserConfig.Lenient,
+		Completed: t.CompletedDir,
+		Include:   t.parserConfig.Include,
+		Exclude:   t.parserConfig.Exclude,
+	}
+	if t.ScheduleSpec != "" {
+		s.Schedule = t.ScheduleSpec
+	} else {
+		s.Interval = t.FetchInterval.String()
+	}
+	if t.ManualApproval {
+		s.Approval = "manual"
+		if t.ApprovalExpiry > 0 {
+			s.Approval += fmt.Sprintf(" (expire after %d days)", int(t.ApprovalExpiry.Hours()/24))
+		}
+	}
+	for _, feedUrl := range t.FeedUrls {
+		feed := FeedSummary{URL: feedUrl}
+		if interval, ok := t.FeedIntervals[feedUrl]; ok {
+			feed.Interval = interval.String()
+		}
+		s.Feeds = append(s.Feeds, feed)
+	}
+	for _, e := range t.parserConfig.Extracters {
+		s.Extracters = append(s.Extracters, ExtracterSummary{Tag: e.Tag, Selector: e.Selector, Pattern: e.Pattern, Template: e.Template})
+	}
+	return s
+}
+
+// redactedEndpoint returns the RPC endpoint of the server without credentials.
+func redactedEndpoint(sc ServerConfig) string {
+	switch sc.RpcType {
+	case "aria2c", "sonarr", "radarr":
+		if u, err := url.Parse(sc.Url); err == nil {
+			return u.Redacted()
+		}
+		return sc.Url
+	case "transmission":
+		endpoint := sc.Host + ":" + strconv.Itoa(int(sc.Port))
+		if sc.Username != "" {
+			endpoint = sc.Username + "@" + endpoint
+		}
+		return endpoint
+	default:
+		return ""
+	}
+}
+
+// printJSON prints v as indented JSON to stdout.
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// printList prints a labeled list, one item per line, or nothing if the list is empty.
+func printList(label string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Println(label)
+	for _, item := range items {
+		fmt.Printf("  - %s\n", strings.TrimSpace(item))
+	}
+}
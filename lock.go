@@ -0,0 +1,100 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const lockFileName = ".cache/at-rss.lock"
+
+// errLockHeld is returned by AcquireLock when another live instance holds the lock.
+var errLockHeld = errors.New("another instance is running")
+
+// Lock is a PID file preventing two at-rss instances from sharing the same cache.
+type Lock struct {
+	filePath string
+}
+
+// AcquireLock creates the lock file next to the cache. If another live instance holds the lock,
+// it returns an error unless force is true. A lock left behind by a dead process is taken over.
+func AcquireLock(force bool) (*Lock, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		slog.Error("Failed to locate user's home directory.", "err", err)
+		return nil, err
+	}
+	l := &Lock{filePath: filepath.Join(homeDir, lockFileName)}
+	if err := os.MkdirAll(filepath.Dir(l.filePath), 0744); err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(l.filePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, err = file.WriteString(strconv.Itoa(os.Getpid()))
+			file.Close()
+			return l, err
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		if pid := l.owner(); pid > 0 && pid != os.Getpid() && processAlive(pid) {
+			if !force {
+				return nil, fmt.Errorf("%w (pid %d), lock file: %s", errLockHeld, pid, l.filePath)
+			}
+			slog.Warn("Taking over lock held by another instance.", "pid", pid)
+		}
+		if err := os.Remove(l.filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, errors.New("failed to acquire lock file: " + l.filePath)
+}
+
+// Release removes the lock file if it is still owned by this process.
+func (l *Lock) Release() {
+	if l.owner() == os.Getpid() {
+		os.Remove(l.filePath)
+	}
+}
+
+// owner returns the PID recorded in the lock file, or 0 if it cannot be read.
+func (l *Lock) owner() int {
+	content, err := os.ReadFile(l.filePath)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// processAlive reports whether a process with the given PID exists.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// On Windows FindProcess already fails for missing processes and signals are not supported.
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
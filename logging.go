@@ -0,0 +1,204 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Components whose level may be set apart from --log-level with --log-component-level.
+const (
+	logComponentFeed = "feed" // fetching and parsing feeds, extracting torrents
+	logComponentRPC  = "rpc"  // talking to the downloaders
+)
+
+var logComponents = []string{logComponentFeed, logComponentRPC}
+
+// Loggers of the components, replaced by setupLogging.
+var (
+	feedLog = slog.Default().With("component", logComponentFeed)
+	rpcLog  = slog.Default().With("component", logComponentRPC)
+)
+
+// setupLogging installs the default logger configured by the --log-* flags. Records of a component
+// are kept if their level reaches the level of the component, or --log-level for other records.
+func setupLogging() error {
+	level, err := parseLogLevel(opt.LogLevel)
+	if err != nil {
+		return err
+	}
+	levels := make(map[string]slog.Level, len(opt.LogComponentLevels))
+	for component, name := range opt.LogComponentLevels {
+		if !slices.Contains(logComponents, component) {
+			return fmt.Errorf("invalid component '%s' in --log-component-level: must be one of %s", component, strings.Join(logComponents, ", "))
+		}
+		if levels[component], err = parseLogLevel(name); err != nil {
+			return err
+		}
+	}
+
+	var w io.Writer = os.Stderr
+	if opt.LogFile != "" {
+		file, err := openRotatingFile(opt.LogFile, int64(opt.LogMaxSize)<<20, opt.LogMaxAge, opt.LogMaxBackups)
+		if err != nil {
+			return err
+		}
+		w = file
+	}
+	// The component handler filters records, the inner handler keeps all it is given
+	options := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var inner slog.Handler = slog.NewTextHandler(w, options)
+	if opt.LogFormat == "json" {
+		inner = slog.NewJSONHandler(w, options)
+	}
+
+	logger := slog.New(&componentHandler{Handler: inner, level: level, levels: levels})
+	slog.SetDefault(logger)
+	feedLog = logger.With("component", logComponentFeed)
+	rpcLog = logger.With("component", logComponentRPC)
+	return nil
+}
+
+// parseLogLevel parses a level name: debug, info, warn or error.
+func parseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("invalid log level '%s': must be debug, info, warn or error", name)
+	}
+	return level, nil
+}
+
+// componentHandler drops the records below the level of their component.
+type componentHandler struct {
+	slog.Handler
+	level     slog.Level            // Level of records without a component
+	levels    map[string]slog.Level // Levels by component
+	component string                // Component of the logger the handler belongs to, set by With
+}
+
+// Enabled reports whether a record of the level reaches the level of the component.
+func (h *componentHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	threshold, exists := h.levels[h.component]
+	if !exists {
+		threshold = h.level
+	}
+	return level >= threshold
+}
+
+// WithAttrs returns a handler with the attributes, taking the component from them if given.
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	for _, attr := range attrs {
+		if attr.Key == "component" {
+			c.component = attr.Value.String()
+		}
+	}
+	c.Handler = h.Handler.WithAttrs(attrs)
+	return &c
+}
+
+// WithGroup returns a handler with the group.
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.Handler = h.Handler.WithGroup(name)
+	return &c
+}
+
+// rotatingFile is a log file renamed to path.1 once it exceeds maxSize bytes or is older than maxAge,
+// earlier ones becoming path.2 and so on. Only maxBackups renamed files are kept.
+type rotatingFile struct {
+	path       string
+	maxSize    int64         // 0 for no limit
+	maxAge     time.Duration // 0 for no limit
+	maxBackups int
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	started time.Time // When the current file was started
+}
+
+// openRotatingFile opens the log file at path, appending to it.
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*rotatingFile, error) {
+	if maxSize < 0 || maxAge < 0 || maxBackups < 0 {
+		return nil, errors.New("invalid log rotation: --log-max-size, --log-max-age and --log-max-backups can't be negative")
+	}
+	r := &rotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens the current file. A file left by an earlier run was started when the previous one was rotated.
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file, r.size, r.started = file, info.Size(), time.Now()
+	if r.size > 0 {
+		if backup, err := os.Stat(r.path + ".1"); err == nil {
+			r.started = backup.ModTime()
+		}
+	}
+	return nil
+}
+
+// Write appends p to the current file, rotating it first if needed.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.size > 0 && ((r.maxSize > 0 && r.size+int64(len(p)) > r.maxSize) || (r.maxAge > 0 && time.Since(r.started) > r.maxAge)) {
+		if err := r.rotate(); err != nil {
+			// Keep logging to the current file rather than losing records
+			fmt.Fprintln(os.Stderr, "Failed to rotate log file:", err)
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate renames the current file to path.1, shifting the older ones, and starts a new file.
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	if r.maxBackups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", r.path, r.maxBackups))
+		for i := r.maxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		}
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			r.open()
+			return err
+		}
+	} else if err := os.Truncate(r.path, 0); err != nil {
+		r.open()
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.started = time.Now()
+	return nil
+}
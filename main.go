@@ -20,17 +20,88 @@ import (
 )
 
 type options struct {
-	Config string `short:"c" long:"conf" description:"Config file" default:"/etc/at-rss.conf"`
+	Config          string        `short:"c" long:"conf" description:"Config file or directory of config files" default:"/etc/at-rss.conf"`
+	DegradedAfter   int           `long:"degraded-after" description:"Consecutive fetch failures before a feed is marked degraded" default:"3"`
+	HostConcurrency int           `long:"host-concurrency" description:"Maximum simultaneous downloads of feeds and torrent files per host across all tasks" default:"2"`
+	HostRate        float64       `long:"host-rate" description:"Maximum downloads of feeds and torrent files per minute per host across all tasks, 0 for no limit" default:"0"`
+	HostBurst       int           `long:"host-burst" description:"Downloads allowed at once per host before --host-rate applies" default:"5"`
+	MaxTorrentSize  int           `long:"max-torrent-size" description:"Size in MB above which a torrent file is not downloaded, 0 for no limit" default:"10"`
+	Force           bool          `long:"force" description:"Start even if another instance holds the lock"`
+	QuietHours      string        `long:"quiet-hours" description:"Daily window for all tasks without downloads, e.g. 01:00-07:00"`
+	QuietMode       string        `long:"quiet-mode" description:"Skip fetches or add torrents paused during quiet hours" choice:"skip" choice:"pause" default:"skip"`
+	Jitter          int           `long:"jitter" description:"Random deviation in percent applied to each fetch delay of all tasks" default:"0"`
+	CatchUp         bool          `long:"catch-up" description:"Fetch feeds missed while the system was suspended once after resume"`
+	WaitDownloader  time.Duration `long:"wait-downloader" description:"Delay the first fetch of each task until its downloader responds, for at most this long, e.g. 5m"`
+	Once            bool          `long:"once" description:"Fetch all tasks once and exit; exit code 2: invalid config, 3: feed errors, 4: add errors, 5: both"`
+	Summary         string        `long:"summary" description:"File to write the JSON run summary of --once to, '-' for stdout" default:"-"`
+	Tag             string        `long:"tag" description:"With --once, only fetch the tasks with this tag"`
+	OTLPEndpoint    string        `long:"otlp-endpoint" description:"OTLP/HTTP collector to export traces of the fetches to, e.g. http://localhost:4318"`
+	Redis           string        `long:"redis" description:"Redis URL to keep the cache in, shared with other instances, e.g. redis://host:6379/0"`
+
+	HTTPConnectTimeout      time.Duration `long:"http-connect-timeout" description:"Timeout of connecting to a server, TLS handshake included" default:"10s"`
+	HTTPMaxIdleConns        int           `long:"http-max-idle-conns" description:"Maximum idle connections kept open for reuse across all hosts, 0 for no limit" default:"100"`
+	HTTPMaxIdleConnsPerHost int           `long:"http-max-idle-conns-per-host" description:"Maximum idle connections kept open for reuse per host" default:"4"`
+	HTTPMaxConnsPerHost     int           `long:"http-max-conns-per-host" description:"Maximum connections per host, 0 for no limit" default:"0"`
+	HTTPIdleTimeout         time.Duration `long:"http-idle-timeout" description:"Time an idle connection is kept open" default:"90s"`
+	HTTPNoHTTP2             bool          `long:"http-no-http2" description:"Don't use HTTP/2 with servers supporting it"`
+
+	LogLevel           string            `long:"log-level" description:"Minimum level of the records logged" choice:"debug" choice:"info" choice:"warn" choice:"error" default:"info"`
+	LogComponentLevels map[string]string `long:"log-component-level" description:"Minimum level of the records of a component, feed or rpc, e.g. rpc:debug; may be repeated"`
+	LogFormat          string            `long:"log-format" description:"Format of the records" choice:"text" choice:"json" default:"text"`
+	LogFile            string            `long:"log-file" description:"File to log to instead of stderr"`
+	LogMaxSize         int               `long:"log-max-size" description:"Size in MB at which the log file is rotated, 0 for no limit" default:"10"`
+	LogMaxAge          time.Duration     `long:"log-max-age" description:"Age at which the log file is rotated, e.g. 24h; 0 for no limit"`
+	LogMaxBackups      int               `long:"log-max-backups" description:"Number of rotated log files kept" default:"3"`
 }
 
 var opt options
-var parser = flags.NewParser(&opt, flags.Default)
+var parser = newParser()
+
+// newParser returns the command line parser. Subcommands are registered by their own files.
+func newParser() *flags.Parser {
+	p := flags.NewParser(&opt, flags.Default)
+	p.SubcommandsOptional = true
+	// Log as configured by the flags, also in subcommands
+	p.CommandHandler = func(command flags.Commander, args []string) error {
+		if err := setupLogging(); err != nil {
+			return err
+		}
+		setupHTTP()
+		if command == nil {
+			return nil
+		}
+		return command.Execute(args)
+	}
+	return p
+}
 
 func main() {
 	// Parse command line arguments
 	if _, err := parser.Parse(); err != nil {
 		handleFlagsError(err)
 	}
+	// A subcommand has been executed, don't start the daemon
+	if parser.Active != nil {
+		return
+	}
+
+	// Prevent another instance from working on the same cache
+	lock, err := AcquireLock(opt.Force)
+	if err != nil {
+		slog.Error("Can't acquire lock.", "err", err)
+		os.Exit(1)
+	}
+	defer lock.Release()
+
+	shutdownTracing := setupTracing(opt.OTLPEndpoint)
+	defer shutdownTracing()
+
+	if opt.Once {
+		code := once()
+		shutdownTracing()
+		lock.Release()
+		os.Exit(code)
+	}
 
 	// Init watcher for reload configure files
 	watcher, err := fsnotify.NewWatcher()
@@ -38,9 +109,8 @@ func main() {
 		os.Exit(1)
 	}
 	defer watcher.Close()
-	err = watcher.Add(opt.Config)
-	if err != nil {
-		slog.Error("Can't watch configure file.")
+	if err := watchConfig(watcher); err != nil {
+		slog.Error("Can't watch configure file.", "err", err)
 		os.Exit(1)
 	}
 
@@ -50,6 +120,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Init feed health tracking, kept across configure reloads
+	health := NewFeedHealth(opt.DegradedAfter)
+	hosts := NewHostLimiter(opt.HostConcurrency, opt.HostRate, opt.HostBurst)
+	pending, err := NewPendingStore()
+	if err != nil {
+		os.Exit(1)
+	}
+
 	// Handle termination signals
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
@@ -59,26 +137,58 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Running tasks by name, kept across configure reloads unless their section changed
+	running := make(map[string]*runningTask)
+	var mu sync.Mutex
+
 	// Function to manage tasks
-	at_rss := func(ctx context.Context) {
+	at_rss := func() {
 		tasks, err := LoadConfig(opt.Config)
 		if err != nil {
 			os.Exit(1)
 		}
+		if err := applyGlobalOptions(tasks); err != nil {
+			slog.Error("Flag parsing error", "error", err)
+			os.Exit(1)
+		}
 		if len(*tasks) == 0 {
 			slog.Warn("No task is running.")
 		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		// Stop tasks that were removed or changed
+		configured := make(map[string]*Task, len(*tasks))
+		for _, task := range *tasks {
+			configured[task.Name] = task
+		}
+		for name, rt := range running {
+			if task, ok := configured[name]; ok && task.source == rt.source {
+				continue
+			}
+			rt.cancel()
+			<-rt.done
+			delete(running, name)
+			slog.Info("Stopped task", "task", name)
+		}
 		// Start tasks in separate goroutines
 		for _, task := range *tasks {
+			if _, ok := running[task.Name]; ok {
+				continue
+			}
+			taskCtx, taskCancel := context.WithCancel(ctx)
+			rt := &runningTask{source: task.source, cancel: taskCancel, done: make(chan struct{})}
+			running[task.Name] = rt
 			wg.Add(1)
 			go func(task *Task) {
 				defer wg.Done()
-				task.Start(ctx, cache)
+				defer close(rt.done)
+				task.Start(taskCtx, cache, health, hosts, pending)
 			}(task)
 			time.Sleep(5 * time.Second) // Optional delay between starting tasks
 		}
 	}
-	at_rss(ctx)
+	at_rss()
 
 	var debounceTimer *time.Timer
 	debounceDuration := 5 * time.Second
@@ -87,21 +197,24 @@ func main() {
 		case <-stop: // termination signals
 			cancel()
 			wg.Wait()
+			waitNotifications()
+			rpcClients.closeAll()
 			return
 		case event, ok := <-watcher.Events: // reload configure file when changed
 			if !ok {
 				slog.Error("Configure file watching error", "error:", err)
 				return
 			}
-			if event.Has(fsnotify.Write) {
+			if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) || event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
 				// debounce
 				if debounceTimer == nil {
 					debounceTimer = time.AfterFunc(debounceDuration, func() {
 						slog.Info("Reloading configure file...")
-						cancel()
-						wg.Wait()
-						ctx, cancel = context.WithCancel(context.Background())
-						at_rss(ctx)
+						at_rss()
+						// Files may have been added to the directory or included
+						if err := watchConfig(watcher); err != nil {
+							slog.Warn("Can't watch configure file.", "err", err)
+						}
 						debounceTimer = nil
 						slog.Info("Configure file reloaded.")
 					})
@@ -113,10 +226,81 @@ func main() {
 	}
 }
 
+// watchConfig adds the config file, or the config directory and its files, and the included files to the watcher.
+func watchConfig(watcher *fsnotify.Watcher) error {
+	src, err := loadConfigFiles(opt.Config)
+	files := src.Files
+	if info, statErr := os.Stat(opt.Config); statErr == nil && info.IsDir() {
+		files = append(files, opt.Config)
+	} else if err != nil {
+		return err
+	}
+	watched := make(map[string]struct{})
+	for _, path := range watcher.WatchList() {
+		watched[path] = struct{}{}
+	}
+	for _, file := range files {
+		if _, exists := watched[file]; exists {
+			continue
+		}
+		if err := watcher.Add(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runningTask tracks a started task so that a reload can tell whether it must be restarted.
+type runningTask struct {
+	source string // Task section of the config file the task was started with
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// once runs all tasks a single time with --once and returns the exit code.
+func once() int {
+	cache, err := NewCache()
+	if err != nil {
+		return 1
+	}
+	pending, err := NewPendingStore()
+	if err != nil {
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return runOnce(ctx, cache, NewFeedHealth(opt.DegradedAfter), NewHostLimiter(opt.HostConcurrency, opt.HostRate, opt.HostBurst), pending)
+}
+
+// applyGlobalOptions applies the command line options to the tasks that don't override them.
+func applyGlobalOptions(tasks *Tasks) error {
+	var quiet *QuietHours
+	if opt.QuietHours != "" {
+		var err error
+		if quiet, err = ParseQuietHours(opt.QuietHours, opt.QuietMode); err != nil {
+			return err
+		}
+	}
+	for _, task := range *tasks {
+		if task.Quiet == nil {
+			task.Quiet = quiet
+		}
+		task.CatchUp = opt.CatchUp
+		task.WaitDownloader = opt.WaitDownloader
+		if task.Jitter < 0 {
+			task.Jitter = min(max(opt.Jitter, 0), 100)
+		}
+	}
+	return nil
+}
+
 // handleFlagsError processes errors from flag parsing
 func handleFlagsError(err error) {
 	if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
 		os.Exit(0)
+	} else if !ok {
+		// Errors returned by a subcommand have already been printed by the parser
+		os.Exit(1)
 	} else {
 		slog.Error("Flag parsing error", "error", err)
 		os.Exit(1)
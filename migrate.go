@@ -0,0 +1,180 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// migrateCommand implements the 'migrate' subcommand.
+type migrateCommand struct {
+	Output string `short:"o" long:"output" description:"File to write the migrated config to" required:"yes"`
+	Args   struct {
+		Input string `positional-arg-name:"file" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	parser.AddCommand("migrate",
+		"Convert a config file to the current format",
+		"Move the aria2c and transmission sections of the tasks into a 'downloaders' section, "+
+			"identical servers being defined once, and rename legacy keys. The result is written to a new file; "+
+			"anything that could not be mapped is reported and left as is. Included files are not migrated.",
+		&migrateCommand{})
+}
+
+// legacyKeys maps keys of older versions to their current name.
+var legacyKeys = map[string]string{
+	"extractor": "extracter",
+}
+
+// Execute migrates the input file and writes the result to the output file.
+func (c *migrateCommand) Execute(args []string) error {
+	if _, err := os.Stat(c.Output); err == nil {
+		return errors.New("output file exists: " + c.Output)
+	}
+	data, err := os.ReadFile(c.Args.Input)
+	if err != nil {
+		return err
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return err
+	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return errors.New("not a config file: " + c.Args.Input)
+	}
+
+	report := migrateConfig(root.Content[0])
+	for _, line := range report {
+		fmt.Println(line)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(4)
+	if err := encoder.Encode(&root); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(c.Output, buf.Bytes(), 0644)
+}
+
+// migrateConfig rewrites the top-level mapping of a config file in place and returns a report of the changes
+// and of the keys it could not map.
+func migrateConfig(mapping *yaml.Node) []string {
+	var report []string
+	reserved := map[string]bool{includeKey: true, defaultsKey: true, downloadersKey: true, profilesKey: true, notifiersKey: true}
+
+	// Servers already defined keep their names
+	var downloaders *yaml.Node
+	names := make(map[string]string) // marshaled server section -> downloader name
+	used := make(map[string]bool)
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == downloadersKey && mapping.Content[i+1].Kind == yaml.MappingNode {
+			downloaders = mapping.Content[i+1]
+			for j := 0; j+1 < len(downloaders.Content); j += 2 {
+				used[downloaders.Content[j].Value] = true
+				if source, err := yaml.Marshal(downloaders.Content[j+1]); err == nil {
+					names[string(source)] = downloaders.Content[j].Value
+				}
+			}
+		}
+	}
+	var added []*yaml.Node
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		name, task := mapping.Content[i].Value, mapping.Content[i+1]
+		if reserved[name] {
+			continue
+		}
+		if task.Kind != yaml.MappingNode {
+			report = append(report, fmt.Sprintf("task '%s': not a task, left as is", name))
+			continue
+		}
+		for j := 0; j+1 < len(task.Content); j += 2 {
+			key, value := task.Content[j], task.Content[j+1]
+			if current, exists := legacyKeys[strings.ToLower(key.Value)]; exists {
+				report = append(report, fmt.Sprintf("task '%s': renamed '%s' to '%s'", name, key.Value, current))
+				key.Value = current
+				continue
+			}
+			rpcType := strings.ToLower(key.Value)
+			if rpcType != "aria2c" && rpcType != "transmission" {
+				continue
+			}
+			// The server is keyed by its type so both kinds with the same settings stay apart
+			server := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Tag: "!!str", Value: rpcType}, value,
+			}}
+			source, err := yaml.Marshal(server)
+			if err != nil {
+				report = append(report, fmt.Sprintf("task '%s': %s section not migrated: %v", name, key.Value, err))
+				continue
+			}
+			ref, exists := names[string(source)]
+			if !exists {
+				ref = rpcType
+				for n := 2; used[ref]; n++ {
+					ref = fmt.Sprintf("%s-%d", rpcType, n)
+				}
+				used[ref] = true
+				names[string(source)] = ref
+				added = append(added, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: ref}, server)
+			}
+			report = append(report, fmt.Sprintf("task '%s': %s section moved to downloader '%s'", name, key.Value, ref))
+			task.Content[j] = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "downloader", HeadComment: key.HeadComment}
+			task.Content[j+1] = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: ref}
+		}
+		report = append(report, unmappedKeys(name, task)...)
+	}
+
+	if len(added) > 0 {
+		if downloaders == nil {
+			downloaders = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			section := []*yaml.Node{{Kind: yaml.ScalarNode, Tag: "!!str", Value: downloadersKey}, downloaders}
+			// Keep the includes first
+			at := 0
+			if len(mapping.Content) >= 2 && mapping.Content[0].Value == includeKey {
+				at = 2
+			} else if len(mapping.Content) > 0 {
+				// The comment heading the file stays at the top
+				section[0].HeadComment, mapping.Content[0].HeadComment = mapping.Content[0].HeadComment, ""
+			}
+			mapping.Content = append(mapping.Content[:at], append(section, mapping.Content[at:]...)...)
+		}
+		downloaders.Content = append(downloaders.Content, added...)
+	}
+	return report
+}
+
+// unmappedKeys reports the problems of the migrated task that the current config schema rejects.
+func unmappedKeys(name string, task *yaml.Node) []string {
+	var section map[string]interface{}
+	if err := task.Decode(&section); err != nil {
+		return []string{fmt.Sprintf("task '%s': %v", name, err)}
+	}
+	// References are resolved before tasks are checked
+	for _, key := range []string{"downloader", "downloaders", "profile", watchlistKey} {
+		if k, exists := lookupKey(section, key); exists {
+			delete(section, k)
+		}
+	}
+	var report []string
+	for _, problem := range checkTask(section) {
+		report = append(report, fmt.Sprintf("task '%s': could not map: %s", name, problem.message))
+	}
+	return report
+}
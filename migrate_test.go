@@ -0,0 +1,125 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// baselineConfig is a config file in the format of the first releases, with the servers in the tasks.
+const baselineConfig = `# Anime feeds
+anime:
+    aria2c:
+        url: "ws://nas:6800/jsonrpc"
+        token: "abcd"
+    feed:
+        - http://example.com/anime
+    extractor:
+        tag: link
+        pattern: "btih:(\\w+)"
+    interval: 30
+
+drama:
+    aria2c:
+        url: "ws://nas:6800/jsonrpc"
+        token: "abcd"
+    feed: http://example.com/drama
+    filter:
+        include:
+            - "1080p"
+
+movies:
+    transmission:
+        host: nas
+        port: 9091
+    feed: http://example.com/movies
+`
+
+func TestMigrate(t *testing.T) {
+	dir := t.TempDir()
+	input, output := filepath.Join(dir, "at-rss.conf"), filepath.Join(dir, "migrated.conf")
+	if err := os.WriteFile(input, []byte(baselineConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &migrateCommand{Output: output}
+	c.Args.Input = input
+	if err := c.Execute(nil); err != nil {
+		t.Fatalf("Execute() failed: %v", err)
+	}
+	if err := c.Execute(nil); err == nil || !strings.Contains(err.Error(), "output file exists") {
+		t.Errorf("Execute() over an existing file = %v, want an error", err)
+	}
+
+	migrated, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := yaml.Unmarshal(migrated, &got); err != nil {
+		t.Fatal(err)
+	}
+	type section = map[string]interface{}
+	want := map[string]interface{}{
+		downloadersKey: section{
+			"aria2c":       section{"aria2c": section{"url": "ws://nas:6800/jsonrpc", "token": "abcd"}},
+			"transmission": section{"transmission": section{"host": "nas", "port": 9091}},
+		},
+		"anime": section{
+			"downloader": "aria2c",
+			"feed":       []interface{}{"http://example.com/anime"},
+			"extracter":  section{"tag": "link", "pattern": `btih:(\w+)`},
+			"interval":   30,
+		},
+		"drama":  section{"downloader": "aria2c", "feed": "http://example.com/drama", "filter": section{"include": []interface{}{"1080p"}}},
+		"movies": section{"downloader": "transmission", "feed": "http://example.com/movies"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("migrated config = %v, want %v", got, want)
+	}
+	if !strings.HasPrefix(string(migrated), "# Anime feeds\n"+downloadersKey+":") {
+		t.Errorf("migrated config doesn't start with the comment heading the file and the downloaders:\n%s", migrated)
+	}
+
+	// The migrated config loads to the same servers
+	tasks, err := LoadConfig(output)
+	if err != nil {
+		t.Fatalf("LoadConfig() of the migrated config failed: %v", err)
+	}
+	servers := make(map[string]ServerConfig)
+	for _, task := range *tasks {
+		servers[task.Name] = task.ServerConfig
+	}
+	aria2c := ServerConfig{RpcType: "aria2c", Url: "ws://nas:6800/jsonrpc", Token: "abcd"}
+	wantServers := map[string]ServerConfig{"anime": aria2c, "drama": aria2c, "movies": {RpcType: "transmission", Host: "nas", Port: 9091}}
+	if !reflect.DeepEqual(servers, wantServers) {
+		t.Errorf("servers of the migrated tasks = %+v, want %+v", servers, wantServers)
+	}
+
+	// Migrating again changes nothing
+	var root yaml.Node
+	if err := yaml.Unmarshal(migrated, &root); err != nil {
+		t.Fatal(err)
+	}
+	if report := migrateConfig(root.Content[0]); len(report) > 0 {
+		t.Errorf("second migrateConfig() reported %q, want nothing", report)
+	}
+	again := filepath.Join(dir, "again.conf")
+	c = &migrateCommand{Output: again}
+	c.Args.Input = output
+	if err := c.Execute(nil); err != nil {
+		t.Fatalf("second Execute() failed: %v", err)
+	}
+	if remigrated, err := os.ReadFile(again); err != nil || string(remigrated) != string(migrated) {
+		t.Errorf("second migration = %q, %v, want %q", remigrated, err, migrated)
+	}
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/liuzl/gocc"
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+// normalizeKeys are the keys of the normalize section.
+var normalizeKeys = []string{"chinese", "width", "kana"}
+
+// textNormalizer brings titles and filter keywords to the same form, so that keywords match regardless of
+// case, Chinese script, character width and Japanese syllabary.
+type textNormalizer struct {
+	cc    *gocc.OpenCC // Chinese converter, nil if conversion is off or unavailable
+	width bool         // Fold full-width letters, digits and punctuation to half-width
+	kana  bool         // Fold half-width katakana to full-width and hiragana to katakana
+}
+
+var (
+	convertersMu sync.Mutex
+	converters   = make(map[string]*gocc.OpenCC) // Chinese converters by mode, shared by the tasks
+)
+
+// converter returns the shared Chinese converter of the mode, or nil if it can't be initialized.
+func converter(mode string) *gocc.OpenCC {
+	convertersMu.Lock()
+	defer convertersMu.Unlock()
+	if cc, exists := converters[mode]; exists {
+		return cc
+	}
+	cc, err := gocc.New(mode)
+	if err != nil {
+		slog.Warn("Failed to initialize Chinese converter.", "mode", mode, "err", err)
+		cc = nil
+	}
+	converters[mode] = cc
+	return cc
+}
+
+// parseNormalizeConfig processes the normalize section of a task. cc is the default converter,
+// used when the section doesn't choose another conversion.
+func parseNormalizeConfig(v interface{}, cc *gocc.OpenCC) (*textNormalizer, error) {
+	n := &textNormalizer{cc: cc}
+	section, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid 'normalize': must be a map")
+	}
+	if mode, exists := section["chinese"]; exists {
+		switch mode := strings.ToLower(convertToString(mode)); mode {
+		case "t2s":
+		case "s2t":
+			n.cc = converter(mode)
+		case "off", "false":
+			n.cc = nil
+		default:
+			return nil, errors.New("invalid 'chinese' in normalize: must be t2s, s2t or off")
+		}
+	}
+	n.width = getBoolOrDefault(section["width"], false)
+	n.kana = getBoolOrDefault(section["kana"], false)
+	return n, nil
+}
+
+// costly returns whether normalizing a text does more than lowercasing it, so that results are worth memoizing.
+func (n *textNormalizer) costly() bool {
+	return n != nil && (n.cc != nil || n.width || n.kana)
+}
+
+// Normalize returns the normalized form of text. A nil textNormalizer only lowercases.
+func (n *textNormalizer) Normalize(text string) string {
+	if n == nil {
+		return strings.ToLower(text)
+	}
+	if n.kana && strings.ContainsFunc(text, isHalfwidthKana) {
+		var b strings.Builder
+		for _, r := range text {
+			if isHalfwidthKana(r) {
+				b.WriteString(width.Widen.String(string(r)))
+			} else {
+				b.WriteRune(r)
+			}
+		}
+		// Half-width voiced sound marks widen to combining marks, which compose with the preceding kana
+		text = norm.NFC.String(b.String())
+	}
+	if n.width || n.kana {
+		text = strings.Map(n.foldRune, text)
+	}
+	text = strings.ToLower(text)
+	if n.cc == nil {
+		return text
+	}
+	converted, err := n.cc.Convert(text)
+	if err != nil {
+		slog.Warn("Failed to convert Chinese text", "text", text, "err", err)
+		return text
+	}
+	return converted
+}
+
+// foldRune maps full-width ASCII and the ideographic space to half-width if width is set,
+// and hiragana to katakana if kana is set.
+func (n *textNormalizer) foldRune(r rune) rune {
+	switch {
+	case n.width && r >= '！' && r <= '～':
+		return r - '！' + '!'
+	case n.width && r == '　':
+		return ' '
+	case n.kana && r >= 'ぁ' && r <= 'ゖ':
+		return r - 'ぁ' + 'ァ'
+	}
+	return r
+}
+
+// isHalfwidthKana reports whether r is a half-width katakana or half-width katakana punctuation.
+func isHalfwidthKana(r rune) bool {
+	return r >= '｡' && r <= 'ﾟ'
+}
@@ -0,0 +1,371 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// notifiersKey is the top-level key holding named notification channels. It is not a task.
+const notifiersKey = "notifiers"
+
+// notifyTimeout bounds the delivery of a notification to a channel.
+const notifyTimeout = 30 * time.Second
+
+// Types of an Event.
+const (
+	eventAdded     = "added"     // a torrent was added to the downloader
+	eventCompleted = "completed" // a torrent added finished downloading
+	eventError     = "error"     // the downloader couldn't be reached or torrents couldn't be added
+	eventFeedDown  = "feed-down" // a feed was marked degraded after consecutive failures
+	eventApproval  = "approval"  // matched items were parked for manual approval
+)
+
+// eventTypes are the types of events a task may select in its 'notify' setting.
+var eventTypes = []string{eventAdded, eventCompleted, eventError, eventFeedDown, eventApproval}
+
+// NotifyConfig selects the channels a task notifies and the events it notifies them of.
+type NotifyConfig struct {
+	Channels []string // Names of channels of the notifiers section, all if empty
+	Events   []string // Types of events notified, all if empty
+}
+
+// parseNotifyConfig processes the notify setting of a task: true or false, a list of channel names, or a
+// section with the 'channels' and the 'events' to notify. It returns nil if notifications are off.
+func parseNotifyConfig(v interface{}) (*NotifyConfig, error) {
+	switch v := v.(type) {
+	case bool:
+		if !v {
+			return nil, nil
+		}
+		return &NotifyConfig{}, nil
+	case map[string]interface{}:
+		c := &NotifyConfig{}
+		var err error
+		for key, value := range v {
+			switch strings.ToLower(key) {
+			case "channels":
+				c.Channels, err = parseNotifyNames("channels", value)
+			case "events":
+				if c.Events, err = parseNotifyNames("events", value); err != nil {
+					break
+				}
+				for i, event := range c.Events {
+					c.Events[i] = strings.ToLower(event)
+					if !slices.Contains(eventTypes, c.Events[i]) {
+						return nil, fmt.Errorf("invalid 'events' in 'notify': unknown event '%s', must be one of %s", event, strings.Join(eventTypes, ", "))
+					}
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return c, nil
+	default:
+		channels, err := parseNotifyNames("channels", v)
+		if err != nil {
+			return nil, errors.New("invalid 'notify': must be true, false, a list of channels or a section with 'channels' and 'events'")
+		}
+		return &NotifyConfig{Channels: channels}, nil
+	}
+}
+
+// parseNotifyNames processes a name or a list of names of the notify setting.
+func parseNotifyNames(key string, v interface{}) ([]string, error) {
+	var names []string
+	switch v := v.(type) {
+	case string:
+		names = []string{v}
+	case []interface{}:
+		for _, name := range v {
+			names = append(names, convertToString(name))
+		}
+	default:
+		return nil, fmt.Errorf("invalid '%s' in 'notify': must be a list", key)
+	}
+	for _, name := range names {
+		if name == "" {
+			return nil, fmt.Errorf("invalid '%s' in 'notify': empty name", key)
+		}
+	}
+	return names, nil
+}
+
+// notifies reports whether events of the type are notified.
+func (c *NotifyConfig) notifies(eventType string) bool {
+	return c != nil && (len(c.Events) == 0 || slices.Contains(c.Events, eventType))
+}
+
+// Event is something a task notifies its channels of.
+type Event struct {
+	Type    string        `json:"type"`
+	Task    string        `json:"task"`
+	Time    time.Time     `json:"time"`
+	Torrent *HistoryEntry `json:"torrent,omitempty"` // the torrent added or completed
+	Feed    string        `json:"feed,omitempty"`    // the feed down
+	Waiting int           `json:"waiting,omitempty"` // the items awaiting approval
+	Error   string        `json:"error,omitempty"`
+}
+
+// Subject returns a one-line summary of the event.
+func (e *Event) Subject() string {
+	switch e.Type {
+	case eventAdded:
+		return "Added " + e.Torrent.Title
+	case eventCompleted:
+		return "Completed " + e.Torrent.Title
+	case eventFeedDown:
+		return "Feed down: " + e.Feed
+	case eventApproval:
+		return fmt.Sprintf("%d items awaiting approval", e.Waiting)
+	default:
+		return "Error in task " + e.Task
+	}
+}
+
+// Text returns the message of the event in plain text.
+func (e *Event) Text() string {
+	lines := []string{e.Subject()}
+	switch e.Type {
+	case eventAdded:
+		lines = append(lines, "Task: "+e.Task, "Downloader: "+e.Torrent.Downloader)
+		if e.Torrent.Name != "" {
+			lines = append(lines, "Torrent: "+e.Torrent.Name)
+		}
+		if e.Torrent.Reason != "" {
+			lines = append(lines, "Reason: "+e.Torrent.Reason)
+		}
+	case eventCompleted:
+		lines = append(lines, "Task: "+e.Task, "Downloader: "+e.Torrent.Downloader)
+		if e.Torrent.Name != "" {
+			lines = append(lines, "Torrent: "+e.Torrent.Name)
+		}
+	case eventFeedDown:
+		lines = append(lines, "Task: "+e.Task, "Error: "+e.Error)
+	case eventApproval:
+		lines = append(lines, "Task: "+e.Task, "Decide with 'at-rss approve' or 'at-rss reject'")
+	default:
+		lines = append(lines, e.Error)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Notifier delivers events to a notification channel.
+type Notifier interface {
+	Notify(ctx context.Context, e *Event) error
+}
+
+// notifierProviders create a Notifier from the settings of a channel, by provider key.
+var notifierProviders = map[string]func(settings map[string]interface{}) (Notifier, error){
+	"telegram": newTelegramNotifier,
+	"discord":  newDiscordNotifier,
+	"ntfy":     newNtfyNotifier,
+	"gotify":   newGotifyNotifier,
+	"webhook":  newWebhookNotifier,
+}
+
+// namedNotifier is a notification channel of the notifiers section.
+type namedNotifier struct {
+	name string
+	Notifier
+}
+
+// parseNotifiers removes the notifiers section from the config and creates its channels. Each channel
+// names one provider, e.g. 'telegram', with the settings of the provider. It also returns the section
+// serialized, so that tasks are restarted on reload when the channels change.
+func parseNotifiers(config map[string]interface{}) (map[string]*namedNotifier, string, error) {
+	notifiers := make(map[string]*namedNotifier)
+	value, exists := config[notifiersKey]
+	if !exists || value == nil {
+		delete(config, notifiersKey)
+		return notifiers, "", nil
+	}
+	delete(config, notifiersKey)
+	definitions, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, "", errors.New("invalid 'notifiers': must be a map of names to channels")
+	}
+
+	for name, value := range definitions {
+		definition, ok := value.(map[string]interface{})
+		if !ok || len(definition) != 1 {
+			return nil, "", fmt.Errorf("notifier '%s' must define exactly one of %s", name, strings.Join(notifierProviderNames(), ", "))
+		}
+		for provider, settings := range definition {
+			create, exists := notifierProviders[strings.ToLower(provider)]
+			if !exists {
+				return nil, "", fmt.Errorf("notifier '%s': unknown provider '%s', must be one of %s", name, provider, strings.Join(notifierProviderNames(), ", "))
+			}
+			section, ok := settings.(map[string]interface{})
+			if !ok {
+				return nil, "", fmt.Errorf("notifier '%s': '%s' must be a map", name, provider)
+			}
+			notifier, err := create(section)
+			if err != nil {
+				return nil, "", fmt.Errorf("notifier '%s': %w", name, err)
+			}
+			notifiers[name] = &namedNotifier{name: name, Notifier: notifier}
+		}
+	}
+	source, err := yaml.Marshal(definitions)
+	if err != nil {
+		return nil, "", err
+	}
+	return notifiers, string(source), nil
+}
+
+// notifierProviderNames returns the provider keys in lexical order.
+func notifierProviderNames() []string {
+	names := make([]string, 0, len(notifierProviders))
+	for name := range notifierProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkNotifierSettings checks that the settings of a provider contain only the allowed keys and the required ones.
+func checkNotifierSettings(provider string, settings map[string]interface{}, allowed []string, required ...string) error {
+	for k := range settings {
+		known := false
+		for _, a := range allowed {
+			if k == a {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown key '%s' in %s", k, provider)
+		}
+	}
+	for _, k := range required {
+		_, exists := settings[k]
+		_, hasFile := settings[k+"File"]
+		_, hasFile2 := settings[k+"_file"]
+		if !exists && !hasFile && !hasFile2 {
+			return fmt.Errorf("'%s' missing in %s", k, provider)
+		}
+	}
+	return nil
+}
+
+// notifications tracks the deliveries in progress, waited for before exiting.
+var notifications sync.WaitGroup
+
+// waitNotifications waits for the deliveries in progress.
+func waitNotifications() {
+	notifications.Wait()
+}
+
+// notify delivers the event to the channels of the task in the background, if the task notifies events of its type.
+func (t *Task) notify(e *Event) {
+	if len(t.Notifiers) == 0 || !t.Notify.notifies(e.Type) {
+		return
+	}
+	e.Task, e.Time = t.Name, time.Now()
+	for _, n := range t.Notifiers {
+		notifications.Add(1)
+		go func(n *namedNotifier) {
+			defer notifications.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			defer cancel()
+			if err := n.Notify(ctx, e); err != nil {
+				slog.Warn("Failed to send notification", "notifier", n.name, "task", t.Name, "event", e.Type, "err", err)
+			}
+		}(n)
+	}
+}
+
+// notifyAdded notifies the channels of the task of the torrents added, and watches them to notify their completion.
+func (t *Task) notifyAdded(entries []*HistoryEntry) {
+	for _, entry := range entries {
+		t.notify(&Event{Type: eventAdded, Torrent: entry})
+	}
+	t.watchDownloads(entries)
+}
+
+// notifyErrors notifies the channels of the task of the failures of a fetch pass. An error is not notified
+// again at every fetch while it persists.
+func (t *Task) notifyErrors(result FetchResult) {
+	var message string
+	switch {
+	case result.Error != "":
+		message = "Downloader unreachable: " + result.Error
+	case len(result.AddErrors) > 0:
+		message = fmt.Sprintf("Failed to add %d torrents, first %s: %s", len(result.AddErrors), result.AddErrors[0].URL, result.AddErrors[0].Error)
+	}
+	if message == t.notifiedError {
+		return
+	}
+	t.notifiedError = message
+	if message != "" {
+		t.notify(&Event{Type: eventError, Error: message})
+	}
+}
+
+// notifyFeedDown notifies the channels of the task once the feed is degraded.
+func (t *Task) notifyFeedDown(feedUrl string, status FeedStatus) {
+	if !status.Degraded || t.downFeeds[feedUrl] {
+		return
+	}
+	if t.downFeeds == nil {
+		t.downFeeds = make(map[string]bool)
+	}
+	t.downFeeds[feedUrl] = true
+	t.notify(&Event{Type: eventFeedDown, Feed: feedUrl, Error: status.LastError})
+}
+
+// postJSON posts body encoded as JSON to url and checks the response status.
+func postJSON(ctx context.Context, url string, body interface{}, header http.Header) error {
+	content, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return post(ctx, url, "application/json", content, header)
+}
+
+// post posts content to url and checks the response status.
+func post(ctx context.Context, url, contentType string, content []byte, header http.Header) error {
+	return send(ctx, http.MethodPost, url, contentType, content, header)
+}
+
+// send sends content to url with the method and checks the response status.
+func send(ctx context.Context, method, url, contentType string, content []byte, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	for k, values := range header {
+		req.Header[k] = values
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
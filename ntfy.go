@@ -0,0 +1,144 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const defaultNtfyUrl = "https://ntfy.sh"
+
+// Keys of the settings of ntfy and Gotify channels.
+var (
+	ntfyKeys   = []string{"url", "topic", "priority", "token", "tokenFile", "token_file"}
+	gotifyKeys = []string{"url", "token", "tokenFile", "token_file", "priority"}
+)
+
+// ntfyPriorities are the names of the ntfy priorities, from 1 to 5.
+var ntfyPriorities = []string{"min", "low", "default", "high", "urgent"}
+
+// ntfyNotifier publishes events to a topic of an ntfy server.
+type ntfyNotifier struct {
+	url      string // Server URL, the public ntfy.sh one by default
+	topic    string
+	priority int    // 1 to 5, 0 for the default of the server
+	token    string // Access token of a protected topic
+}
+
+// newNtfyNotifier creates an ntfy channel from its settings: the server URL, the topic and optionally
+// the priority and an access token.
+func newNtfyNotifier(settings map[string]interface{}) (Notifier, error) {
+	if err := checkNotifierSettings("ntfy", settings, ntfyKeys, "topic"); err != nil {
+		return nil, err
+	}
+	token, err := getSecret(settings, "token")
+	if err != nil {
+		return nil, err
+	}
+	topic := convertToString(settings["topic"])
+	if topic == "" || strings.Contains(topic, "/") {
+		return nil, errors.New("invalid 'topic' in ntfy: " + topic)
+	}
+	n := &ntfyNotifier{url: strings.TrimSuffix(getStringOrDefault(settings["url"], defaultNtfyUrl), "/"), topic: topic, token: token}
+	if v, exists := settings["priority"]; exists {
+		if n.priority, err = parseNtfyPriority(v); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// parseNtfyPriority parses a priority from 1 to 5, or its name.
+func parseNtfyPriority(v interface{}) (int, error) {
+	if priority, ok := v.(int); ok && priority >= 1 && priority <= 5 {
+		return priority, nil
+	}
+	name := strings.ToLower(convertToString(v))
+	for i, n := range ntfyPriorities {
+		if n == name {
+			return i + 1, nil
+		}
+	}
+	if name == "max" {
+		return 5, nil
+	}
+	return 0, errors.New("invalid 'priority' in ntfy: must be 1 to 5 or " + strings.Join(ntfyPriorities, ", "))
+}
+
+// Notify publishes the event as a message with a title.
+func (n *ntfyNotifier) Notify(ctx context.Context, e *Event) error {
+	header := http.Header{}
+	// Headers are ASCII, titles in other scripts are encoded as RFC 2047 words which ntfy decodes
+	header.Set("Title", mime.BEncoding.Encode("utf-8", e.Subject()))
+	if n.priority > 0 {
+		header.Set("Priority", strconv.Itoa(n.priority))
+	}
+	switch e.Type {
+	case eventAdded:
+		header.Set("Tags", "arrow_down")
+	case eventCompleted:
+		header.Set("Tags", "white_check_mark")
+	case eventApproval:
+		header.Set("Tags", "hourglass")
+	default:
+		header.Set("Tags", "warning")
+	}
+	if n.token != "" {
+		header.Set("Authorization", "Bearer "+n.token)
+	}
+	return post(ctx, n.url+"/"+n.topic, "text/plain; charset=utf-8", []byte(eventBody(e)), header)
+}
+
+// gotifyNotifier sends events as messages of a Gotify application.
+type gotifyNotifier struct {
+	url      string
+	token    string // Token of the application
+	priority int
+}
+
+// newGotifyNotifier creates a Gotify channel from its settings: the server URL, the application token
+// and optionally the priority.
+func newGotifyNotifier(settings map[string]interface{}) (Notifier, error) {
+	if err := checkNotifierSettings("gotify", settings, gotifyKeys, "url", "token"); err != nil {
+		return nil, err
+	}
+	token, err := getSecret(settings, "token")
+	if err != nil {
+		return nil, err
+	}
+	n := &gotifyNotifier{url: strings.TrimSuffix(convertToString(settings["url"]), "/"), token: token, priority: 5}
+	if v, exists := settings["priority"]; exists {
+		priority, ok := v.(int)
+		if !ok || priority < 0 || priority > 10 {
+			return nil, errors.New("invalid 'priority' in gotify: must be 0 to 10")
+		}
+		n.priority = priority
+	}
+	return n, nil
+}
+
+// Notify sends the event as a message.
+func (n *gotifyNotifier) Notify(ctx context.Context, e *Event) error {
+	header := http.Header{}
+	header.Set("X-Gotify-Key", n.token)
+	return postJSON(ctx, n.url+"/message", map[string]interface{}{
+		"title":    e.Subject(),
+		"message":  eventBody(e),
+		"priority": n.priority,
+	}, header)
+}
+
+// eventBody returns the message of the event without its subject, for providers showing the subject as a title.
+func eventBody(e *Event) string {
+	_, body, _ := strings.Cut(e.Text(), "\n")
+	return body
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Exit codes of a single run with --once.
+const (
+	exitOK            = 0
+	exitConfigInvalid = 2
+	exitFeedErrors    = 3
+	exitAddErrors     = 4
+	exitBothErrors    = 5
+)
+
+// RunSummary is the machine-readable result of a single run with --once.
+type RunSummary struct {
+	Started  time.Time              `json:"started"`
+	Finished time.Time              `json:"finished"`
+	ExitCode int                    `json:"exitCode"`
+	Error    string                 `json:"error,omitempty"`
+	Tasks    map[string]FetchResult `json:"tasks"`
+}
+
+// runOnce fetches every task a single time, writes the summary and returns the exit code.
+func runOnce(ctx context.Context, cache *Cache, health *FeedHealth, hosts *HostLimiter, pending *PendingStore) int {
+	summary := RunSummary{Started: time.Now(), ExitCode: exitOK, Tasks: make(map[string]FetchResult)}
+
+	tasks, err := LoadConfig(opt.Config)
+	if err == nil {
+		err = applyGlobalOptions(tasks)
+	}
+	if err != nil {
+		summary.Error = err.Error()
+		summary.ExitCode = exitConfigInvalid
+		summary.Finished = time.Now()
+		writeSummary(&summary)
+		return summary.ExitCode
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, task := range *tasks {
+		if opt.Tag != "" && !task.HasTag(opt.Tag) {
+			continue
+		}
+		wg.Add(1)
+		go func(task *Task) {
+			defer wg.Done()
+			result := task.RunOnce(ctx, cache, health, hosts, pending)
+			mu.Lock()
+			summary.Tasks[task.Name] = result
+			mu.Unlock()
+		}(task)
+	}
+	wg.Wait()
+	waitNotifications()
+	rpcClients.closeAll()
+
+	feedFailed, addFailed := false, false
+	for _, result := range summary.Tasks {
+		feedFailed = feedFailed || len(result.FeedErrors) > 0
+		addFailed = addFailed || len(result.AddErrors) > 0 || result.Error != ""
+	}
+	switch {
+	case feedFailed && addFailed:
+		summary.ExitCode = exitBothErrors
+	case feedFailed:
+		summary.ExitCode = exitFeedErrors
+	case addFailed:
+		summary.ExitCode = exitAddErrors
+	}
+	summary.Finished = time.Now()
+	writeSummary(&summary)
+	return summary.ExitCode
+}
+
+// writeSummary writes the summary as JSON to the file given by --summary, or to stdout.
+func writeSummary(summary *RunSummary) {
+	out := os.Stdout
+	if opt.Summary != "" && opt.Summary != "-" {
+		file, err := os.Create(opt.Summary)
+		if err != nil {
+			slog.Error("Failed to write run summary", "path", opt.Summary, "err", err)
+			return
+		}
+		defer file.Close()
+		out = file
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(summary); err != nil {
+		slog.Error("Failed to write run summary", "err", err)
+	}
+}
@@ -0,0 +1,233 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// importCommand implements the 'import' subcommand.
+type importCommand struct {
+	OPML       string `long:"opml" description:"OPML subscription list to import" required:"yes"`
+	Group      bool   `long:"group" description:"Create one task per OPML folder instead of one per feed"`
+	Downloader string `long:"downloader" description:"Downloader the tasks reference, from the 'downloaders' section"`
+	Output     string `short:"o" long:"output" description:"File to write the tasks to, '-' for stdout" default:"-"`
+}
+
+// exportCommand implements the 'export' subcommand.
+type exportCommand struct {
+	Tag    string `long:"tag" description:"Only export the tasks with this tag"`
+	Output string `short:"o" long:"output" description:"File to write the OPML to, '-' for stdout" default:"-"`
+}
+
+// opmlOutline is an outline element of an OPML file: a feed if it has an xmlUrl, otherwise a folder.
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// opmlDocument is the root element of an OPML file.
+type opmlDocument struct {
+	XMLName  xml.Name      `xml:"opml"`
+	Version  string        `xml:"version,attr"`
+	Title    string        `xml:"head>title"`
+	Outlines []opmlOutline `xml:"body>outline"`
+}
+
+// opmlTask is a task stub generated from an OPML file.
+type opmlTask struct {
+	name  string
+	feeds []string
+}
+
+func init() {
+	parser.AddCommand("import",
+		"Create task stubs from an OPML subscription list",
+		"Convert the feeds of an OPML file, as exported by RSS readers, to tasks: one per feed, or with --group "+
+			"one per folder. The tasks only have their feeds and downloader; add filters before using them.",
+		&importCommand{})
+	parser.AddCommand("export",
+		"Export the feeds of the tasks as an OPML subscription list",
+		"Write the feed URLs of the tasks of the config file as OPML, one folder per task, to move them to an "+
+			"RSS reader or another tool. 'import --group' turns the folders back into tasks.",
+		&exportCommand{})
+}
+
+// Execute converts the OPML file and writes the tasks.
+func (c *importCommand) Execute(args []string) error {
+	file, err := os.Open(c.OPML)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	tasks, err := parseOPML(file, c.Group)
+	if err != nil {
+		return err
+	}
+	if len(tasks) == 0 {
+		return errors.New("no feeds in " + c.OPML)
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, task := range tasks {
+		section := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		if c.Downloader != "" {
+			section.Content = append(section.Content, scalarNode("downloader"), scalarNode(c.Downloader))
+		}
+		feeds := scalarNode(task.feeds[0])
+		if len(task.feeds) > 1 {
+			feeds = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			for _, feed := range task.feeds {
+				feeds.Content = append(feeds.Content, scalarNode(feed))
+			}
+		}
+		section.Content = append(section.Content, scalarNode("feed"), feeds)
+		root.Content = append(root.Content, scalarNode(task.name), section)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(4)
+	if err := encoder.Encode(root); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	if c.Downloader == "" {
+		fmt.Fprintln(os.Stderr, "note: the tasks have no RPC server; add one, a 'downloader' or a 'defaults' section")
+	}
+	if c.Output == "-" {
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	if _, err := os.Stat(c.Output); err == nil {
+		return errors.New("output file exists: " + c.Output)
+	}
+	return os.WriteFile(c.Output, buf.Bytes(), 0644)
+}
+
+// Execute writes the feeds of the tasks as OPML.
+func (c *exportCommand) Execute(args []string) error {
+	tasks, err := LoadConfig(opt.Config)
+	if err != nil {
+		return err
+	}
+	doc := opmlDocument{Version: "2.0", Title: "at-rss feeds"}
+	for _, task := range *tasks {
+		if c.Tag != "" && !task.HasTag(c.Tag) {
+			continue
+		}
+		folder := opmlOutline{Text: task.Name, Title: task.Name}
+		for _, feedUrl := range task.FeedUrls {
+			folder.Outlines = append(folder.Outlines, opmlOutline{Text: feedUrl, Type: "rss", XMLURL: feedUrl})
+		}
+		doc.Outlines = append(doc.Outlines, folder)
+	}
+	if len(doc.Outlines) == 0 {
+		return errors.New("no task matches")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	buf.WriteString("\n")
+	if c.Output == "-" {
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	return os.WriteFile(c.Output, buf.Bytes(), 0644)
+}
+
+// parseOPML returns the task stubs of an OPML document, one per feed or, if group is true, one per folder.
+// Feeds outside any folder get a task of their own either way.
+func parseOPML(r io.Reader, group bool) ([]opmlTask, error) {
+	var doc opmlDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid OPML: %w", err)
+	}
+	var tasks []opmlTask
+	// Top-level keys that are not tasks can't be task names
+	used := map[string]bool{includeKey: true, defaultsKey: true, downloadersKey: true, profilesKey: true, notifiersKey: true}
+	add := func(title string, feeds []string) {
+		name := taskName(title)
+		unique := name
+		for n := 2; used[unique]; n++ {
+			unique = fmt.Sprintf("%s-%d", name, n)
+		}
+		used[unique] = true
+		tasks = append(tasks, opmlTask{name: unique, feeds: feeds})
+	}
+	var walk func(outlines []opmlOutline)
+	walk = func(outlines []opmlOutline) {
+		for _, outline := range outlines {
+			switch {
+			case outline.XMLURL != "":
+				add(outline.label(), []string{outline.XMLURL})
+			case group:
+				if feeds := outline.feeds(); len(feeds) > 0 {
+					add(outline.label(), feeds)
+				}
+			default:
+				walk(outline.Outlines)
+			}
+		}
+	}
+	walk(doc.Outlines)
+	return tasks, nil
+}
+
+// label returns the title of the outline, or its text if it has no title.
+func (o *opmlOutline) label() string {
+	if o.Title != "" {
+		return o.Title
+	}
+	return o.Text
+}
+
+// feeds returns the feed URLs of the outline and its nested outlines.
+func (o *opmlOutline) feeds() []string {
+	var feeds []string
+	if o.XMLURL != "" {
+		feeds = append(feeds, o.XMLURL)
+	}
+	for i := range o.Outlines {
+		feeds = append(feeds, o.Outlines[i].feeds()...)
+	}
+	return feeds
+}
+
+// taskName turns an OPML title into a task name: lowercase words joined by '-'.
+func taskName(title string) string {
+	name := strings.Join(strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return r == '/' || r == ':' || r == ' ' || r == '\t'
+	}), "-")
+	if name == "" {
+		return "feed"
+	}
+	return name
+}
+
+// scalarNode returns a YAML string node.
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// pausedFileName holds the tasks paused by the 'pause' subcommand, with the time they were paused.
+const pausedFileName = ".cache/at-rss-paused.yml"
+
+// PausedTasks persists the tasks that skip their fetches until resumed, without changing the config.
+type PausedTasks struct {
+	filePath string
+}
+
+// NewPausedTasks returns PausedTasks stored in the user's cache directory.
+func NewPausedTasks() (*PausedTasks, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return &PausedTasks{filePath: filepath.Join(homeDir, pausedFileName)}, nil
+}
+
+// Load returns the paused tasks with the time they were paused.
+func (p *PausedTasks) Load() (map[string]time.Time, error) {
+	paused := make(map[string]time.Time)
+	if err := loadCache(p.filePath, &paused); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return paused, nil
+}
+
+// Update loads the paused tasks, lets fn modify them and saves the result, holding a lock on the file meanwhile.
+func (p *PausedTasks) Update(fn func(paused map[string]time.Time)) error {
+	unlock, err := lockFile(p.filePath + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	paused, err := p.Load()
+	if err != nil {
+		return err
+	}
+	fn(paused)
+	return writeFileAtomic(p.filePath, paused)
+}
+
+// isPaused reports whether the task was paused with the 'pause' subcommand.
+func (t *Task) isPaused() bool {
+	store, err := NewPausedTasks()
+	if err != nil {
+		return false
+	}
+	paused, err := store.Load()
+	if err != nil {
+		slog.Warn("Failed to read paused tasks", "task", t.Name, "err", err)
+		return false
+	}
+	_, exists := paused[t.Name]
+	return exists
+}
+
+// pauseCommand implements the 'pause' subcommand.
+type pauseCommand struct {
+	Task []string `long:"task" description:"Task to pause; may be repeated"`
+	Tag  string   `long:"tag" description:"Pause the tasks with this tag"`
+	All  bool     `long:"all" description:"Pause all tasks"`
+}
+
+// resumeCommand implements the 'resume' subcommand.
+type resumeCommand struct {
+	Task []string `long:"task" description:"Task to resume; may be repeated"`
+	Tag  string   `long:"tag" description:"Resume the tasks with this tag"`
+	All  bool     `long:"all" description:"Resume all tasks"`
+}
+
+func init() {
+	parser.AddCommand("pause",
+		"Pause tasks",
+		"Make tasks skip their fetches until resumed, e.g. when a tracker asks for reduced load or a downloader "+
+			"is under maintenance. The config is left unchanged and the tasks stay paused across restarts.",
+		&pauseCommand{})
+	parser.AddCommand("resume",
+		"Resume paused tasks",
+		"Let paused tasks fetch again from their next scheduled fetch.",
+		&resumeCommand{})
+}
+
+// Execute pauses the selected tasks.
+func (c *pauseCommand) Execute(args []string) error {
+	return setPaused(c.Task, c.Tag, c.All, true)
+}
+
+// Execute resumes the selected tasks.
+func (c *resumeCommand) Execute(args []string) error {
+	return setPaused(c.Task, c.Tag, c.All, false)
+}
+
+// setPaused pauses or resumes the tasks among names with the tag, or all tasks if all is true.
+func setPaused(names []string, tag string, all, pause bool) error {
+	if all == (len(names) > 0 || tag != "") {
+		return errors.New("give either --task or --tag, or --all")
+	}
+	selected, err := selectTaskNames(names, tag)
+	if err != nil {
+		return err
+	}
+	store, err := NewPausedTasks()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	err = store.Update(func(paused map[string]time.Time) {
+		for _, name := range selected {
+			if !pause {
+				delete(paused, name)
+			} else if _, exists := paused[name]; !exists {
+				paused[name] = now
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range selected {
+		if pause {
+			fmt.Println("paused " + name)
+		} else {
+			fmt.Println("resumed " + name)
+		}
+	}
+	return nil
+}
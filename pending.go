@@ -0,0 +1,131 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const pendingFileName = ".cache/at-rss-pending.yml"
+
+// Status of a PendingItem.
+const (
+	pendingStatus  = "pending"
+	approvedStatus = "approved"
+	rejectedStatus = "rejected"
+	addedStatus    = "added" // added by the 'add' subcommand while the daemon was running, to be recorded in the cache
+)
+
+// PendingItem is a matched feed item of a task with manual approval, waiting for a decision.
+type PendingItem struct {
+	ID         string    `yaml:"id"`
+	Feed       string    `yaml:"feed"`
+	GUID       string    `yaml:"guid"`
+	Title      string    `yaml:"title"`
+	URL        string    `yaml:"url"`
+	InfoHashes []string  `yaml:"infoHashes,omitempty"`
+	Parked     time.Time `yaml:"parked"`
+	Status     string    `yaml:"status"`
+}
+
+// PendingStore persists pending items per task name in a file shared by the daemon and the CLI.
+// The daemon parks items and applies decisions; the CLI only changes the status of items.
+type PendingStore struct {
+	filePath string
+}
+
+// NewPendingStore returns a PendingStore stored in the user's cache directory.
+func NewPendingStore() (*PendingStore, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return &PendingStore{filePath: filepath.Join(homeDir, pendingFileName)}, nil
+}
+
+// Load returns the pending items of all tasks.
+func (s *PendingStore) Load() (map[string][]*PendingItem, error) {
+	items := make(map[string][]*PendingItem)
+	if err := loadCache(s.filePath, &items); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Update loads the pending items, lets fn modify them and saves the result, holding a lock on the file meanwhile.
+// Nothing is saved if fn returns an error.
+func (s *PendingStore) Update(fn func(items map[string][]*PendingItem) error) error {
+	unlock, err := lockFile(s.filePath + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	items, err := s.Load()
+	if err != nil {
+		return err
+	}
+	if err := fn(items); err != nil {
+		return err
+	}
+	for task, list := range items {
+		if len(list) == 0 {
+			delete(items, task)
+		}
+	}
+	return writeFileAtomic(s.filePath, items)
+}
+
+// pendingItemID derives a short stable ID for an item of a task.
+func pendingItemID(task, guid string) string {
+	sum := sha1.Sum([]byte(task + "\x00" + guid))
+	return hex.EncodeToString(sum[:4])
+}
+
+// lockFile acquires an exclusive lock file, taking over locks older than 30 seconds left by crashed processes.
+func lockFile(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0744); err != nil {
+		return nil, err
+	}
+	for attempt := 0; attempt < 100; attempt++ {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > 30*time.Second {
+			os.Remove(path)
+			continue
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil, errors.New("timed out waiting for lock file: " + path)
+}
+
+// writeFileAtomic serializes object to a temporary file and renames it over filePath,
+// so readers in other processes never see a partially written file.
+func writeFileAtomic(filePath string, object interface{}) error {
+	content, err := yaml.Marshal(object)
+	if err != nil {
+		return err
+	}
+	tmpPath := filePath + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filePath)
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// profilesKey is the top-level key holding named download option profiles. It is not a task.
+const profilesKey = "profiles"
+
+// AddOptions are the download options torrents of a task are added with. Zero values keep the
+// defaults of the RPC server.
+type AddOptions struct {
+	Dir           string   // Download directory
+	Labels        []string // Labels, Transmission only
+	SeedRatio     float64  // Stop seeding at this ratio
+	SeedTime      int      // Stop seeding after this many minutes; idle minutes for Transmission
+	DownloadLimit int      // Download speed limit in KiB/s
+	UploadLimit   int      // Upload speed limit in KiB/s
+}
+
+// optionsKeys are the keys of an options section or profile.
+var optionsKeys = []string{"dir", "labels", "seedRatio", "seedTime", "downloadLimit", "uploadLimit"}
+
+// resolveProfiles removes the profiles section from the config and merges the profile named by the
+// 'profile' key of every task into its 'options' section. Options set by the task take precedence.
+func resolveProfiles(config map[string]interface{}) error {
+	profiles := make(map[string]interface{})
+	if value, exists := config[profilesKey]; exists {
+		delete(config, profilesKey)
+		if value != nil {
+			var ok bool
+			if profiles, ok = value.(map[string]interface{}); !ok {
+				return errors.New("invalid 'profiles': must be a map of names to options")
+			}
+		}
+	}
+
+	for name, value := range config {
+		task, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		key, exists := lookupKey(task, "profile")
+		if !exists {
+			continue
+		}
+		ref := convertToString(task[key])
+		profile, ok := profiles[ref].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("task '%s': unknown profile '%s'", name, ref)
+		}
+		options := make(map[string]interface{}, len(profile))
+		for k, v := range profile {
+			options[k] = v
+		}
+		if optionsKey, exists := lookupKey(task, "options"); exists {
+			if taskOptions, ok := task[optionsKey].(map[string]interface{}); ok {
+				for k, v := range taskOptions {
+					options[k] = v
+				}
+			}
+			delete(task, optionsKey)
+		}
+		task["options"] = options
+		delete(task, key)
+	}
+	return nil
+}
+
+// parseOptionsConfig processes the options section of a task.
+func parseOptionsConfig(v interface{}) (*AddOptions, error) {
+	section, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid 'options': must be a map")
+	}
+	options := &AddOptions{
+		Dir:           convertToString(section["dir"]),
+		SeedTime:      getIntOrDefault(section["seedTime"], 0),
+		DownloadLimit: getIntOrDefault(section["downloadLimit"], 0),
+		UploadLimit:   getIntOrDefault(section["uploadLimit"], 0),
+	}
+	switch ratio := section["seedRatio"].(type) {
+	case nil:
+	case int:
+		options.SeedRatio = float64(ratio)
+	case float64:
+		options.SeedRatio = ratio
+	default:
+		return nil, errors.New("invalid 'seedRatio' in options: must be a number")
+	}
+	if options.SeedRatio < 0 || options.SeedTime < 0 || options.DownloadLimit < 0 || options.UploadLimit < 0 {
+		return nil, errors.New("invalid 'options': limits must not be negative")
+	}
+	switch labels := section["labels"].(type) {
+	case nil:
+	case string:
+		options.Labels = []string{labels}
+	case []interface{}:
+		for _, label := range labels {
+			options.Labels = append(options.Labels, convertToString(label))
+		}
+	default:
+		return nil, errors.New("invalid 'labels' in options: must be a list")
+	}
+	return options, nil
+}
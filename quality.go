@@ -0,0 +1,239 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"html"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const qualityFileName = ".cache/at-rss-quality.yml"
+
+// qualityRetention is how long the grabbed quality of an episode is remembered after it was first seen.
+const qualityRetention = 30 * 24 * time.Hour
+
+// QualityConfig ranks the releases of an episode by resolution and then by codec.
+type QualityConfig struct {
+	Resolutions []string      // Preferred resolutions, best first, e.g. 2160p, 1080p
+	Codecs      []string      // Preferred codecs, best first, e.g. hevc, x265
+	Wait        time.Duration // How long to wait for a better release after the first one was seen
+	Upgrade     bool          // Also grab a better release after a worse one was grabbed
+}
+
+// qualityKeys are the keys of the quality section.
+var qualityKeys = []string{"resolutions", "codecs", "wait", "upgrade"}
+
+// parseQualityConfig processes the quality section of a task.
+func parseQualityConfig(v interface{}) (*QualityConfig, error) {
+	section, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid 'quality': must be a map")
+	}
+	lists := convertToStringSliceMap(section)
+	q := &QualityConfig{
+		Resolutions: lists["resolutions"],
+		Codecs:      lists["codecs"],
+		Wait:        time.Duration(getIntOrDefault(section["wait"], 0)) * time.Minute,
+		Upgrade:     getBoolOrDefault(section["upgrade"], false),
+	}
+	if len(q.Resolutions) == 0 && len(q.Codecs) == 0 {
+		return nil, errors.New("invalid 'quality': needs 'resolutions' or 'codecs'")
+	}
+	if q.Wait < 0 {
+		return nil, errors.New("invalid 'wait' in quality: must not be negative")
+	}
+	return q, nil
+}
+
+// Score ranks a release title; higher is better. The resolution outweighs the codec.
+func (q *QualityConfig) Score(title string) int {
+	title = strings.ToLower(title)
+	return rank(title, q.Resolutions)*(len(q.Codecs)+1) + rank(title, q.Codecs)
+}
+
+// best returns the score of a release with the preferred resolution and codec, which is not waited on.
+func (q *QualityConfig) best() int {
+	return len(q.Resolutions)*(len(q.Codecs)+1) + len(q.Codecs)
+}
+
+// rank returns len(preferences) for the first preference found in the title, one less for the second and so on,
+// or 0 if none is found.
+func rank(title string, preferences []string) int {
+	for i, preference := range preferences {
+		if strings.Contains(title, strings.ToLower(preference)) {
+			return len(preferences) - i
+		}
+	}
+	return 0
+}
+
+// QualityEntry is the state of an episode of a task with quality preferences.
+type QualityEntry struct {
+	FirstSeen  time.Time `yaml:"firstSeen"`
+	Grabbed    bool      `yaml:"grabbed"`
+	Score      int       `yaml:"score,omitempty"`
+	Title      string    `yaml:"title,omitempty"`
+	InfoHashes []string  `yaml:"infoHashes,omitempty"` // Of the release grabbed, removed from the downloader on an upgrade
+}
+
+// qualityCandidate is a matched item competing with the other releases of its episode.
+type qualityCandidate struct {
+	feed    string
+	guid    string
+	item    *gofeed.Item
+	torrent *TorrentInfo
+	score   int
+}
+
+// qualityPick is the release of an episode chosen to be grabbed, and the release it replaces on an upgrade.
+type qualityPick struct {
+	episode  string
+	best     *qualityCandidate
+	releases []*qualityCandidate
+	from     string   // Title of the release grabbed before, empty if none
+	replaced []string // InfoHashes of the release grabbed before
+}
+
+// QualityStore persists the episodes of tasks with quality preferences per task name and episode.
+type QualityStore struct {
+	filePath string
+}
+
+// NewQualityStore returns a QualityStore stored in the user's cache directory.
+func NewQualityStore() (*QualityStore, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return &QualityStore{filePath: filepath.Join(homeDir, qualityFileName)}, nil
+}
+
+// Update loads the episodes, lets fn modify them and saves the result, holding a lock on the file meanwhile.
+func (s *QualityStore) Update(fn func(episodes map[string]map[string]*QualityEntry)) error {
+	unlock, err := lockFile(s.filePath + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	episodes := make(map[string]map[string]*QualityEntry)
+	if err := loadCache(s.filePath, &episodes); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	fn(episodes)
+	for task, entries := range episodes {
+		if len(entries) == 0 {
+			delete(episodes, task)
+		}
+	}
+	return writeFileAtomic(s.filePath, episodes)
+}
+
+// pickReleases decides for each episode which of its candidates to grab. The best candidate is grabbed once the
+// wait has passed since the episode was first seen, or immediately if it has the preferred quality. Candidates
+// that lose are marked processed by skip; candidates still waiting are left unprocessed so they are seen again.
+// grab is given the infoHashes of the release an upgrade replaces. The releases are grabbed without holding
+// the lock on the store, which is taken again to record them.
+func (t *Task) pickReleases(candidates map[string][]*qualityCandidate, grab func(c *qualityCandidate, replaced []string) bool, skip func(*qualityCandidate)) {
+	store, err := NewQualityStore()
+	if err != nil {
+		slog.Warn("Failed to update quality state", "task", t.Name, "err", err)
+		return
+	}
+	var picks []*qualityPick
+	err = store.Update(func(state map[string]map[string]*QualityEntry) {
+		now := time.Now()
+		entries := state[t.Name]
+		if entries == nil {
+			entries = make(map[string]*QualityEntry)
+			state[t.Name] = entries
+		}
+		for episode, releases := range candidates {
+			best := releases[0]
+			for _, release := range releases[1:] {
+				if release.score > best.score {
+					best = release
+				}
+			}
+			entry := entries[episode]
+			if entry == nil {
+				entry = &QualityEntry{FirstSeen: now}
+				entries[episode] = entry
+			}
+			switch {
+			case entry.Grabbed && (!t.Quality.Upgrade || best.score <= entry.Score):
+				slog.Info("Skipping releases not better than the one grabbed", "task", t.Name, "episode", episode, "grabbed", entry.Title)
+				for _, release := range releases {
+					skip(release)
+				}
+			case !entry.Grabbed && best.score < t.Quality.best() && now.Sub(entry.FirstSeen) < t.Quality.Wait:
+				slog.Info("Waiting for a better release", "task", t.Name, "episode", episode, "best", best.item.Title,
+					"until", entry.FirstSeen.Add(t.Quality.Wait).Format(time.DateTime))
+			default:
+				pick := &qualityPick{episode: episode, best: best, releases: releases}
+				if entry.Grabbed {
+					pick.from, pick.replaced = entry.Title, entry.InfoHashes
+				}
+				picks = append(picks, pick)
+			}
+		}
+		for episode, entry := range entries {
+			if now.Sub(entry.FirstSeen) > qualityRetention {
+				delete(entries, episode)
+			}
+		}
+	})
+	if err != nil {
+		slog.Warn("Failed to update quality state", "task", t.Name, "err", err)
+		return
+	}
+
+	var grabbed []*qualityPick
+	for _, pick := range picks {
+		if !grab(pick.best, pick.replaced) {
+			continue
+		}
+		if pick.from != "" {
+			slog.Info("Upgraded release", "task", t.Name, "episode", pick.episode, "from", pick.from, "to", pick.best.item.Title)
+		}
+		for _, release := range pick.releases {
+			if release != pick.best {
+				skip(release)
+			}
+		}
+		grabbed = append(grabbed, pick)
+	}
+	if len(grabbed) == 0 {
+		return
+	}
+	err = store.Update(func(state map[string]map[string]*QualityEntry) {
+		entries := state[t.Name]
+		if entries == nil {
+			entries = make(map[string]*QualityEntry)
+			state[t.Name] = entries
+		}
+		for _, pick := range grabbed {
+			entry := entries[pick.episode]
+			if entry == nil {
+				entry = &QualityEntry{FirstSeen: time.Now()}
+				entries[pick.episode] = entry
+			}
+			entry.Grabbed, entry.Score, entry.Title = true, pick.best.score, html.UnescapeString(pick.best.item.Title)
+			entry.InfoHashes = pick.best.torrent.InfoHashes
+		}
+	})
+	if err != nil {
+		slog.Warn("Failed to update quality state", "task", t.Name, "err", err)
+	}
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestPickReleasesUpgrade(t *testing.T) {
+	isolateHome(t)
+	store, err := NewQualityStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := &Task{Name: "task", Quality: &QualityConfig{Resolutions: []string{"1080p", "720p"}, Upgrade: true}}
+	candidate := func(n int, title string) *qualityCandidate {
+		return &qualityCandidate{
+			guid:    title,
+			item:    &gofeed.Item{Title: title},
+			torrent: &TorrentInfo{InfoHashes: []string{infoHashOf(n)}},
+			score:   task.Quality.Score(title),
+		}
+	}
+	tests := []struct {
+		release  *qualityCandidate
+		grabbed  bool
+		replaced []string // infoHashes grab is given
+	}{
+		{candidate(1, "Show - 01 [720p]"), true, nil},
+		{candidate(2, "Show - 01 [720p] v2"), false, nil},
+		{candidate(3, "Show - 01 [1080p]"), true, []string{infoHashOf(1)}},
+	}
+	for _, tt := range tests {
+		var grabbed bool
+		var replaced []string
+		grab := func(c *qualityCandidate, r []string) bool {
+			// The store is not locked while releases are grabbed
+			done := make(chan error, 1)
+			go func() { done <- store.Update(func(map[string]map[string]*QualityEntry) {}) }()
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Errorf("%s: Update() while grabbing failed: %v", c.guid, err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s: the quality store is locked while grabbing", c.guid)
+			}
+			grabbed, replaced = true, r
+			return true
+		}
+		task.pickReleases(map[string][]*qualityCandidate{"01": {tt.release}}, grab, func(*qualityCandidate) {})
+		if grabbed != tt.grabbed || !reflect.DeepEqual(replaced, tt.replaced) {
+			t.Errorf("%s: grabbed = %v, replacing %v, want %v, replacing %v", tt.release.guid, grabbed, replaced, tt.grabbed, tt.replaced)
+		}
+	}
+
+	var entry *QualityEntry
+	if err := store.Update(func(state map[string]map[string]*QualityEntry) { entry = state["task"]["01"] }); err != nil {
+		t.Fatal(err)
+	}
+	if entry == nil || !entry.Grabbed || entry.Title != "Show - 01 [1080p]" || !reflect.DeepEqual(entry.InfoHashes, []string{infoHashOf(3)}) {
+		t.Errorf("entry = %+v, want the 1080p release grabbed", entry)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuietHours is a daily time window during which fetches are skipped or torrents are added paused.
+// The window wraps around midnight when Start is after End. An empty window (Start == End) disables quiet hours.
+type QuietHours struct {
+	Start int  // minutes since midnight
+	End   int  // minutes since midnight
+	Pause bool // add torrents paused instead of skipping fetches
+}
+
+// ParseQuietHours parses a window in "HH:MM-HH:MM" form and a mode, either "skip" or "pause".
+func ParseQuietHours(window string, mode string) (*QuietHours, error) {
+	from, to, found := strings.Cut(window, "-")
+	if !found {
+		return nil, errors.New("invalid quiet hours: " + window)
+	}
+	start, err := parseTimeOfDay(from)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseTimeOfDay(to)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &QuietHours{Start: start, End: end}
+	switch strings.ToLower(mode) {
+	case "", "skip":
+	case "pause":
+		q.Pause = true
+	default:
+		return nil, errors.New("invalid quiet hours mode: " + mode)
+	}
+	return q, nil
+}
+
+// Contains reports whether now falls inside the window. A nil QuietHours never contains any time.
+func (q *QuietHours) Contains(now time.Time) bool {
+	if q == nil || q.Start == q.End {
+		return false
+	}
+	m := now.Hour()*60 + now.Minute()
+	if q.Start < q.End {
+		return m >= q.Start && m < q.End
+	}
+	return m >= q.Start || m < q.End
+}
+
+// NextEnd returns the first end of the window after now.
+func (q *QuietHours) NextEnd(now time.Time) time.Time {
+	end := time.Date(now.Year(), now.Month(), now.Day(), q.End/60, q.End%60, 0, 0, now.Location())
+	if !end.After(now) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end
+}
+
+// String formats the window as "HH:MM-HH:MM (mode)", or "off" for an empty window.
+func (q *QuietHours) String() string {
+	if q == nil || q.Start == q.End {
+		return "off"
+	}
+	mode := "skip"
+	if q.Pause {
+		mode = "pause"
+	}
+	return fmt.Sprintf("%02d:%02d-%02d:%02d (%s)", q.Start/60, q.Start%60, q.End/60, q.End%60, mode)
+}
+
+// parseTimeOfDay parses "HH:MM" into minutes since midnight.
+func parseTimeOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
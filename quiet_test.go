@@ -0,0 +1,79 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	tests := []struct {
+		window, mode string
+		want         *QuietHours // nil if invalid
+	}{
+		{"01:00-07:00", "", &QuietHours{Start: 60, End: 7 * 60}},
+		{"23:30-06:15", "pause", &QuietHours{Start: 23*60 + 30, End: 6*60 + 15, Pause: true}},
+		{" 22:00 - 02:00 ", "SKIP", &QuietHours{Start: 22 * 60, End: 2 * 60}},
+		{"08:00-08:00", "", &QuietHours{Start: 8 * 60, End: 8 * 60}},
+		{"01:00", "", nil},
+		{"1am-7am", "", nil},
+		{"25:00-07:00", "", nil},
+		{"01:00-07:00", "throttle", nil},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuietHours(tt.window, tt.mode)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("ParseQuietHours(%q, %q) = %+v, want an error", tt.window, tt.mode, q)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseQuietHours(%q, %q) failed: %v", tt.window, tt.mode, err)
+		} else if *q != *tt.want {
+			t.Errorf("ParseQuietHours(%q, %q) = %+v, want %+v", tt.window, tt.mode, q, tt.want)
+		}
+	}
+}
+
+func TestQuietHoursContains(t *testing.T) {
+	day := func(hour, minute int) time.Time { return time.Date(2024, 3, 10, hour, minute, 0, 0, time.UTC) }
+	tests := []struct {
+		window string
+		now    time.Time
+		want   bool
+		end    time.Time // NextEnd of now
+	}{
+		{"01:00-07:00", day(0, 59), false, day(7, 0)},
+		{"01:00-07:00", day(1, 0), true, day(7, 0)},
+		{"01:00-07:00", day(6, 59), true, day(7, 0)},
+		{"01:00-07:00", day(7, 0), false, day(31, 0)},
+		{"23:00-06:00", day(22, 59), false, day(30, 0)},
+		{"23:00-06:00", day(23, 0), true, day(30, 0)},
+		{"23:00-06:00", day(0, 0), true, day(6, 0)},
+		{"23:00-06:00", day(5, 59), true, day(6, 0)},
+		{"23:00-06:00", day(6, 0), false, day(30, 0)},
+		{"12:00-12:00", day(12, 0), false, day(36, 0)},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuietHours(tt.window, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := q.Contains(tt.now); got != tt.want {
+			t.Errorf("%s contains %s = %v, want %v", tt.window, tt.now.Format("15:04"), got, tt.want)
+		}
+		if got := q.NextEnd(tt.now); !got.Equal(tt.end) {
+			t.Errorf("%s at %s ends at %s, want %s", tt.window, tt.now.Format("15:04"), got, tt.end)
+		}
+	}
+	var q *QuietHours
+	if q.Contains(day(3, 0)) {
+		t.Error("nil quiet hours contain 03:00")
+	}
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Prefixes of the Redis keys of cache entries and of infoHash claims.
+const (
+	redisCachePrefix = "at-rss:cache:"
+	redisClaimPrefix = "at-rss:claim:"
+)
+
+// redisTimeout bounds each Redis operation, so an unreachable server doesn't stall the fetches.
+const redisTimeout = 5 * time.Second
+
+// setIfEmpty sets the fields of a hash given as name and value pairs, unless a field already has a non-empty value.
+var setIfEmpty = redis.NewScript(`
+for i = 1, #ARGV, 2 do
+	local current = redis.call('HGET', KEYS[1], ARGV[i])
+	if not current or current == '' then
+		redis.call('HSET', KEYS[1], ARGV[i], ARGV[i + 1])
+	end
+end
+return 0
+`)
+
+// redisCache stores the cache in Redis, shared by several instances of at-rss. Each cache key is a Redis hash
+// of GUIDs to their infoHashes joined by commas.
+type redisCache struct {
+	client *redis.Client
+}
+
+// newRedisCache connects to the Redis server at url, e.g. redis://:password@host:6379/0.
+func newRedisCache(url string) (*redisCache, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, errors.New("invalid Redis URL: " + err.Error())
+	}
+	client := redis.NewClient(options)
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, errors.New("failed to connect to Redis: " + err.Error())
+	}
+	return &redisCache{client: client}, nil
+}
+
+// get returns the entries of a cache key.
+func (r *redisCache) get(key string) (map[string][]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	fields, err := r.client.HGetAll(ctx, redisCachePrefix+key).Result()
+	if err != nil {
+		return nil, err
+	}
+	value := make(map[string][]string, len(fields))
+	for guid, infoHashes := range fields {
+		if infoHashes == "" {
+			value[guid] = nil
+		} else {
+			value[guid] = strings.Split(infoHashes, ",")
+		}
+	}
+	return value, nil
+}
+
+// set stores the entries under a cache key, with the semantics of Cache.Set.
+func (r *redisCache) set(key string, value map[string][]string, overwrite bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	args := make([]interface{}, 0, 2*len(value))
+	for guid, infoHashes := range value {
+		args = append(args, guid, strings.Join(infoHashes, ","))
+	}
+	if overwrite {
+		return r.client.HSet(ctx, redisCachePrefix+key, args...).Err()
+	}
+	return setIfEmpty.Run(ctx, r.client, []string{redisCachePrefix + key}, args...).Err()
+}
+
+// removeNotIn deletes the entries of a cache key not in validEntries.
+func (r *redisCache) removeNotIn(key string, validEntries map[string][]string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	guids, err := r.client.HKeys(ctx, redisCachePrefix+key).Result()
+	if err != nil {
+		return err
+	}
+	var stale []string
+	for _, guid := range guids {
+		if _, exists := validEntries[guid]; !exists {
+			stale = append(stale, guid)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	return r.client.HDel(ctx, redisCachePrefix+key, stale...).Err()
+}
+
+// del deletes a cache key and its entries.
+func (r *redisCache) del(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return r.client.Del(ctx, redisCachePrefix+key).Err()
+}
+
+// keys returns every cache key.
+func (r *redisCache) keys() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	var keys []string
+	iter := r.client.Scan(ctx, 0, redisCachePrefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, strings.TrimPrefix(iter.Val(), redisCachePrefix))
+	}
+	return keys, iter.Err()
+}
+
+// claim reserves the infoHashes of a torrent for owner for the given time. It returns false if all of them are
+// reserved by other owners, e.g. another instance that added the torrent.
+func (r *redisCache) claim(owner string, infoHashes []string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	claimed := len(infoHashes) == 0
+	for _, infoHash := range infoHashes {
+		ok, err := r.client.SetNX(ctx, redisClaimPrefix+infoHash, owner, ttl).Result()
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			current, err := r.client.Get(ctx, redisClaimPrefix+infoHash).Result()
+			ok = err == nil && current == owner
+		}
+		claimed = claimed || ok
+	}
+	return claimed, nil
+}
+
+// release drops the reservations of owner for the infoHashes.
+func (r *redisCache) release(owner string, infoHashes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	for _, infoHash := range infoHashes {
+		current, err := r.client.Get(ctx, redisClaimPrefix+infoHash).Result()
+		if err == nil && current == owner {
+			err = r.client.Del(ctx, redisClaimPrefix+infoHash).Err()
+		}
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+	}
+	return nil
+}
+
+// claimOwner identifies a task of this instance in the claims of infoHashes.
+func claimOwner(task string) string {
+	host, _ := os.Hostname()
+	return host + ":" + strconv.Itoa(os.Getpid()) + "/" + task
+}
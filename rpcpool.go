@@ -0,0 +1,159 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// rpcIdleTimeout is how long an unused client stays open, e.g. after the task using it was removed.
+	rpcIdleTimeout = 30 * time.Minute
+	// rpcCheckInterval is how long a client is reused before checking again that the downloader answers.
+	rpcCheckInterval = time.Minute
+)
+
+// rpcClients holds the clients of the downloaders, reused by all tasks across fetches.
+var rpcClients = &rpcPool{clients: make(map[string]*rpcPoolEntry)}
+
+// rpcPool keeps one long-lived client per downloader and set of add options, so that connections and
+// the Transmission session are not set up again for every fetch.
+type rpcPool struct {
+	mu      sync.Mutex
+	clients map[string]*rpcPoolEntry
+}
+
+// rpcPoolEntry is the client of a downloader.
+type rpcPoolEntry struct {
+	mu       sync.Mutex // held while the client is checked or replaced
+	client   RpcClient  // nil until created, or after it was found broken
+	checked  time.Time  // when the downloader last answered
+	failed   atomic.Bool
+	lastUsed time.Time // guarded by rpcPool.mu
+}
+
+// get returns the client for key, created by create if there is none or the downloader stopped answering
+// the current one. Clients unused for rpcIdleTimeout are closed.
+func (p *rpcPool) get(key string, create func(ctx context.Context) (RpcClient, error)) (RpcClient, error) {
+	now := time.Now()
+	p.mu.Lock()
+	for k, e := range p.clients {
+		if k != key && now.Sub(e.lastUsed) > rpcIdleTimeout {
+			e.close()
+			delete(p.clients, k)
+		}
+	}
+	e, exists := p.clients[key]
+	if !exists {
+		e = &rpcPoolEntry{}
+		p.clients[key] = e
+	}
+	e.lastUsed = now
+	p.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.client != nil && (e.failed.Load() || now.Sub(e.checked) > rpcCheckInterval) {
+		if _, err := e.client.Version(); err != nil {
+			rpcLog.Info("Reconnecting to downloader", "err", err)
+			e.client.CloseRpc()
+			e.client = nil
+		} else {
+			e.checked = now
+			e.failed.Store(false)
+		}
+	}
+	if e.client == nil {
+		// Clients outlive the tasks sharing them, they are not bound to the context of one
+		client, err := create(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		e.client, e.checked = client, now
+		e.failed.Store(false)
+	}
+	return &pooledRpcClient{RpcClient: e.client, entry: e}, nil
+}
+
+// closeAll closes every client, when the process exits.
+func (p *rpcPool) closeAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for k, e := range p.clients {
+		e.close()
+		delete(p.clients, k)
+	}
+}
+
+// close closes the client of the entry.
+func (e *rpcPoolEntry) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.client != nil {
+		e.client.CloseRpc()
+		e.client = nil
+	}
+}
+
+// pooledRpcClient is a client of the pool lent to a caller. Closing it keeps the client open, and a
+// failed call has the downloader checked before the client is lent again.
+type pooledRpcClient struct {
+	RpcClient
+	entry *rpcPoolEntry
+}
+
+// rpcPoolKey returns the key of the client of a downloader adding torrents with the options.
+// It is built from the values of the fields, so that equal configs share a client across reloads, and holds
+// a hash of the secrets rather than the secrets themselves.
+func rpcPoolKey(s ServerConfig, o AddOptions) string {
+	secrets := sha256.Sum256([]byte(s.Token + "\x00" + s.Password))
+	return fmt.Sprintf("%s|%q|%q|%d|%q|%x|%q|%q|%g|%d|%d|%d", s.RpcType, s.Url, s.Host, s.Port, s.Username, secrets[:8],
+		o.Dir, o.Labels, o.SeedRatio, o.SeedTime, o.DownloadLimit, o.UploadLimit)
+}
+
+func (c *pooledRpcClient) AddTorrent(uri string) error {
+	return c.check(c.RpcClient.AddTorrent(uri))
+}
+
+func (c *pooledRpcClient) AddTorrentPaused(uri string) (string, error) {
+	id, err := c.RpcClient.AddTorrentPaused(uri)
+	return id, c.check(err)
+}
+
+func (c *pooledRpcClient) Resume(ids []string) error {
+	return c.check(c.RpcClient.Resume(ids))
+}
+
+func (c *pooledRpcClient) Completed(infoHashes []string) ([]string, error) {
+	finished, err := c.RpcClient.Completed(infoHashes)
+	return finished, c.check(err)
+}
+
+func (c *pooledRpcClient) Remove(infoHashes []string) error {
+	return c.check(c.RpcClient.Remove(infoHashes))
+}
+
+func (c *pooledRpcClient) Version() (string, error) {
+	version, err := c.RpcClient.Version()
+	return version, c.check(err)
+}
+
+// CloseRpc leaves the client open for the next caller.
+func (c *pooledRpcClient) CloseRpc() {}
+
+// check marks the client for a check of the downloader if err is not nil, and returns err.
+func (c *pooledRpcClient) check(err error) error {
+	if err != nil {
+		c.entry.failed.Store(true)
+	}
+	return err
+}
@@ -0,0 +1,327 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/liuzl/gocc"
+	"gopkg.in/yaml.v3"
+)
+
+// taskPosition records where a task and its keys are defined, for error reports.
+type taskPosition struct {
+	file string
+	line int
+	col  int
+	keys map[string][2]int // key -> line and column
+}
+
+// recordPositions records the positions of the tasks of a parsed file and of their keys.
+func (l *configLoader) recordPositions(filename string, root *yaml.Node) {
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return
+	}
+	mapping := root.Content[0]
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		pos := &taskPosition{file: filename, line: key.Line, col: key.Column, keys: make(map[string][2]int)}
+		if value.Kind == yaml.MappingNode {
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				pos.keys[strings.ToLower(value.Content[j].Value)] = [2]int{value.Content[j].Line, value.Content[j].Column}
+			}
+		}
+		l.positions[key.Value] = pos
+	}
+}
+
+// Names returns the task names in lexical order.
+func (s *configSource) Names() []string {
+	names := make([]string, 0, len(s.Tasks))
+	for name := range s.Tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// errorf returns an error located at the key of the task, or at the task if the key is unknown.
+// Tasks generated from a watchlist are located at their template.
+func (s *configSource) errorf(name, key, format string, args ...interface{}) error {
+	message := fmt.Sprintf("task '%s': ", name) + fmt.Sprintf(format, args...)
+	pos, exists := s.positions[name]
+	if !exists {
+		template, _, _ := strings.Cut(name, "/")
+		if pos, exists = s.positions[template]; !exists {
+			return fmt.Errorf("%s", message)
+		}
+	}
+	line, col := pos.line, pos.col
+	if keyPos, exists := pos.keys[strings.ToLower(key)]; exists {
+		line, col = keyPos[0], keyPos[1]
+	}
+	return fmt.Errorf("%s:%d:%d: %s", pos.file, line, col, message)
+}
+
+// ParseTask checks the task against the config schema and parses it. It returns every problem found.
+func (s *configSource) ParseTask(name string, cc *gocc.OpenCC) (*Task, []error) {
+	task, ok := s.Tasks[name].(map[string]interface{})
+	if !ok {
+		return nil, []error{s.errorf(name, "", "not a task")}
+	}
+	problems := checkTask(task)
+	t, err := parseTask(name, task, cc)
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			problem := schemaProblem{message: err.Error()}
+			var keyErr *KeyError
+			if errors.As(err, &keyErr) {
+				problem.key = keyErr.Key
+			}
+			problems = append(problems, problem)
+		}
+	}
+	if t != nil && t.Notify != nil {
+		for _, channel := range t.Notify.Channels {
+			if _, exists := s.notifiers[channel]; !exists {
+				problems = append(problems, schemaProblem{key: "notify", message: fmt.Sprintf("unknown notifier '%s' in 'notify'", channel)})
+			}
+		}
+	}
+	// Report problems in the order of the keys in the file
+	if pos, exists := s.positions[name]; exists {
+		sort.SliceStable(problems, func(i, j int) bool {
+			return pos.keys[strings.ToLower(problems[i].key)][0] < pos.keys[strings.ToLower(problems[j].key)][0]
+		})
+	}
+	var errs []error
+	for _, problem := range problems {
+		errs = append(errs, s.errorf(name, problem.key, "%s", problem.message))
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if t.Notify != nil && len(s.notifiers) > 0 {
+		names := t.Notify.Channels
+		if len(names) == 0 {
+			for name := range s.notifiers {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+		for _, name := range names {
+			t.Notifiers = append(t.Notifiers, s.notifiers[name])
+		}
+	}
+	// Map keys are sorted when marshaled, so equal sections give equal sources
+	if source, err := yaml.Marshal(task); err == nil {
+		t.source = string(source)
+		if len(t.Notifiers) > 0 {
+			t.source += s.notifiersSource
+		}
+	}
+	return t, nil
+}
+
+// schemaProblem is a violation of the config schema by a key of a task.
+type schemaProblem struct {
+	key     string
+	message string
+}
+
+// Keys allowed in the sections of a task.
+var (
+	aria2cKeys       = []string{"url", "token", "tokenFile", "token_file"}
+	transmissionKeys = []string{"host", "port", "username", "usernameFile", "username_file", "password", "passwordFile", "password_file"}
+	arrKeys          = []string{"url", "apiKey", "apiKeyFile", "apiKey_file"}
+	feedKeys         = []string{"url", "interval"}
+	filterKeys       = []string{"include", "exclude", "fields", "maxAge", "minAge", "watchlist"}
+	fieldFilterKeys  = []string{"field", "include", "exclude"}
+	extracterKeys    = []string{"tag", "selector", "pattern", "template"}
+	quietKeys        = []string{"hours", "mode"}
+	approvalKeys     = []string{"mode", "expire"}
+	notifyKeys       = []string{"channels", "events"}
+)
+
+// checkTask checks the keys of a task and the types of their values.
+func checkTask(task map[string]interface{}) []schemaProblem {
+	var problems []schemaProblem
+	add := func(key, format string, args ...interface{}) {
+		problems = append(problems, schemaProblem{key, fmt.Sprintf(format, args...)})
+	}
+	for k, v := range task {
+		key := strings.ToLower(k)
+		switch key {
+		case "aria2c", "transmission", "sonarr", "radarr":
+			checkServer(add, k, key, v)
+		case fallbacksKey:
+			// Other values are checked by parseFallbacksConfig
+			list, _ := v.([]interface{})
+			for _, item := range list {
+				if server, ok := item.(map[string]interface{}); ok {
+					for name, section := range server {
+						checkServer(add, k, strings.ToLower(name), section)
+					}
+				}
+			}
+		case "feed":
+			checkFeeds(add, k, v)
+		case "interval", "workers", "jitter":
+			checkInt(add, k, k, v)
+		case "schedule", "completed", "archive", "when", "dedup":
+			if _, ok := v.(string); !ok {
+				add(k, "'%s' must be a string", k)
+			}
+		case "fuzzy":
+			switch v.(type) {
+			case bool, float64, int:
+			default:
+				add(k, "'fuzzy' must be true, false or a number")
+			}
+		case "lenient", "episodes":
+			if _, ok := v.(bool); !ok {
+				add(k, "'%s' must be true or false", k)
+			}
+		case "notify":
+			// Other values are checked by parseNotifyConfig
+			if _, ok := v.(map[string]interface{}); ok {
+				checkSection(add, k, v, false, notifyKeys)
+			}
+		case "quiet":
+			if _, ok := v.(bool); !ok {
+				checkSection(add, k, v, false, quietKeys)
+			}
+		case "approval":
+			if _, ok := v.(string); !ok {
+				checkSection(add, k, v, false, approvalKeys)
+			}
+		case "filter":
+			checkSection(add, k, v, false, filterKeys)
+			if filter, ok := v.(map[string]interface{}); ok && filter["fields"] != nil {
+				rules, _ := filter["fields"].([]interface{})
+				for _, rule := range rules {
+					checkSection(add, k, rule, false, fieldFilterKeys)
+				}
+			}
+		case "extracter":
+			list, ok := v.([]interface{})
+			if !ok {
+				list = []interface{}{v}
+			}
+			for _, e := range list {
+				if mode, ok := e.(string); !ok || strings.ToLower(mode) != autoExtracter {
+					checkSection(add, k, e, false, extracterKeys)
+				}
+			}
+		case "normalize":
+			checkSection(add, k, v, false, normalizeKeys)
+			if normalize, ok := v.(map[string]interface{}); ok {
+				for _, name := range []string{"width", "kana"} {
+					if v, exists := normalize[name]; exists {
+						if _, ok := v.(bool); !ok {
+							add(k, "'%s' in normalize must be true or false", name)
+						}
+					}
+				}
+			}
+		case "quality":
+			checkSection(add, k, v, false, qualityKeys)
+			if quality, ok := v.(map[string]interface{}); ok {
+				checkInt(add, k, "wait", quality["wait"])
+			}
+		case "options":
+			checkSection(add, k, v, false, optionsKeys)
+			if options, ok := v.(map[string]interface{}); ok {
+				for _, name := range []string{"seedTime", "downloadLimit", "uploadLimit"} {
+					checkInt(add, k, name, options[name])
+				}
+			}
+		case "tags":
+			if _, ok := v.(string); !ok {
+				if _, ok := v.([]interface{}); !ok {
+					add(k, "'tags' must be a list")
+				}
+			}
+		case "vars":
+			if _, ok := v.(map[string]interface{}); !ok {
+				add(k, "'vars' must be a map")
+			}
+		default:
+			add(k, "unknown key '%s'", k)
+		}
+	}
+	sort.Slice(problems, func(i, j int) bool { return problems[i].message < problems[j].message })
+	return problems
+}
+
+// checkServer checks the section of the RPC server kind, the value of key.
+func checkServer(add func(key, format string, args ...interface{}), key, kind string, v interface{}) {
+	switch kind {
+	case "aria2c":
+		checkSection(add, key, v, true, aria2cKeys)
+	case "transmission":
+		checkSection(add, key, v, true, transmissionKeys)
+		if server, ok := v.(map[string]interface{}); ok {
+			checkInt(add, key, "port", server["port"])
+		}
+	case "sonarr", "radarr":
+		checkSection(add, key, v, true, arrKeys)
+	}
+}
+
+// checkSection checks that v is a map containing only the allowed keys. An empty section is allowed if nullable.
+func checkSection(add func(key, format string, args ...interface{}), key string, v interface{}, nullable bool, allowed []string) {
+	if v == nil && nullable {
+		return
+	}
+	section, ok := v.(map[string]interface{})
+	if !ok {
+		add(key, "'%s' must be a map", key)
+		return
+	}
+	for k := range section {
+		known := false
+		for _, a := range allowed {
+			if k == a {
+				known = true
+			}
+		}
+		if !known {
+			add(key, "unknown key '%s' in %s, expected one of %s", k, key, strings.Join(allowed, ", "))
+		}
+	}
+}
+
+// checkInt checks that v, the value of name in the section key, is an integer if set.
+func checkInt(add func(key, format string, args ...interface{}), key, name string, v interface{}) {
+	if v == nil {
+		return
+	}
+	if _, ok := v.(int); !ok {
+		add(key, "'%s' must be an integer, got %v", name, v)
+	}
+}
+
+// checkFeeds checks the structure of the feeds of the task. The URLs are checked when the task is parsed.
+func checkFeeds(add func(key, format string, args ...interface{}), key string, v interface{}) {
+	list, ok := v.([]interface{})
+	if !ok {
+		if _, ok := v.(string); !ok {
+			add(key, "'feed' must be a URL or a list of feeds")
+		}
+		return
+	}
+	for _, item := range list {
+		if feed, ok := item.(map[string]interface{}); ok {
+			checkSection(add, key, feed, false, feedKeys)
+			checkInt(add, key, "interval", feed["interval"])
+		}
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckTask(t *testing.T) {
+	type section = map[string]interface{}
+	tests := []struct {
+		name string
+		task section
+		want []string // messages of the problems, sorted
+	}{
+		{
+			name: "valid",
+			task: section{
+				"aria2c":   section{"url": "ws://nas:6800/jsonrpc", "tokenFile": "token"},
+				"feed":     []interface{}{"http://a/rss", section{"url": "http://b/rss", "interval": 30}},
+				"interval": 10,
+				"filter":   section{"include": []interface{}{"1080p"}, "fields": []interface{}{section{"field": "category", "include": "anime"}}},
+				"quiet":    false,
+				"approval": "manual",
+				"tags":     "anime",
+				"lenient":  true,
+				"fuzzy":    0.9,
+			},
+		},
+		{
+			name: "empty server section",
+			task: section{"transmission": nil, "feed": "http://a/rss"},
+		},
+		{
+			name: "unknown keys",
+			task: section{"aria2": nil, "aria2c": section{"uri": "ws://nas"}, "filter": section{"include": "a", "excludes": "b"}},
+			want: []string{
+				"unknown key 'aria2'",
+				"unknown key 'excludes' in filter, expected one of include, exclude, fields, maxAge, minAge, watchlist",
+				"unknown key 'uri' in aria2c, expected one of url, token, tokenFile, token_file",
+			},
+		},
+		{
+			name: "types",
+			task: section{
+				"transmission": section{"port": "9091"},
+				"interval":     "10",
+				"lenient":      "yes",
+				"fuzzy":        "high",
+				"schedule":     5,
+				"tags":         section{"a": 1},
+				"vars":         []interface{}{"a"},
+			},
+			want: []string{
+				"'fuzzy' must be true, false or a number",
+				"'interval' must be an integer, got 10",
+				"'lenient' must be true or false",
+				"'port' must be an integer, got 9091",
+				"'schedule' must be a string",
+				"'tags' must be a list",
+				"'vars' must be a map",
+			},
+		},
+		{
+			name: "sections",
+			task: section{"filter": "1080p", "quiet": section{"hours": "01:00-07:00", "pause": true}, "extracter": []interface{}{"auto", section{"tag": "link", "regex": "x"}}},
+			want: []string{
+				"'filter' must be a map",
+				"unknown key 'pause' in quiet, expected one of hours, mode",
+				"unknown key 'regex' in extracter, expected one of tag, selector, pattern, template",
+			},
+		},
+		{
+			name: "fallbacks",
+			task: section{"aria2c": nil, fallbacksKey: []interface{}{section{"transmission": section{"port": "x"}}, section{"sonarr": section{"key": "k"}}}},
+			want: []string{
+				"'port' must be an integer, got x",
+				"unknown key 'key' in fallbacks, expected one of url, apiKey, apiKeyFile, apiKey_file",
+			},
+		},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, problem := range checkTask(tt.task) {
+			got = append(got, problem.message)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: checkTask() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
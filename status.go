@@ -0,0 +1,218 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+const statusFileName = ".cache/at-rss-status.yml"
+
+// State of a TaskStatus.
+const (
+	stateWaiting  = "waiting" // waiting for the downloader before the first fetch
+	stateFetching = "fetching"
+	stateIdle     = "idle"
+	stateStopped  = "stopped"
+	statePaused   = "paused" // paused with the 'pause' subcommand, only shown by the 'status' subcommand
+)
+
+// TaskStatus is what a running task is doing and what its last fetch did.
+type TaskStatus struct {
+	State         string    `yaml:"state" json:"state"`
+	LastFetch     time.Time `yaml:"lastFetch,omitempty" json:"lastFetch"`
+	NextFetch     time.Time `yaml:"nextFetch,omitempty" json:"nextFetch"`
+	Seen          int       `yaml:"seen" json:"seen"`       // new items in the feeds at the last fetch
+	Matched       int       `yaml:"matched" json:"matched"` // new items passing the filter at the last fetch
+	Added         int       `yaml:"added" json:"added"`
+	Parked        int       `yaml:"parked" json:"parked"`
+	LastError     string    `yaml:"lastError,omitempty" json:"lastError,omitempty"`
+	LastErrorTime time.Time `yaml:"lastErrorTime,omitempty" json:"lastErrorTime"`
+}
+
+// StatusStore persists the status of the tasks run by the daemon, for the 'status' subcommand.
+type StatusStore struct {
+	filePath string
+}
+
+// NewStatusStore returns a StatusStore stored in the user's cache directory.
+func NewStatusStore() (*StatusStore, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return &StatusStore{filePath: filepath.Join(homeDir, statusFileName)}, nil
+}
+
+// Load returns the status of all tasks.
+func (s *StatusStore) Load() (map[string]*TaskStatus, error) {
+	statuses := make(map[string]*TaskStatus)
+	if err := loadCache(s.filePath, &statuses); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// Update lets fn modify the status of a task and saves it, holding a lock on the file meanwhile.
+func (s *StatusStore) Update(task string, fn func(status *TaskStatus)) error {
+	unlock, err := lockFile(s.filePath + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	statuses, err := s.Load()
+	if err != nil {
+		return err
+	}
+	if statuses[task] == nil {
+		statuses[task] = &TaskStatus{}
+	}
+	fn(statuses[task])
+	return writeFileAtomic(s.filePath, statuses)
+}
+
+// setStatus lets fn modify the recorded status of the task.
+func (t *Task) setStatus(fn func(status *TaskStatus)) {
+	store, err := NewStatusStore()
+	if err == nil {
+		err = store.Update(t.Name, fn)
+	}
+	if err != nil {
+		slog.Warn("Failed to record task status", "task", t.Name, "err", err)
+	}
+}
+
+// recordFetch records the result of a fetch pass in the status of the task.
+func (t *Task) recordFetch(result FetchResult) {
+	now := time.Now()
+	t.setStatus(func(status *TaskStatus) {
+		status.State = stateIdle
+		status.LastFetch = now
+		status.Seen, status.Matched, status.Added, status.Parked = result.Seen, result.Matched, result.Added, result.Parked
+		var lastError string
+		switch {
+		case result.Error != "":
+			lastError = result.Error
+		case len(result.FeedErrors) > 0:
+			lastError = result.FeedErrors[0].URL + ": " + result.FeedErrors[0].Error
+		case len(result.AddErrors) > 0:
+			lastError = result.AddErrors[0].URL + ": " + result.AddErrors[0].Error
+		}
+		if lastError != "" {
+			status.LastError, status.LastErrorTime = lastError, now
+		}
+	})
+}
+
+// statusCommand implements the 'status' subcommand.
+type statusCommand struct {
+	Tag  string `long:"tag" description:"Only show the tasks with this tag"`
+	Json bool   `long:"json" description:"Print the status as JSON"`
+}
+
+// TaskStatusSummary is the printable status of a configured task.
+type TaskStatusSummary struct {
+	Name string `json:"name"`
+	*TaskStatus
+}
+
+func init() {
+	parser.AddCommand("status",
+		"Show what the tasks are doing",
+		"Show the state of the tasks of the config file as run by the daemon: the last and next fetch, "+
+			"the items seen, matched and added by the last fetch, and the last error.",
+		&statusCommand{})
+}
+
+// Execute prints the status of the configured tasks.
+func (c *statusCommand) Execute(args []string) error {
+	tasks, err := LoadConfig(opt.Config)
+	if err != nil {
+		return err
+	}
+	store, err := NewStatusStore()
+	if err != nil {
+		return err
+	}
+	statuses, err := store.Load()
+	if err != nil {
+		return err
+	}
+	pausedStore, err := NewPausedTasks()
+	if err != nil {
+		return err
+	}
+	paused, err := pausedStore.Load()
+	if err != nil {
+		return err
+	}
+	running := daemonRunning()
+
+	summaries := []TaskStatusSummary{}
+	for _, task := range *tasks {
+		if c.Tag != "" && !task.HasTag(c.Tag) {
+			continue
+		}
+		status := statuses[task.Name]
+		if status == nil {
+			status = &TaskStatus{State: stateStopped}
+		}
+		if !running {
+			// Left behind by a daemon that was killed, or by --once
+			status.State, status.NextFetch = stateStopped, time.Time{}
+		} else if _, exists := paused[task.Name]; exists && (status.State == stateIdle || status.State == "") {
+			status.State = statePaused
+		} else if status.State == "" {
+			// The first fetch was skipped
+			status.State = stateIdle
+		}
+		summaries = append(summaries, TaskStatusSummary{Name: task.Name, TaskStatus: status})
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+	if c.Json {
+		return printJSON(summaries)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATE\tLAST FETCH\tNEXT FETCH\tSEEN\tMATCHED\tADDED\tLAST ERROR")
+	for _, s := range summaries {
+		lastError := "-"
+		if s.LastError != "" {
+			lastError = formatStatusTime(s.LastErrorTime) + " " + s.LastError
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\n", s.Name, s.State, formatStatusTime(s.LastFetch),
+			formatStatusTime(s.NextFetch), s.Seen, s.Matched, s.Added, lastError)
+	}
+	return w.Flush()
+}
+
+// formatStatusTime formats a time of the status, "-" if it is unset.
+func formatStatusTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// daemonRunning reports whether a live daemon holds the lock.
+func daemonRunning() bool {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return false
+	}
+	l := &Lock{filePath: filepath.Join(homeDir, lockFileName)}
+	pid := l.owner()
+	return pid > 0 && processAlive(pid)
+}
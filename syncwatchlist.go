@@ -0,0 +1,301 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// syncWatchlistCommand implements the 'sync-watchlist' subcommand.
+type syncWatchlistCommand struct {
+	Service  string        `long:"service" description:"Service to pull the list from" choice:"anilist" choice:"mal" choice:"trakt" required:"yes"`
+	User     string        `long:"user" description:"User whose list is pulled" required:"yes"`
+	ClientID string        `long:"client-id" description:"API client ID, required by mal and trakt"`
+	IDFile   string        `long:"client-id-file" description:"File to read the API client ID from"`
+	Output   string        `short:"o" long:"output" description:"Watchlist file to update" required:"yes"`
+	Aliases  bool          `long:"aliases" description:"Also write the English titles and synonyms of each show, separated by '|'"`
+	Every    time.Duration `long:"every" description:"Keep running and pull the list again at this interval, e.g. 6h"`
+	DryRun   bool          `long:"dry-run" description:"Only print the titles that would be added and removed"`
+}
+
+func init() {
+	parser.AddCommand("sync-watchlist",
+		"Update a watchlist file from AniList, MyAnimeList or Trakt",
+		"Pull the shows the user is currently watching and write their titles to a watchlist file. "+
+			"A running daemon picks up the change and starts or stops the generated tasks. "+
+			"Run it periodically, e.g. from cron or with --every, and use --dry-run to review the changes first. "+
+			"With --aliases, a watchlist used by a filter matches the other titles of the shows as well.",
+		&syncWatchlistCommand{})
+}
+
+// Execute pulls the list and updates the watchlist file.
+func (c *syncWatchlistCommand) Execute(args []string) error {
+	clientID := c.ClientID
+	if c.IDFile != "" {
+		id, err := os.ReadFile(c.IDFile)
+		if err != nil {
+			return err
+		}
+		clientID = strings.TrimSpace(string(id))
+	}
+
+	if c.Every <= 0 {
+		return c.sync(clientID)
+	}
+	if c.Every < time.Minute {
+		return errors.New("--every must be at least 1m")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	for {
+		if err := c.sync(clientID); err != nil {
+			slog.Warn("Failed to sync watchlist", "service", c.Service, "user", c.User, "err", err)
+		}
+		select {
+		case <-time.After(c.Every):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// sync pulls the list once and updates the watchlist file.
+func (c *syncWatchlistCommand) sync(clientID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var shows [][]string
+	var err error
+	switch c.Service {
+	case "anilist":
+		shows, err = fetchAniListWatching(ctx, c.User)
+	case "mal":
+		shows, err = fetchMALWatching(ctx, c.User, clientID)
+	case "trakt":
+		shows, err = fetchTraktWatchlist(ctx, c.User, clientID)
+	}
+	if err != nil {
+		return err
+	}
+	titles := make([]string, 0, len(shows))
+	for _, aliases := range shows {
+		if !c.Aliases {
+			aliases = aliases[:1]
+		}
+		titles = append(titles, watchlistEntry(aliases))
+	}
+	sort.Strings(titles)
+
+	var current []string
+	if _, err := os.Stat(c.Output); err == nil {
+		if current, err = parseWatchlist(c.Output); err != nil {
+			return err
+		}
+	}
+	added, removed := diffTitles(current, titles)
+	for _, title := range added {
+		fmt.Println("+ " + title)
+	}
+	for _, title := range removed {
+		fmt.Println("- " + title)
+	}
+	if c.DryRun || (len(added) == 0 && len(removed) == 0) {
+		return nil
+	}
+
+	content := "# Synced from " + c.Service + " user " + c.User + " by 'at-rss sync-watchlist'\n" + strings.Join(titles, "\n") + "\n"
+	tmpPath := c.Output + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(content), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, c.Output)
+}
+
+// watchlistEntry returns the line of a watchlist with the aliases of a show, without duplicates.
+func watchlistEntry(aliases []string) string {
+	seen := make(map[string]bool, len(aliases))
+	var unique []string
+	for _, alias := range aliases {
+		// The separator can't be part of an alias
+		alias = strings.Join(strings.Fields(strings.ReplaceAll(alias, aliasSeparator, " ")), " ")
+		if alias != "" && !seen[strings.ToLower(alias)] {
+			seen[strings.ToLower(alias)] = true
+			unique = append(unique, alias)
+		}
+	}
+	return strings.Join(unique, " "+aliasSeparator+" ")
+}
+
+// diffTitles returns the titles of next missing in current, and those of current missing in next.
+func diffTitles(current, next []string) (added, removed []string) {
+	known := make(map[string]struct{}, len(current))
+	for _, title := range current {
+		known[title] = struct{}{}
+	}
+	for _, title := range next {
+		if _, exists := known[title]; exists {
+			delete(known, title)
+		} else {
+			added = append(added, title)
+		}
+	}
+	for title := range known {
+		removed = append(removed, title)
+	}
+	sort.Strings(removed)
+	return added, removed
+}
+
+// fetchAniListWatching returns the titles of the anime the AniList user is currently watching, the romaji
+// title first, then the English title and the synonyms.
+func fetchAniListWatching(ctx context.Context, user string) ([][]string, error) {
+	query := `query ($user: String) {
+  MediaListCollection(userName: $user, type: ANIME, status: CURRENT) {
+    lists { entries { media { title { romaji english } synonyms } } }
+  }
+}`
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": map[string]string{"user": user}})
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Data struct {
+			MediaListCollection struct {
+				Lists []struct {
+					Entries []struct {
+						Media struct {
+							Title struct {
+								Romaji  string `json:"romaji"`
+								English string `json:"english"`
+							} `json:"title"`
+							Synonyms []string `json:"synonyms"`
+						} `json:"media"`
+					} `json:"entries"`
+				} `json:"lists"`
+			} `json:"MediaListCollection"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	header := http.Header{"Content-Type": {"application/json"}, "Accept": {"application/json"}}
+	if err := fetchJSON(ctx, http.MethodPost, "https://graphql.anilist.co", header, body, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Errors) > 0 {
+		return nil, errors.New("anilist: " + result.Errors[0].Message)
+	}
+	var shows [][]string
+	for _, list := range result.Data.MediaListCollection.Lists {
+		for _, entry := range list.Entries {
+			var aliases []string
+			for _, title := range append([]string{entry.Media.Title.Romaji, entry.Media.Title.English}, entry.Media.Synonyms...) {
+				if title != "" {
+					aliases = append(aliases, title)
+				}
+			}
+			if len(aliases) > 0 {
+				shows = append(shows, aliases)
+			}
+		}
+	}
+	return shows, nil
+}
+
+// fetchMALWatching returns the titles of the anime the MyAnimeList user is watching, the main title first,
+// then the English and Japanese titles and the synonyms.
+func fetchMALWatching(ctx context.Context, user, clientID string) ([][]string, error) {
+	if clientID == "" {
+		return nil, errors.New("mal requires --client-id")
+	}
+	var result struct {
+		Data []struct {
+			Node struct {
+				Title            string `json:"title"`
+				AlternativeTitle struct {
+					Synonyms []string `json:"synonyms"`
+					En       string   `json:"en"`
+					Ja       string   `json:"ja"`
+				} `json:"alternative_titles"`
+			} `json:"node"`
+		} `json:"data"`
+	}
+	endpoint := "https://api.myanimelist.net/v2/users/" + url.PathEscape(user) + "/animelist?status=watching&limit=1000&fields=alternative_titles"
+	if err := fetchJSON(ctx, http.MethodGet, endpoint, http.Header{"X-MAL-CLIENT-ID": {clientID}}, nil, &result); err != nil {
+		return nil, err
+	}
+	shows := make([][]string, 0, len(result.Data))
+	for _, item := range result.Data {
+		alternative := item.Node.AlternativeTitle
+		var aliases []string
+		for _, title := range append([]string{item.Node.Title, alternative.En, alternative.Ja}, alternative.Synonyms...) {
+			if title != "" {
+				aliases = append(aliases, title)
+			}
+		}
+		if len(aliases) > 0 {
+			shows = append(shows, aliases)
+		}
+	}
+	return shows, nil
+}
+
+// fetchTraktWatchlist returns the titles of the shows on the Trakt user's watchlist. Trakt has no aliases.
+func fetchTraktWatchlist(ctx context.Context, user, clientID string) ([][]string, error) {
+	if clientID == "" {
+		return nil, errors.New("trakt requires --client-id")
+	}
+	var result []struct {
+		Show struct {
+			Title string `json:"title"`
+		} `json:"show"`
+	}
+	endpoint := "https://api.trakt.tv/users/" + url.PathEscape(user) + "/watchlist/shows"
+	header := http.Header{"Content-Type": {"application/json"}, "trakt-api-version": {"2"}, "trakt-api-key": {clientID}}
+	if err := fetchJSON(ctx, http.MethodGet, endpoint, header, nil, &result); err != nil {
+		return nil, err
+	}
+	shows := make([][]string, 0, len(result))
+	for _, item := range result {
+		if item.Show.Title != "" {
+			shows = append(shows, []string{item.Show.Title})
+		}
+	}
+	return shows, nil
+}
+
+// fetchJSON sends a request and decodes the JSON response into result.
+func fetchJSON(ctx context.Context, method, endpoint string, header http.Header, body []byte, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s %s", endpoint, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -11,13 +11,34 @@ import (
 	"errors"
 	"html"
 	"log/slog"
+	"math/rand/v2"
+	"path/filepath"
+	"sync"
 	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/robfig/cron/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultFetchWorkers = 4
+
+// A task checks the wall clock at least every clockCheckInterval and treats a difference of more than
+// clockSkewThreshold between elapsed wall and monotonic time as a clock jump.
+const (
+	clockCheckInterval = time.Minute
+	clockSkewThreshold = time.Minute
 )
 
+// downloaderPollInterval is how often an unreachable downloader is tried while waiting for it at startup.
+const downloaderPollInterval = 10 * time.Second
+
 type ServerConfig struct {
-	RpcType  string // "aria2c" or "transmission"
-	Url      string // for aria2c rpc
-	Token    string // for aria2c rpc
+	RpcType  string // "aria2c", "transmission", "sonarr" or "radarr"
+	Url      string // for aria2c rpc, sonarr and radarr
+	Token    string // for aria2c rpc, the API key of sonarr and radarr
 	Host     string // for transmission rpc
 	Port     uint16 // for transmission rpc
 	Username string // for transmission rpc
@@ -25,59 +46,415 @@ type ServerConfig struct {
 }
 
 type Task struct {
-	ServerConfig  ServerConfig
-	FetchInterval time.Duration
-	FeedUrls      []string
-	parserConfig  *ParserConfig
-	ctx           context.Context
+	Name           string   // Task name, the key of the task in the config file
+	Tags           []string // Groups the task belongs to, for selecting tasks on the command line
+	ServerConfig   ServerConfig
+	Fallbacks      []ServerConfig // Servers tried in turn when ServerConfig fails
+	FetchInterval  time.Duration
+	Schedule       cron.Schedule // Replaces FetchInterval when set
+	ScheduleSpec   string        // Cron expression Schedule is parsed from
+	FeedUrls       []string
+	FeedIntervals  map[string]time.Duration // Per-feed overrides of FetchInterval
+	FetchWorkers   int                      // Maximum number of feeds fetched concurrently
+	Jitter         int                      // Random deviation of each fetch delay in percent, -1 inherits the global value
+	ManualApproval bool                     // Park matched items for approval instead of adding them
+	ApprovalExpiry time.Duration            // Pending items older than this are rejected, 0 keeps them forever
+	Quiet          *QuietHours              // nil inherits the global quiet hours
+	CatchUp        bool                     // Fetch missed feeds once after a clock jump instead of skipping them
+	WaitDownloader time.Duration            // Longest delay of the first fetch until the downloader responds, 0 doesn't wait
+	CompletedDir   string                   // Items whose release already exists in this directory are not added
+	Episodes       bool                     // Skip items of episodes already grabbed, e.g. re-uploads and v2 releases
+	Fuzzy          float64                  // Similarity from which a title is a near duplicate of one grabbed, 0 disables
+	Dedup          string                   // Scope of the torrents new ones are checked against: dedupGlobal, dedupTask or dedupOff
+	Quality        *QualityConfig           // Grab only the best release of each episode, nil grabs every release
+	Options        AddOptions               // Options torrents are added with, from the task and its profile
+	Notify         *NotifyConfig            // Channels and events notified, nil if notifications are off
+	Notifiers      []*namedNotifier         // Channels notified of the events of the task
+	parserConfig   *ParserConfig
+	source         string // Task section of the config file, compared on reload
+	ctx            context.Context
+	cache          *Cache
+	health         *FeedHealth
+	hosts          *HostLimiter
+	pending        *PendingStore
+	pausedIDs      []string        // Torrents added paused during quiet hours, resumed when the window ends
+	notifiedError  string          // Last error notified, not notified again while it persists
+	downFeeds      map[string]bool // Degraded feeds notified, not notified again until they recover
+}
+
+// FetchResult summarizes a fetch pass of a task.
+type FetchResult struct {
+	Seen       int         `json:"seen"`    // new items in the feeds
+	Matched    int         `json:"matched"` // new items passing the filter
+	Added      int         `json:"added"`
+	Parked     int         `json:"parked"`
+	Skipped    bool        `json:"skipped,omitempty"` // the pass was skipped for quiet hours or because the task is paused
+	Error      string      `json:"error,omitempty"`   // the RPC client could not be created
+	FeedErrors []ItemError `json:"feedErrors,omitempty"`
+	AddErrors  []ItemError `json:"addErrors,omitempty"`
+}
+
+// ItemError is an error related to a feed or torrent URL.
+type ItemError struct {
+	URL   string `json:"url"`
+	Error string `json:"error"`
 }
 
 // RpcClient is the interface for both aria2c and transmission rpc clients.
 type RpcClient interface {
 	AddTorrent(uri string) error
+	AddTorrentPaused(uri string) (string, error) // returns an id for Resume
+	Resume(ids []string) error
+	Completed(infoHashes []string) ([]string, error) // returns the infoHashes among them that finished downloading
+	Remove(infoHashes []string) error                // removes the downloads, keeping their files
+	Version() (string, error)
 	CleanUp()
 	CloseRpc()
 }
 
 // Start begins executing the task at regular intervals.
-func (t *Task) Start(ctx context.Context, cache *Cache) {
-	ticker := time.NewTicker(t.FetchInterval)
-	defer ticker.Stop()
-	t.ctx = ctx
+// Each feed is fetched at its own interval; feeds falling due together are fetched in one pass.
+func (t *Task) Start(ctx context.Context, cache *Cache, health *FeedHealth, hosts *HostLimiter, pending *PendingStore) {
+	t.attach(ctx, cache, health, hosts, pending)
+	if !t.waitForDownloader() {
+		return
+	}
 
 	// Fetch torrents initially and then repeatedly at intervals
 	// The initial invoking does not ignore processed items. In this case, configure may have been changed, and shall check processed items to apply new filters
 	// The repeated invokings ignore processed items. In this case, configure is kept unchanged.
-	t.fetchTorrents(cache, false)
+	t.runFetch(t.FeedUrls, false)
+
+	// Times are compared on the wall clock, which keeps moving while the system is suspended
+	last := time.Now()
+	now := last.Round(0)
+	nextFetch := make(map[string]time.Time, len(t.FeedUrls))
+	for _, feedUrl := range t.FeedUrls {
+		nextFetch[feedUrl] = t.nextFetchTime(feedUrl, now)
+	}
+	t.setStatus(func(status *TaskStatus) { status.NextFetch = earliest(nextFetch) })
+	timer := time.NewTimer(t.untilWakeUp(nextFetch, now))
+	defer timer.Stop()
+	defer t.setStatus(func(status *TaskStatus) { status.State, status.NextFetch = stateStopped, time.Time{} })
 	for {
 		select {
-		case <-ticker.C:
-			t.fetchTorrents(cache, true)
+		case <-timer.C:
+			current := time.Now()
+			now := current.Round(0)
+			skew := now.Sub(last.Round(0)) - current.Sub(last)
+			last = current
+			if len(t.pausedIDs) > 0 && !t.Quiet.Contains(now) {
+				t.resumePaused()
+			}
+			t.checkDownloads(nil)
+			if clockJumped(skew) {
+				slog.Warn("Clock jump detected, rescheduling fetches", "task", t.Name, "skew", skew, "catchUp", t.CatchUp)
+			}
+			requested := t.takeFetchRequest()
+			if requested {
+				slog.Info("Fetching now as requested", "task", t.Name)
+			}
+			dueFeeds := t.dueFeeds(nextFetch, now, skew, requested)
+			if len(dueFeeds) > 0 {
+				t.runFetch(dueFeeds, true)
+				t.setStatus(func(status *TaskStatus) { status.NextFetch = earliest(nextFetch) })
+			}
+			timer.Reset(t.untilWakeUp(nextFetch, time.Now().Round(0)))
 		case <-t.ctx.Done():
+			if len(t.pausedIDs) > 0 {
+				slog.Warn("Task stopped with torrents still paused for quiet hours", "ids", t.pausedIDs)
+			}
 			return
 		}
 	}
 }
 
-// fetchTorrents retrieves torrents via the appropriate RPC client.
-func (t *Task) fetchTorrents(cache *Cache, ignoreProcessed bool) {
+// HasTag reports whether the task has the tag.
+func (t *Task) HasTag(tag string) bool {
+	for _, tg := range t.Tags {
+		if tg == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// waitForDownloader delays the first fetch until the downloader responds or WaitDownloader has passed,
+// e.g. when at-rss boots before the NAS running the downloader. It returns false if the task was stopped.
+func (t *Task) waitForDownloader() bool {
+	if t.WaitDownloader <= 0 {
+		return true
+	}
+	t.setStatus(func(status *TaskStatus) { status.State = stateWaiting })
+	deadline := time.Now().Add(t.WaitDownloader)
+	for {
+		client, err := t.createRpcClient()
+		if err == nil {
+			_, err = client.Version()
+			client.CloseRpc()
+		}
+		if err == nil {
+			return true
+		}
+		if !time.Now().Before(deadline) {
+			rpcLog.Warn("Downloader still unreachable, starting anyway", "task", t.Name, "waited", t.WaitDownloader, "err", err)
+			return true
+		}
+		rpcLog.Info("Waiting for downloader", "task", t.Name, "rpcType", t.ServerConfig.RpcType, "err", err)
+		select {
+		case <-time.After(min(downloaderPollInterval, time.Until(deadline))):
+		case <-t.ctx.Done():
+			return false
+		}
+	}
+}
+
+// RunOnce fetches all feeds of the task a single time, ignoring processed items, and returns the result.
+func (t *Task) RunOnce(ctx context.Context, cache *Cache, health *FeedHealth, hosts *HostLimiter, pending *PendingStore) FetchResult {
+	t.attach(ctx, cache, health, hosts, pending)
+	return t.runFetch(t.FeedUrls, true)
+}
+
+// attach sets the context and the state shared by all tasks.
+func (t *Task) attach(ctx context.Context, cache *Cache, health *FeedHealth, hosts *HostLimiter, pending *PendingStore) {
+	t.ctx = ctx
+	t.cache = cache
+	t.health = health
+	t.hosts = hosts
+	t.pending = pending
+}
+
+// runFetch fetches the given feeds unless the task is paused or quiet hours say otherwise.
+func (t *Task) runFetch(feedUrls []string, ignoreProcessed bool) FetchResult {
+	if t.isPaused() {
+		slog.Info("Skipping fetch of paused task", "task", t.Name)
+		return FetchResult{Skipped: true}
+	}
+	paused := false
+	if t.Quiet.Contains(time.Now()) {
+		if !t.Quiet.Pause {
+			slog.Info("Skipping fetch during quiet hours", "feeds", feedUrls)
+			return FetchResult{Skipped: true}
+		}
+		paused = true
+	}
+	t.setStatus(func(status *TaskStatus) { status.State = stateFetching })
+	result := t.fetchTorrents(feedUrls, ignoreProcessed, paused)
+	t.recordFetch(result)
+	t.notifyErrors(result)
+	return result
+}
+
+// clockJumped reports whether the wall clock moved by skew more than the monotonic clock is a clock jump.
+func clockJumped(skew time.Duration) bool {
+	return skew > clockSkewThreshold || skew < -clockSkewThreshold
+}
+
+// dueFeeds returns the feeds to fetch at now, all of them if a fetch was requested, and schedules their
+// next fetch. skew is how much further the wall clock moved than the monotonic clock since the last check.
+func (t *Task) dueFeeds(nextFetch map[string]time.Time, now time.Time, skew time.Duration, requested bool) []string {
+	var due []string
+	for _, feedUrl := range t.FeedUrls {
+		// After a jump backwards, fetches would be delayed by the jump; after a jump forwards,
+		// missed fetches are either run once together or dropped
+		if clockJumped(skew) && !requested && (skew < 0 || !t.CatchUp) {
+			nextFetch[feedUrl] = t.nextFetchTime(feedUrl, now)
+			continue
+		}
+		if requested || !nextFetch[feedUrl].After(now) {
+			due = append(due, feedUrl)
+			nextFetch[feedUrl] = t.nextFetchTime(feedUrl, now)
+		}
+	}
+	return due
+}
+
+// untilWakeUp returns how long the task loop sleeps. It wakes up at least every clockCheckInterval
+// to notice jumps of the wall clock, e.g. after the system was suspended.
+func (t *Task) untilWakeUp(nextFetch map[string]time.Time, now time.Time) time.Duration {
+	return min(t.nextWakeUp(nextFetch, now).Sub(now), clockCheckInterval)
+}
+
+// nextWakeUp returns when the task loop must wake up next: the next due feed, or the end of
+// quiet hours if torrents are waiting to be resumed.
+func (t *Task) nextWakeUp(nextFetch map[string]time.Time, now time.Time) time.Time {
+	wakeUp := earliest(nextFetch)
+	if len(t.pausedIDs) > 0 {
+		if end := t.Quiet.NextEnd(now); end.Before(wakeUp) {
+			wakeUp = end
+		}
+	}
+	return wakeUp
+}
+
+// resumePaused starts the torrents added paused during quiet hours.
+func (t *Task) resumePaused() {
 	client, err := t.createRpcClient()
 	if err != nil {
-		slog.Warn("Failed to create RPC client", "rpcType", t.ServerConfig.RpcType, "err", err)
+		rpcLog.Warn("Failed to create RPC client", "rpcType", t.ServerConfig.RpcType, "err", err)
 		return
 	}
+	defer client.CloseRpc()
+
+	if err := client.Resume(t.pausedIDs); err != nil {
+		rpcLog.Warn("Failed to resume torrents after quiet hours", "ids", t.pausedIDs, "err", err)
+		return
+	}
+	rpcLog.Info("Resumed torrents after quiet hours", "count", len(t.pausedIDs))
+	t.pausedIDs = nil
+}
+
+// nextFetchTime returns when the feed is due after now, with jitter applied.
+// A per-feed interval takes precedence over the task schedule, which takes precedence over the task interval.
+func (t *Task) nextFetchTime(feedUrl string, now time.Time) time.Time {
+	var delay time.Duration
+	if interval, ok := t.FeedIntervals[feedUrl]; ok {
+		delay = interval
+	} else if t.Schedule != nil {
+		delay = t.Schedule.Next(now).Sub(now)
+	} else {
+		delay = t.FetchInterval
+	}
+	if t.Jitter > 0 {
+		// Spread fetches of tasks sharing a host so they don't hit it at the same instant
+		delay += time.Duration((rand.Float64()*2 - 1) * float64(t.Jitter) / 100 * float64(delay))
+	}
+	return now.Add(delay)
+}
+
+// earliest returns the earliest time in the map.
+func earliest(times map[string]time.Time) time.Time {
+	var result time.Time
+	for _, t := range times {
+		if result.IsZero() || t.Before(result) {
+			result = t
+		}
+	}
+	return result
+}
+
+// fetchTorrents retrieves torrents from the given feeds via the appropriate RPC client.
+// If paused is true, torrents are added paused and remembered for resumePaused.
+func (t *Task) fetchTorrents(feedUrls []string, ignoreProcessed bool, paused bool) FetchResult {
+	var result FetchResult
+	ctx, span := tracer.Start(t.ctx, "fetch", trace.WithAttributes(attribute.String("task", t.Name), attribute.Int("feeds", len(feedUrls))))
+	defer func() {
+		span.SetAttributes(attribute.Int("added", result.Added), attribute.Int("parked", result.Parked),
+			attribute.Int("feedErrors", len(result.FeedErrors)), attribute.Int("addErrors", len(result.AddErrors)))
+		if result.Error != "" {
+			span.SetStatus(codes.Error, result.Error)
+		}
+		span.End()
+	}()
+	cache, health := t.cache, t.health
+	client, err := t.createRpcClient()
+	if err != nil {
+		rpcLog.Warn("Failed to create RPC client", "rpcType", t.ServerConfig.RpcType, "err", err)
+		result.Error = err.Error()
+		return result
+	}
 	defer func() {
+		// Before the downloads finished are purged from the downloader
+		t.checkDownloads(client)
 		client.CleanUp()
 		client.CloseRpc()
 	}()
 
+	result.Added = t.applyDecisions(ctx, client, paused)
+
 	// infoHashSet keeps track of the hashes of magnet links added
-	infoHashSet := t.getAllInfoHashes(cache)
-	for _, feedUrl := range t.FeedUrls {
-		parser := NewFeedParser(t.ctx, feedUrl, t.parserConfig)
-		if parser == nil {
+	infoHashSet := t.knownInfoHashes(cache)
+	var addedInfoHashes []string
+	var history []*HistoryEntry
+	var completed completedIndex
+	if t.CompletedDir != "" {
+		if completed, err = scanCompletedDir(t.CompletedDir); err != nil {
+			slog.Warn("Failed to scan completed downloads", "dir", t.CompletedDir, "err", err)
+		}
+	}
+	var episodes, grabbedEpisodes map[string]*EpisodeEntry
+	if t.Episodes {
+		episodes, grabbedEpisodes = t.loadEpisodes(cache), make(map[string]*EpisodeEntry)
+	}
+	var titles, grabbedTitles map[string]*TitleEntry
+	if t.Fuzzy > 0 {
+		titles, grabbedTitles = t.loadTitles(cache), make(map[string]*TitleEntry)
+	}
+	var parked []*PendingItem
+	// grab parks or adds the torrent of an item. It returns false if the item is to be retried.
+	grab := func(feedUrl, guid string, item *gofeed.Item, torrent *TorrentInfo, episode string) bool {
+		if t.ManualApproval {
+			// The item stays recorded without infoHashes until it is approved, the pending item keeps them
+			// so that the approved torrent is recognized as a duplicate afterwards
+			parked = append(parked, &PendingItem{
+				ID:         pendingItemID(t.Name, guid),
+				Feed:       feedUrl,
+				GUID:       guid,
+				Title:      html.UnescapeString(item.Title),
+				URL:        torrent.URL,
+				InfoHashes: t.resolveInfoHashes(ctx, torrent),
+				Parked:     time.Now(),
+				Status:     pendingStatus,
+			})
+		} else if !t.claimInfoHashes(torrent.InfoHashes) {
+			slog.Info("Skipping torrent added by another task", "URL", torrent.URL)
+		} else if err := t.addTorrent(ctx, client, html.UnescapeString(item.Title), torrent.URL, paused); err != nil {
+			t.releaseInfoHashes(torrent.InfoHashes)
+			rpcLog.Warn("Failed to add torrent", "URL", torrent.URL, "err", err)
+			result.AddErrors = append(result.AddErrors, ItemError{URL: torrent.URL, Error: err.Error()})
+			return false
+		} else {
+			result.Added++
+			addedInfoHashes = append(addedInfoHashes, torrent.InfoHashes...)
+			title := html.UnescapeString(item.Title)
+			_, reason := (&Feed{ParserConfig: t.parserConfig}).FilterTitle(title)
+			entry := t.newHistoryEntry(title, torrent.URL, torrent.InfoHashes, feedUrl, reason)
+			entry.Size = newWhenEnv(item, time.Now()).Size
+			history = append(history, entry)
+		}
+		// Avoid adding magnet links with duplicate infoHashes when processing multiple feeds.
+		if t.Dedup != dedupOff {
+			for _, infoHash := range torrent.InfoHashes {
+				infoHashSet[infoHash] = struct{}{}
+			}
+		}
+		if episodes != nil && episode != "" {
+			episodes[episode] = &EpisodeEntry{Grabbed: time.Now(), InfoHashes: torrent.InfoHashes}
+			grabbedEpisodes[episode] = episodes[episode]
+		}
+		if titles != nil {
+			title := t.parserConfig.normalizer.Normalize(html.UnescapeString(item.Title))
+			titles[title] = newTitleEntry(title, time.Now())
+			grabbedTitles[title] = titles[title]
+		}
+		return true
+	}
+	// Releases of an episode compete for the best quality once all feeds are processed
+	candidates := make(map[string][]*qualityCandidate)
+	// Feeds are fetched concurrently but processed in configured order, so dedup across feeds stays deterministic.
+	parsers, errs := t.fetchFeeds(ctx, feedUrls)
+	for i, feedUrl := range feedUrls {
+		parser := parsers[i]
+		if errs[i] != nil {
+			// Cancellation on reload or shutdown is not a feed failure
+			if t.ctx.Err() == nil {
+				if errors.Is(errs[i], gofeed.ErrFeedTypeNotDetected) {
+					health.RecordShape(feedUrl, FeedShape{Format: notAFeed})
+				}
+				health.RecordFailure(feedUrl, errs[i])
+				t.notifyFeedDown(feedUrl, health.Get(feedUrl))
+				result.FeedErrors = append(result.FeedErrors, ItemError{URL: feedUrl, Error: errs[i].Error()})
+			}
 			continue
 		}
+		health.RecordSuccess(feedUrl)
+		delete(t.downFeeds, feedUrl)
+		if parser.ParseError != nil {
+			health.RecordParseError(feedUrl, parser.ParseError)
+		}
+		if shape, ok := feedShape(parser.Content); ok {
+			health.RecordShape(feedUrl, shape)
+		}
 		var processedItems map[string][]string
 		if ignoreProcessed {
 			processedItems = cache.Get(feedUrl) // Items processed before
@@ -91,54 +468,313 @@ func (t *Task) fetchTorrents(cache *Cache, ignoreProcessed bool) {
 					continue
 				}
 			}
+			result.Seen++
+			if _, hold, reason := parser.FilterAge(item, time.Now()); hold {
+				// Left unprocessed so it's checked again in the next fetchTorrents call
+				slog.Info("Holding item back", "title", item.Title, "reason", reason)
+				delete(newItems, guid)
+				continue
+			}
 			torrent := parser.ProcessFeedItem(item, infoHashSet)
 			if torrent == nil {
 				continue
 			}
-			if err := client.AddTorrent(torrent.URL); err != nil {
-				// Mark item as unprocessed if it fails to add, so it's retried in the next fetchTorrents call
-				slog.Warn("Failed to add torrent", "URL", torrent.URL, "err", err)
+			result.Matched++
+			// The item stays recorded as processed, as if it had been added
+			if existing := completed.Find(html.UnescapeString(item.Title)); existing != "" {
+				slog.Info("Skipping item already downloaded", "title", item.Title, "existing", filepath.Join(t.CompletedDir, existing))
+				continue
+			}
+			var episode string
+			if episodes != nil || t.Quality != nil {
+				episode = parseEpisode(html.UnescapeString(item.Title))
+			}
+			if t.Quality != nil && episode != "" {
+				// Decided after all feeds; unprocessed until then
+				candidates[episode] = append(candidates[episode], &qualityCandidate{
+					feed: feedUrl, guid: guid, item: item, torrent: torrent, score: t.Quality.Score(html.UnescapeString(item.Title)),
+				})
 				delete(newItems, guid)
-			} else {
-				// Avoid adding magnet links with duplicate infoHashes when processing multiple feeds.
-				// Store added magnet links' infoHashes
-				for _, infoHash := range torrent.InfoHashes {
-					infoHashSet[infoHash] = struct{}{}
+				continue
+			}
+			if _, grabbed := episodes[episode]; grabbed && episode != "" {
+				slog.Info("Skipping episode already grabbed", "title", item.Title, "episode", episode)
+				continue
+			}
+			if titles != nil {
+				if similar := t.similarTitle(titles, t.parserConfig.normalizer.Normalize(html.UnescapeString(item.Title))); similar != "" {
+					slog.Info("Skipping near duplicate of an item already grabbed", "title", item.Title, "grabbed", similar)
+					continue
 				}
+			}
+			if !grab(feedUrl, guid, item, torrent, episode) {
+				// Mark item as unprocessed if it fails to add, so it's retried in the next fetchTorrents call
+				delete(newItems, guid)
+			} else if !t.ManualApproval {
 				newItems[guid] = torrent.InfoHashes
 			}
 		}
 		parser.RemoveExpiredItems(cache)
 		cache.Set(feedUrl, newItems, false)
 	}
+	if len(candidates) > 0 {
+		t.pickReleases(candidates, func(c *qualityCandidate, replaced []string) bool {
+			if !grab(c.feed, c.guid, c.item, c.torrent, "") {
+				return false
+			}
+			var infoHashes []string
+			if !t.ManualApproval {
+				infoHashes = c.torrent.InfoHashes
+			}
+			// The release upgraded from goes once the upgrade is added; a parked upgrade leaves it in place
+			if len(replaced) > 0 && !t.ManualApproval {
+				if err := client.Remove(replaced); err != nil {
+					rpcLog.Warn("Failed to remove the release upgraded from", "task", t.Name, "infoHashes", replaced, "err", err)
+				}
+			}
+			cache.Set(c.feed, map[string][]string{c.guid: infoHashes}, true)
+			return true
+		}, func(c *qualityCandidate) {
+			cache.Set(c.feed, map[string][]string{c.guid: nil}, false)
+		})
+	}
+	if len(parked) > 0 {
+		result.Parked = t.park(parked)
+	}
 	cache.Flush()
+	torrentInfoHashes.Flush()
+	t.recordInfoHashes(addedInfoHashes)
+	t.settleInfoHashes(addedInfoHashes)
+	t.recordEpisodes(grabbedEpisodes)
+	t.recordTitles(grabbedTitles)
+	t.recordHistory(history)
+	t.notifyAdded(history)
+	return result
 }
 
-// createRpcClient initializes the appropriate RPC client based on RpcType.
-func (t *Task) createRpcClient() (RpcClient, error) {
-	var client RpcClient
-	var err error
+// park stores matched items in the pending store, skipping items already waiting for a decision.
+// It returns the number of newly parked items.
+func (t *Task) park(items []*PendingItem) int {
+	parked := 0
+	err := t.pending.Update(func(pending map[string][]*PendingItem) error {
+		known := make(map[string]struct{}, len(pending[t.Name]))
+		for _, item := range pending[t.Name] {
+			known[item.ID] = struct{}{}
+		}
+		for _, item := range items {
+			if _, exists := known[item.ID]; !exists {
+				pending[t.Name] = append(pending[t.Name], item)
+				parked++
+				slog.Info("Item awaiting approval", "task", t.Name, "id", item.ID, "title", item.Title)
+			}
+		}
+		if parked > 0 {
+			waiting := 0
+			for _, item := range pending[t.Name] {
+				if item.Status == pendingStatus {
+					waiting++
+				}
+			}
+			slog.Warn("Items awaiting approval", "task", t.Name, "waiting", waiting, "new", parked)
+			t.notify(&Event{Type: eventApproval, Waiting: waiting})
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Warn("Failed to park items for approval", "task", t.Name, "err", err)
+		return 0
+	}
+	return parked
+}
 
-	switch t.ServerConfig.RpcType {
-	case "aria2c":
-		client, err = NewAria2c(t.ctx, t.ServerConfig.Url, t.ServerConfig.Token)
-	case "transmission":
-		client, err = NewTransmission(t.ctx, t.ServerConfig.Host, t.ServerConfig.Port, t.ServerConfig.Username, t.ServerConfig.Password)
-	default:
-		err = errors.New("unknown RpcType: " + t.ServerConfig.RpcType)
+// resolveInfoHashes returns the infoHashes of the torrent, downloading its torrent file again if the
+// extraction couldn't, e.g. because the tracker was briefly unreachable. It returns nil if they are unknown.
+func (t *Task) resolveInfoHashes(ctx context.Context, torrent *TorrentInfo) []string {
+	if len(torrent.InfoHashes) > 0 {
+		return torrent.InfoHashes
+	}
+	if infoHashes, err := parseMagnetURI(torrent.URL); err == nil {
+		return infoHashes
+	}
+	infoHashes, _ := parseTorrentURIWithTimeout(ctx, t.hosts, torrent.URL, t.parserConfig.Archive)
+	return infoHashes
+}
+
+// applyDecisions adds approved items of the task and drops rejected and expired ones from the pending store.
+// Approved items that fail to add stay approved and are retried on the next fetch.
+// Items added manually by the 'add' subcommand are recorded in the cache.
+// It returns the number of approved items added.
+func (t *Task) applyDecisions(ctx context.Context, client RpcClient, paused bool) int {
+	if pending, err := t.pending.Load(); err != nil || len(pending[t.Name]) == 0 {
+		return 0
+	}
+
+	added := 0
+	var addedInfoHashes []string
+	var history []*HistoryEntry
+	err := t.pending.Update(func(pending map[string][]*PendingItem) error {
+		var remaining []*PendingItem
+		for _, item := range pending[t.Name] {
+			switch item.Status {
+			case approvedStatus:
+				if len(item.InfoHashes) == 0 {
+					// Parked before its infoHashes could be resolved
+					item.InfoHashes = t.resolveInfoHashes(ctx, &TorrentInfo{URL: item.URL})
+				}
+				if err := t.addTorrent(ctx, client, item.Title, item.URL, paused); err != nil {
+					rpcLog.Warn("Failed to add approved torrent", "URL", item.URL, "err", err)
+					remaining = append(remaining, item)
+					continue
+				}
+				slog.Info("Added approved item", "task", t.Name, "title", item.Title)
+				added++
+				t.cache.Set(item.Feed, map[string][]string{item.GUID: item.InfoHashes}, true)
+				addedInfoHashes = append(addedInfoHashes, item.InfoHashes...)
+				history = append(history, t.newHistoryEntry(item.Title, item.URL, item.InfoHashes, item.Feed, "approved"))
+			case addedStatus:
+				t.cache.Set(item.Feed, map[string][]string{item.GUID: item.InfoHashes}, true)
+				addedInfoHashes = append(addedInfoHashes, item.InfoHashes...)
+			case rejectedStatus:
+				slog.Info("Dropped rejected item", "task", t.Name, "title", item.Title)
+				t.dropDecided(item)
+			default:
+				if t.ApprovalExpiry > 0 && time.Since(item.Parked) > t.ApprovalExpiry {
+					slog.Info("Dropped expired item", "task", t.Name, "title", item.Title)
+					t.dropDecided(item)
+					continue
+				}
+				remaining = append(remaining, item)
+			}
+		}
+		pending[t.Name] = remaining
+		return nil
+	})
+	if err != nil {
+		slog.Warn("Failed to apply approval decisions", "task", t.Name, "err", err)
 	}
+	t.recordInfoHashes(addedInfoHashes)
+	t.recordHistory(history)
+	t.notifyAdded(history)
+	return added
+}
 
-	return client, err
+// dropDecided records a rejected or expired item as processed, so that it isn't parked again when its
+// cache entry was lost. Its infoHashes are left out, the torrent wasn't added and another item may add it.
+func (t *Task) dropDecided(item *PendingItem) {
+	t.cache.Set(item.Feed, map[string][]string{item.GUID: nil}, true)
 }
 
-func (t *Task) getAllInfoHashes(cache *Cache) map[string]struct{} {
-	infoHashSet := make(map[string]struct{})
-	for _, items := range cache.data {
-		for _, infoHashes := range items {
-			for _, infoHash := range infoHashes {
-				infoHashSet[infoHash] = struct{}{}
+// addTorrent adds the URL to the RPC client, paused if requested. Releases pushed to Sonarr or Radarr
+// are titled after the item and never paused.
+func (t *Task) addTorrent(ctx context.Context, client RpcClient, title, uri string, paused bool) (err error) {
+	_, span := tracer.Start(ctx, "rpc.add", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("rpc", t.ServerConfig.RpcType), attribute.String("url", uri), attribute.Bool("paused", paused)))
+	defer func() { endSpan(span, err) }()
+
+	if pusher, ok := client.(releasePusher); ok {
+		return pusher.PushRelease(title, uri)
+	}
+	if !paused {
+		return client.AddTorrent(uri)
+	}
+	id, err := client.AddTorrentPaused(uri)
+	if err == nil {
+		t.pausedIDs = append(t.pausedIDs, id)
+	}
+	return err
+}
+
+// fetchFeeds fetches and parses the given feeds through a bounded worker pool.
+// Results are returned in the order of feedUrls.
+func (t *Task) fetchFeeds(ctx context.Context, feedUrls []string) ([]*Feed, []error) {
+	parsers := make([]*Feed, len(feedUrls))
+	errs := make([]error, len(feedUrls))
+
+	workers := min(t.FetchWorkers, len(feedUrls))
+	if workers <= 0 {
+		workers = 1
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				feedCtx, span := tracer.Start(ctx, "feed", trace.WithAttributes(attribute.String("url", feedUrls[i])))
+				release, err := t.hosts.Acquire(feedCtx, feedUrls[i])
+				if err != nil {
+					errs[i] = err
+					endSpan(span, err)
+					continue
+				}
+				parsers[i], errs[i] = NewFeedParser(feedCtx, feedUrls[i], t.parserConfig)
+				release()
+				if errs[i] == nil {
+					parsers[i].hosts = t.hosts
+					span.SetAttributes(attribute.Int("items", len(parsers[i].Content.Items)))
+				}
+				endSpan(span, errs[i])
+			}
+		}()
+	}
+	for i := range feedUrls {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return parsers, errs
+}
+
+// createRpcClient returns the client of the first server of the task that responds, trying the fallbacks
+// in turn when ServerConfig fails. A server whose client failed a call is checked again before it is used.
+func (t *Task) createRpcClient() (RpcClient, error) {
+	if len(t.Fallbacks) == 0 {
+		return t.newRpcClient(t.ServerConfig)
+	}
+	var errs []error
+	for _, server := range append([]ServerConfig{t.ServerConfig}, t.Fallbacks...) {
+		client, err := t.newRpcClient(server)
+		if err == nil {
+			// Creating a client doesn't always reach the server
+			if _, err = client.Version(); err == nil {
+				if len(errs) > 0 {
+					rpcLog.Warn("Failed over to fallback downloader", "task", t.Name, "rpcType", server.RpcType, "endpoint", redactedEndpoint(server))
+				}
+				return client, nil
 			}
+			client.CloseRpc()
 		}
+		rpcLog.Info("Downloader failed", "task", t.Name, "rpcType", server.RpcType, "endpoint", redactedEndpoint(server), "err", err)
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// newRpcClient returns the appropriate RPC client of the server based on RpcType. Clients of torrent
+// clients are taken from the pool shared by the tasks, closing them leaves them open for reuse.
+func (t *Task) newRpcClient(server ServerConfig) (RpcClient, error) {
+	switch server.RpcType {
+	case "aria2c", "transmission":
+		return rpcClients.get(rpcPoolKey(server, t.Options), func(ctx context.Context) (RpcClient, error) {
+			return t.dialRpcClient(ctx, server)
+		})
+	default:
+		return t.dialRpcClient(t.ctx, server)
+	}
+}
+
+// dialRpcClient returns a new RPC client of the server based on RpcType, bound to ctx.
+func (t *Task) dialRpcClient(ctx context.Context, server ServerConfig) (RpcClient, error) {
+	switch server.RpcType {
+	case "aria2c":
+		return NewAria2c(ctx, server.Url, server.Token, t.Options)
+	case "transmission":
+		return NewTransmission(ctx, server.Host, server.Port, server.Username, server.Password, t.Options)
+	case "sonarr", "radarr":
+		return NewArr(ctx, server.RpcType, server.Url, server.Token)
+	default:
+		return nil, errors.New("unknown RpcType: " + server.RpcType)
 	}
-	return infoHashSet
 }
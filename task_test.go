@@ -0,0 +1,196 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeRpcClient is a downloader recording the torrents added, failing to add those in fail.
+type fakeRpcClient struct {
+	added []string
+	fail  map[string]bool
+}
+
+func (c *fakeRpcClient) AddTorrent(uri string) error {
+	if c.fail[uri] {
+		return errors.New("add failed")
+	}
+	c.added = append(c.added, uri)
+	return nil
+}
+
+func (c *fakeRpcClient) AddTorrentPaused(uri string) (string, error) {
+	return uri, c.AddTorrent(uri)
+}
+
+func (c *fakeRpcClient) Resume(ids []string) error                       { return nil }
+func (c *fakeRpcClient) Completed(infoHashes []string) ([]string, error) { return nil, nil }
+func (c *fakeRpcClient) Remove(infoHashes []string) error                { return nil }
+func (c *fakeRpcClient) Version() (string, error)                        { return "fake", nil }
+func (c *fakeRpcClient) CleanUp()                                        {}
+func (c *fakeRpcClient) CloseRpc()                                       {}
+
+// isolateHome points the home directory, and the stores kept in it, to an empty directory for the test.
+func isolateHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	saved := torrentInfoHashes
+	torrentInfoHashes = &TorrentCache{}
+	t.Cleanup(func() { torrentInfoHashes = saved })
+	return home
+}
+
+func TestDueFeeds(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	next := now.Add(10 * time.Minute) // next fetch of a feed fetched now
+	tests := []struct {
+		name      string
+		skew      time.Duration
+		catchUp   bool
+		requested bool
+		want      []string
+		nextFetch map[string]time.Time // after the check
+	}{
+		{
+			name:      "due",
+			want:      []string{"a"},
+			nextFetch: map[string]time.Time{"a": next, "b": now.Add(5 * time.Minute)},
+		},
+		{
+			name:      "small skew",
+			skew:      30 * time.Second,
+			want:      []string{"a"},
+			nextFetch: map[string]time.Time{"a": next, "b": now.Add(5 * time.Minute)},
+		},
+		{
+			name:      "jump forwards",
+			skew:      2 * time.Hour,
+			nextFetch: map[string]time.Time{"a": next, "b": next},
+		},
+		{
+			name:      "jump forwards with catch-up",
+			skew:      2 * time.Hour,
+			catchUp:   true,
+			want:      []string{"a"},
+			nextFetch: map[string]time.Time{"a": next, "b": now.Add(5 * time.Minute)},
+		},
+		{
+			name:      "jump backwards with catch-up",
+			skew:      -2 * time.Hour,
+			catchUp:   true,
+			nextFetch: map[string]time.Time{"a": next, "b": next},
+		},
+		{
+			name:      "requested after a jump",
+			skew:      2 * time.Hour,
+			requested: true,
+			want:      []string{"a", "b"},
+			nextFetch: map[string]time.Time{"a": next, "b": next},
+		},
+	}
+	for _, tt := range tests {
+		task := &Task{FeedUrls: []string{"a", "b"}, FetchInterval: 10 * time.Minute, CatchUp: tt.catchUp}
+		nextFetch := map[string]time.Time{"a": now.Add(-time.Second), "b": now.Add(5 * time.Minute)}
+		if got := task.dueFeeds(nextFetch, now, tt.skew, tt.requested); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: dueFeeds() = %v, want %v", tt.name, got, tt.want)
+		}
+		if !reflect.DeepEqual(nextFetch, tt.nextFetch) {
+			t.Errorf("%s: next fetches = %v, want %v", tt.name, nextFetch, tt.nextFetch)
+		}
+	}
+}
+
+func TestUntilWakeUp(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	quiet := &QuietHours{Start: 11 * 60, End: 12*60 + 20}
+	tests := []struct {
+		name      string
+		nextFetch time.Time
+		want      time.Duration
+	}{
+		{"next fetch", now.Add(30 * time.Second), 30 * time.Second},
+		{"clock check", now.Add(time.Hour), clockCheckInterval},
+		{"overdue", now.Add(-time.Second), -time.Second},
+	}
+	for _, tt := range tests {
+		task := &Task{Quiet: quiet}
+		if got := task.untilWakeUp(map[string]time.Time{"a": tt.nextFetch}, now); got != tt.want {
+			t.Errorf("%s: untilWakeUp() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	task := &Task{Quiet: quiet, pausedIDs: []string{"1"}}
+	if got, want := task.nextWakeUp(map[string]time.Time{"a": now.Add(time.Hour)}, now), now.Add(20*time.Minute); !got.Equal(want) {
+		t.Errorf("nextWakeUp() with paused torrents = %v, want the end of quiet hours %v", got, want)
+	}
+}
+
+func TestApplyDecisions(t *testing.T) {
+	home := isolateHome(t)
+	const feed = "http://localhost/rss"
+	magnet := func(n int) string { return buildMagnet(infoHashOf(n), "") }
+	tests := []struct {
+		name    string
+		item    *PendingItem
+		added   bool     // whether the torrent is added to the downloader
+		pending bool     // whether the item is still pending afterwards
+		cached  []string // infoHashes the item is cached with, nil if it isn't cached
+	}{
+		{"approved", &PendingItem{URL: magnet(1), InfoHashes: []string{infoHashOf(1)}, Status: approvedStatus}, true, false, []string{infoHashOf(1)}},
+		{"approved without infoHashes", &PendingItem{URL: magnet(2), Status: approvedStatus}, true, false, []string{infoHashOf(2)}},
+		{"approved failing", &PendingItem{URL: magnet(3), Status: approvedStatus}, false, true, nil},
+		{"added by the CLI", &PendingItem{URL: magnet(4), InfoHashes: []string{infoHashOf(4)}, Status: addedStatus}, false, false, []string{infoHashOf(4)}},
+		{"rejected", &PendingItem{URL: magnet(5), InfoHashes: []string{infoHashOf(5)}, Status: rejectedStatus}, false, false, []string{}},
+		{"expired", &PendingItem{URL: magnet(6), InfoHashes: []string{infoHashOf(6)}, Status: pendingStatus, Parked: time.Now().Add(-2 * time.Hour)}, false, false, []string{}},
+		{"pending", &PendingItem{URL: magnet(7), InfoHashes: []string{infoHashOf(7)}, Status: pendingStatus, Parked: time.Now()}, false, true, nil},
+	}
+	var items []*PendingItem
+	for i, tt := range tests {
+		tt.item.Feed, tt.item.GUID, tt.item.Title = feed, tt.name, tt.name
+		tt.item.ID = pendingItemID("task", tt.item.GUID)
+		if tt.item.Parked.IsZero() {
+			tt.item.Parked = time.Now().Add(-time.Duration(i) * time.Minute)
+		}
+		items = append(items, tt.item)
+	}
+	pending := &PendingStore{filePath: filepath.Join(home, pendingFileName)}
+	if err := pending.Update(func(p map[string][]*PendingItem) error { p["task"] = items; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	task := &Task{Name: "task", ServerConfig: ServerConfig{RpcType: "aria2c"}, ApprovalExpiry: time.Hour, parserConfig: &ParserConfig{}}
+	task.attach(context.Background(), &Cache{data: make(map[string]map[string][]string)}, nil, nil, pending)
+	client := &fakeRpcClient{fail: map[string]bool{magnet(3): true}}
+
+	if added := task.applyDecisions(context.Background(), client, false); added != 2 {
+		t.Errorf("applyDecisions() added %d torrents, want 2", added)
+	}
+	remaining, err := pending.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached := task.cache.Get(feed)
+	for _, tt := range tests {
+		if added := slices.Contains(client.added, tt.item.URL); added != tt.added {
+			t.Errorf("%s: added = %v, want %v", tt.name, added, tt.added)
+		}
+		isPending := slices.ContainsFunc(remaining["task"], func(item *PendingItem) bool { return item.ID == tt.item.ID })
+		if isPending != tt.pending {
+			t.Errorf("%s: pending = %v, want %v", tt.name, isPending, tt.pending)
+		}
+		infoHashes, isCached := cached[tt.name]
+		if isCached != (tt.cached != nil) || !slices.Equal(infoHashes, tt.cached) {
+			t.Errorf("%s: cached = %v %v, want %v", tt.name, isCached, infoHashes, tt.cached)
+		}
+	}
+}
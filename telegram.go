@@ -0,0 +1,55 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+const defaultTelegramApiUrl = "https://api.telegram.org"
+
+// telegramKeys are the settings of a Telegram channel.
+var telegramKeys = []string{"token", "tokenFile", "token_file", "chat", "url"}
+
+// telegramNotifier sends messages through a Telegram bot.
+type telegramNotifier struct {
+	url   string // Bot API server, the public one or a local one
+	token string
+	chat  string // Chat ID, or @username of a public channel
+}
+
+// newTelegramNotifier creates a Telegram channel from its settings: the bot token and the chat to send to.
+func newTelegramNotifier(settings map[string]interface{}) (Notifier, error) {
+	if err := checkNotifierSettings("telegram", settings, telegramKeys, "token", "chat"); err != nil {
+		return nil, err
+	}
+	token, err := getSecret(settings, "token")
+	if err != nil {
+		return nil, err
+	}
+	return &telegramNotifier{
+		url:   strings.TrimSuffix(getStringOrDefault(settings["url"], defaultTelegramApiUrl), "/"),
+		token: token,
+		chat:  convertToString(settings["chat"]),
+	}, nil
+}
+
+// Notify sends the event as a message to the chat.
+func (n *telegramNotifier) Notify(ctx context.Context, e *Event) error {
+	err := postJSON(ctx, n.url+"/bot"+n.token+"/sendMessage", map[string]interface{}{
+		"chat_id":                  n.chat,
+		"text":                     e.Text(),
+		"disable_web_page_preview": true,
+	}, nil)
+	if err != nil {
+		// The token is part of the URL quoted by connection errors
+		return errors.New(strings.ReplaceAll(err.Error(), n.token, "<token>"))
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// testFilterCommand implements the 'test-filter' subcommand.
+type testFilterCommand struct {
+	Task     string   `long:"task" description:"Use the filter and extracter of this task"`
+	Include  []string `long:"include" description:"Include keywords, comma-separated for AND; repeat for OR"`
+	Exclude  []string `long:"exclude" description:"Exclude keywords, comma-separated for AND; repeat for OR"`
+	Tag      string   `long:"tag" description:"Extracter tag, or auto to look for any magnet link or infoHash"`
+	Selector string   `long:"selector" description:"Extracter CSS selector, optionally followed by /@attr"`
+	Pattern  string   `long:"pattern" description:"Extracter pattern"`
+	Template string   `long:"template" description:"Extracter template building the URL from the named groups of the pattern"`
+	Args     struct {
+		URLs []string `positional-arg-name:"feed-url"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	parser.AddCommand("test-filter",
+		"Show which feed items a filter matches",
+		"Fetch feeds and print for every item whether it matches, why, and the URL that would be added. "+
+			"The filter is taken from --task or from the inline options. Without feed URLs, the feeds of --task are used.",
+		&testFilterCommand{})
+}
+
+// Execute fetches the feeds and prints the filter decision for every item.
+func (c *testFilterCommand) Execute(args []string) error {
+	t, err := c.task()
+	if err != nil {
+		return err
+	}
+	urls := c.Args.URLs
+	if len(urls) == 0 {
+		urls = t.FeedUrls
+	}
+	if len(urls) == 0 {
+		return errors.New("no feed URL given")
+	}
+
+	ctx := context.Background()
+	defer torrentInfoHashes.Flush()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, feedUrl := range urls {
+		feed, err := NewFeedParser(ctx, feedUrl, t.parserConfig)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "# %s\n", feedUrl)
+		fmt.Fprintln(w, "RESULT\tTITLE\tREASON")
+		for _, item := range feed.Content.Items {
+			title := html.UnescapeString(item.Title)
+			skip, reason := feed.FilterTitle(title)
+			if !skip {
+				if fieldSkip, fieldReason := feed.FilterFields(item); fieldSkip {
+					skip, reason = true, fieldReason
+				}
+			}
+			if !skip {
+				if whenSkip, whenReason := feed.FilterWhen(item); whenSkip {
+					skip, reason = true, whenReason
+				}
+			}
+			if !skip {
+				if ageSkip, hold, ageReason := feed.FilterAge(item, time.Now()); ageSkip || hold {
+					skip, reason = true, ageReason
+				}
+			}
+			if skip {
+				fmt.Fprintf(w, "skip\t%s\t%s\n", title, reason)
+				continue
+			}
+			torrent := feed.ExtractTorrent(item, nil)
+			if torrent == nil {
+				fmt.Fprintf(w, "skip\t%s\t%s, but no torrent found\n", title, reason)
+				continue
+			}
+			fmt.Fprintf(w, "match\t%s\t%s -> %s\n", title, reason, torrent.URL)
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
+
+// task returns the task named by --task, or a task built from the inline filter options.
+func (c *testFilterCommand) task() (*Task, error) {
+	inline := len(c.Include) > 0 || len(c.Exclude) > 0 || c.Tag != "" || c.Selector != "" || c.Pattern != "" || c.Template != ""
+	if c.Task != "" {
+		if inline {
+			return nil, errors.New("--task can't be combined with inline filter options")
+		}
+		tasks, err := LoadConfig(opt.Config)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range *tasks {
+			if t.Name == c.Task {
+				return t, nil
+			}
+		}
+		return nil, errors.New("no such task: " + c.Task)
+	}
+
+	normalizer := &textNormalizer{cc: newConverter()}
+	t := &Task{parserConfig: &ParserConfig{normalizer: normalizer}}
+	if normalizer.costly() {
+		t.parserConfig.titles = newTitleMemo(defaultTitleMemoSize)
+	}
+	if err := parseFilterConfig(t, map[string]interface{}{
+		"include": toInterfaceSlice(c.Include),
+		"exclude": toInterfaceSlice(c.Exclude),
+	}); err != nil {
+		return nil, err
+	}
+	if c.Tag != "" || c.Selector != "" || c.Pattern != "" || c.Template != "" {
+		var extracter interface{} = autoExtracter
+		if c.Tag != autoExtracter {
+			section := map[string]interface{}{"tag": c.Tag}
+			for key, value := range map[string]string{"selector": c.Selector, "pattern": c.Pattern, "template": c.Template} {
+				if value != "" {
+					section[key] = value
+				}
+			}
+			extracter = section
+		}
+		err := parseExtracterConfig(t, extracter)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// toInterfaceSlice converts a []string into the []interface{} form produced by the YAML decoder.
+func toInterfaceSlice(values []string) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, v := range values {
+		result[i] = v
+	}
+	return result
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+const defaultTitleMemoSize = 1024
+
+// titleMemo is a fixed-size LRU memo of raw titles to their normalized form.
+// Feed items mostly repeat between fetches, so this avoids running the Chinese converter on the same titles again.
+type titleMemo struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front is the most recently used entry
+	entries map[string]*list.Element
+}
+
+type titleMemoEntry struct {
+	raw        string
+	normalized string
+}
+
+// newTitleMemo returns a titleMemo holding at most size titles.
+func newTitleMemo(size int) *titleMemo {
+	return &titleMemo{size: size, order: list.New(), entries: make(map[string]*list.Element, size)}
+}
+
+// Get returns the normalized title memoized for raw, if any.
+func (m *titleMemo) Get(raw string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if elem, exists := m.entries[raw]; exists {
+		m.order.MoveToFront(elem)
+		return elem.Value.(*titleMemoEntry).normalized, true
+	}
+	return "", false
+}
+
+// Put memoizes the normalized form of raw, evicting the least recently used title when full.
+func (m *titleMemo) Put(raw, normalized string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if elem, exists := m.entries[raw]; exists {
+		elem.Value.(*titleMemoEntry).normalized = normalized
+		m.order.MoveToFront(elem)
+		return
+	}
+	m.entries[raw] = m.order.PushFront(&titleMemoEntry{raw, normalized})
+	if m.order.Len() > m.size {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*titleMemoEntry).raw)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// torrentCacheFileName holds the infoHashes of the torrent files downloaded, by URL.
+const torrentCacheFileName = ".cache/at-rss-torrents.yml"
+
+// torrentCacheRetention is how long the infoHashes of a torrent file are remembered after it was downloaded.
+const torrentCacheRetention = 90 * 24 * time.Hour
+
+// torrentInfoHashes remembers the infoHashes of the torrent files downloaded by all tasks.
+var torrentInfoHashes = &TorrentCache{}
+
+// TorrentCacheEntry records the infoHashes of a torrent file and when it was downloaded.
+type TorrentCacheEntry struct {
+	InfoHashes []string  `yaml:"infoHashes"`
+	Name       string    `yaml:"name,omitempty"` // Name of the torrent in its metainfo
+	Size       int64     `yaml:"size,omitempty"` // Size of the torrent file in bytes, 0 if unknown
+	Fetched    time.Time `yaml:"fetched"`
+}
+
+// TorrentCache persists the infoHashes of torrent files by URL, so that torrent files of items that failed
+// to be added or appear in several feeds are not downloaded again at every fetch. Entries are kept in
+// memory until Flush saves them.
+type TorrentCache struct {
+	once     sync.Once
+	mu       sync.Mutex
+	entries  map[string]*TorrentCacheEntry // copy of the file, loaded on first use
+	dirty    bool                          // whether entries were recorded since the last flush
+	filePath string
+}
+
+// load reads the file on first use. The cache stays empty if the home directory is unknown.
+func (c *TorrentCache) load() {
+	c.once.Do(func() {
+		c.entries = make(map[string]*TorrentCacheEntry)
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return
+		}
+		c.filePath = filepath.Join(homeDir, torrentCacheFileName)
+		if err := loadCache(c.filePath, &c.entries); err != nil && !errors.Is(err, os.ErrNotExist) {
+			feedLog.Warn("Failed to read torrent cache", "err", err)
+		}
+		if c.entries == nil {
+			c.entries = make(map[string]*TorrentCacheEntry)
+		}
+	})
+}
+
+// Get returns the entry of the torrent file at url, or nil if it wasn't downloaded before.
+func (c *TorrentCache) Get(url string) *TorrentCacheEntry {
+	c.load()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, exists := c.entries[url]
+	if !exists || time.Since(entry.Fetched) > torrentCacheRetention {
+		return nil
+	}
+	return entry
+}
+
+// Name returns the name of the torrent with the infoHash, or "" if none of the torrent files downloaded has it.
+func (c *TorrentCache) Name(infoHash string) string {
+	c.load()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, entry := range c.entries {
+		if entry.Name != "" && slices.Contains(entry.InfoHashes, infoHash) {
+			return entry.Name
+		}
+	}
+	return ""
+}
+
+// Put records the infoHashes, the name and the size of the torrent file at url, saved by the next Flush.
+func (c *TorrentCache) Put(url string, infoHashes []string, name string, size int64) {
+	c.load()
+	entry := &TorrentCacheEntry{InfoHashes: infoHashes, Name: name, Size: size, Fetched: time.Now()}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[url] = entry
+	c.dirty = true
+}
+
+// Flush saves the entries recorded since the last flush, forgetting the torrent files downloaded longer than
+// the retention ago. Entries saved meanwhile by another process are kept.
+func (c *TorrentCache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty || c.filePath == "" {
+		return
+	}
+	unlock, err := lockFile(c.filePath + ".lock")
+	if err != nil {
+		feedLog.Warn("Failed to save torrent cache", "err", err)
+		return
+	}
+	defer unlock()
+	saved := make(map[string]*TorrentCacheEntry)
+	if err := loadCache(c.filePath, &saved); err != nil && !errors.Is(err, os.ErrNotExist) {
+		feedLog.Warn("Failed to read torrent cache", "err", err)
+	}
+	for k, e := range saved {
+		if current, exists := c.entries[k]; e != nil && (!exists || current.Fetched.Before(e.Fetched)) {
+			c.entries[k] = e
+		}
+	}
+	for k, e := range c.entries {
+		if e == nil || time.Since(e.Fetched) > torrentCacheRetention {
+			delete(c.entries, k)
+		}
+	}
+	if err := writeFileAtomic(c.filePath, c.entries); err != nil {
+		feedLog.Warn("Failed to save torrent cache", "err", err)
+		return
+	}
+	c.dirty = false
+}
@@ -0,0 +1,216 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer traces the fetch pipeline: fetch, feed, extract, torrent download and RPC add spans.
+// Spans are dropped unless setupTracing configured an exporter.
+var tracer = otel.Tracer("github.com/Picking-gh/at-rss")
+
+// setupTracing exports spans via OTLP/HTTP to endpoint, or to the endpoint of the standard
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT variables if it is empty.
+// It returns a function flushing the spans not yet exported, to be called before exiting.
+func setupTracing(endpoint string) func() {
+	url := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	if endpoint != "" {
+		url = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	if url == "" {
+		return func() {}
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(&otlpExporter{url: url, client: &http.Client{Transport: httpClient.Transport, Timeout: 10 * time.Second}}),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "at-rss"))),
+	)
+	otel.SetTracerProvider(provider)
+	slog.Info("Exporting traces", "url", url)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			slog.Warn("Failed to export traces", "err", err)
+		}
+	}
+}
+
+// endSpan records err, if any, on the span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// otlpExporter sends spans to an OTLP/HTTP collector in the JSON encoding, which needs no protobuf code.
+type otlpExporter struct {
+	url    string
+	client *http.Client
+}
+
+// OTLP/JSON messages, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding.
+type (
+	otlpTraces struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              int             `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Events            []otlpEvent     `json:"events,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+	otlpEvent struct {
+		TimeUnixNano string          `json:"timeUnixNano"`
+		Name         string          `json:"name"`
+		Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpAttribute struct {
+		Key   string                 `json:"key"`
+		Value map[string]interface{} `json:"value"`
+	}
+)
+
+// ExportSpans sends the spans to the collector.
+func (e *otlpExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	resourceSpans := otlpResourceSpans{Resource: otlpResource{Attributes: otlpAttributes(spans[0].Resource().Attributes())}}
+	scopes := make(map[string]int)
+	for _, span := range spans {
+		scope := span.InstrumentationScope().Name
+		i, exists := scopes[scope]
+		if !exists {
+			i = len(resourceSpans.ScopeSpans)
+			scopes[scope] = i
+			resourceSpans.ScopeSpans = append(resourceSpans.ScopeSpans, otlpScopeSpans{Scope: otlpScope{Name: scope}})
+		}
+		resourceSpans.ScopeSpans[i].Spans = append(resourceSpans.ScopeSpans[i].Spans, newOTLPSpan(span))
+	}
+	body, err := json.Marshal(otlpTraces{ResourceSpans: []otlpResourceSpans{resourceSpans}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.New("OTLP collector returned " + resp.Status)
+	}
+	return nil
+}
+
+// Shutdown has nothing to release.
+func (e *otlpExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// newOTLPSpan converts a finished span to its OTLP/JSON form.
+func newOTLPSpan(span sdktrace.ReadOnlySpan) otlpSpan {
+	s := otlpSpan{
+		TraceID:           span.SpanContext().TraceID().String(),
+		SpanID:            span.SpanContext().SpanID().String(),
+		Name:              span.Name(),
+		Kind:              int(span.SpanKind()),
+		StartTimeUnixNano: strconv.FormatInt(span.StartTime().UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.EndTime().UnixNano(), 10),
+		Attributes:        otlpAttributes(span.Attributes()),
+	}
+	if span.Parent().IsValid() {
+		s.ParentSpanID = span.Parent().SpanID().String()
+	}
+	for _, event := range span.Events() {
+		s.Events = append(s.Events, otlpEvent{
+			TimeUnixNano: strconv.FormatInt(event.Time.UnixNano(), 10),
+			Name:         event.Name,
+			Attributes:   otlpAttributes(event.Attributes),
+		})
+	}
+	// The status codes of the SDK and OTLP differ: OTLP has 1 for ok and 2 for error
+	switch span.Status().Code {
+	case codes.Ok:
+		s.Status.Code = 1
+	case codes.Error:
+		s.Status = otlpStatus{Code: 2, Message: span.Status().Description}
+	}
+	return s
+}
+
+// otlpAttributes converts attributes to their OTLP/JSON form.
+func otlpAttributes(attributes []attribute.KeyValue) []otlpAttribute {
+	result := make([]otlpAttribute, 0, len(attributes))
+	for _, kv := range attributes {
+		var value map[string]interface{}
+		switch kv.Value.Type() {
+		case attribute.BOOL:
+			value = map[string]interface{}{"boolValue": kv.Value.AsBool()}
+		case attribute.INT64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(kv.Value.AsInt64(), 10)}
+		case attribute.FLOAT64:
+			value = map[string]interface{}{"doubleValue": kv.Value.AsFloat64()}
+		default:
+			value = map[string]interface{}{"stringValue": kv.Value.Emit()}
+		}
+		result = append(result, otlpAttribute{Key: string(kv.Key), Value: value})
+	}
+	return result
+}
@@ -8,6 +8,9 @@ package main
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"time"
 
 	"github.com/hekmon/transmissionrpc/v2"
 )
@@ -15,11 +18,12 @@ import (
 // Transmission handle the transmission api request
 type Transmission struct {
 	*transmissionrpc.Client
-	ctx context.Context
+	ctx     context.Context
+	options AddOptions
 }
 
 // NewTransmission return a new Transmission object
-func NewTransmission(ctx context.Context, host string, port uint16, user string, pswd string) (*Transmission, error) {
+func NewTransmission(ctx context.Context, host string, port uint16, user string, pswd string, options AddOptions) (*Transmission, error) {
 
 	t, err := transmissionrpc.New(host, user, pswd,
 		&transmissionrpc.AdvancedConfig{
@@ -28,15 +32,136 @@ func NewTransmission(ctx context.Context, host string, port uint16, user string,
 	if err != nil {
 		return nil, err
 	}
-	return &Transmission{t, ctx}, nil
+	return &Transmission{t, ctx, options}, nil
 }
 
 // Add add a new magnet link to the transmission server
 func (t *Transmission) AddTorrent(magnet string) error {
-	_, err := t.TorrentAdd(t.ctx, transmissionrpc.TorrentAddPayload{
-		Filename: &magnet,
-	})
-	return err
+	torrent, err := t.TorrentAdd(t.ctx, t.addPayload(magnet, false))
+	if err != nil {
+		return err
+	}
+	return t.applyOptions(torrent)
+}
+
+// AddTorrentPaused adds a new magnet link in paused state and returns its hash
+func (t *Transmission) AddTorrentPaused(magnet string) (string, error) {
+	torrent, err := t.TorrentAdd(t.ctx, t.addPayload(magnet, true))
+	if err != nil {
+		return "", err
+	}
+	if err := t.applyOptions(torrent); err != nil {
+		return "", err
+	}
+	if torrent.HashString == nil {
+		return "", errors.New("transmission returned no hash for added torrent")
+	}
+	return *torrent.HashString, nil
+}
+
+// addPayload returns the request adding the magnet link with the download directory of the options.
+func (t *Transmission) addPayload(magnet string, paused bool) transmissionrpc.TorrentAddPayload {
+	payload := transmissionrpc.TorrentAddPayload{Filename: &magnet}
+	if paused {
+		payload.Paused = &paused
+	}
+	if t.options.Dir != "" {
+		payload.DownloadDir = &t.options.Dir
+	}
+	return payload
+}
+
+// applyOptions sets the labels, seed limits and speed limits of the options on an added torrent.
+// Transmission has no seed time limit, the seed time is applied as its idle seeding limit.
+func (t *Transmission) applyOptions(torrent transmissionrpc.Torrent) error {
+	o := t.options
+	if len(o.Labels) == 0 && o.SeedRatio == 0 && o.SeedTime == 0 && o.DownloadLimit == 0 && o.UploadLimit == 0 {
+		return nil
+	}
+	if torrent.ID == nil {
+		return errors.New("transmission returned no id for added torrent")
+	}
+	payload := transmissionrpc.TorrentSetPayload{IDs: []int64{*torrent.ID}, Labels: o.Labels}
+	enabled := true
+	if o.SeedRatio > 0 {
+		mode := transmissionrpc.SeedRatioModeCustom
+		payload.SeedRatioLimit = &o.SeedRatio
+		payload.SeedRatioMode = &mode
+	}
+	if o.SeedTime > 0 {
+		limit := time.Duration(o.SeedTime) * time.Minute
+		mode := int64(1) // Use the idle limit of the torrent
+		payload.SeedIdleLimit = &limit
+		payload.SeedIdleMode = &mode
+	}
+	if o.DownloadLimit > 0 {
+		limit := int64(o.DownloadLimit)
+		payload.DownloadLimit = &limit
+		payload.DownloadLimited = &enabled
+	}
+	if o.UploadLimit > 0 {
+		limit := int64(o.UploadLimit)
+		payload.UploadLimit = &limit
+		payload.UploadLimited = &enabled
+	}
+	return t.TorrentSet(t.ctx, payload)
+}
+
+// Resume starts the torrents with the given hashes
+func (t *Transmission) Resume(hashes []string) error {
+	return t.TorrentStartHashes(t.ctx, hashes)
+}
+
+// Completed returns the hashes among the given ones of the torrents that finished downloading
+func (t *Transmission) Completed(hashes []string) ([]string, error) {
+	torrents, err := t.TorrentGetHashes(t.ctx, []string{"hashString", "percentDone", "metadataPercentComplete"}, hashes)
+	if err != nil {
+		return nil, err
+	}
+	var finished []string
+	for _, torrent := range torrents {
+		// Without metadata, the size of a magnet link is unknown
+		if torrent.HashString == nil || torrent.PercentDone == nil || *torrent.PercentDone < 1 ||
+			(torrent.MetadataPercentComplete != nil && *torrent.MetadataPercentComplete < 1) {
+			continue
+		}
+		finished = append(finished, strings.ToLower(*torrent.HashString))
+	}
+	return finished, nil
+}
+
+// Remove removes the torrents with the given hashes, keeping their data
+func (t *Transmission) Remove(hashes []string) error {
+	// Without hashes, all torrents would be returned
+	if len(hashes) == 0 {
+		return nil
+	}
+	torrents, err := t.TorrentGetHashes(t.ctx, []string{"id"}, hashes)
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for _, torrent := range torrents {
+		if torrent.ID != nil {
+			ids = append(ids, *torrent.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return t.TorrentRemove(t.ctx, transmissionrpc.TorrentRemovePayload{IDs: ids})
+}
+
+// Version returns the version of the transmission server, failing if it is unreachable
+func (t *Transmission) Version() (string, error) {
+	session, err := t.SessionArgumentsGet(t.ctx, []string{"version"})
+	if err != nil {
+		return "", err
+	}
+	if session.Version == nil {
+		return "", nil
+	}
+	return *session.Version, nil
 }
 
 // Close do nothing but satisfy RpcClient interface
@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// validateCommand implements the 'validate' subcommand.
+type validateCommand struct {
+	Rpc  bool `long:"rpc" description:"Also check that the RPC server of each task is reachable"`
+	Json bool `long:"json" description:"Print the report as JSON"`
+}
+
+// TaskReport is the validation result of a single task.
+type TaskReport struct {
+	Task    string   `json:"task"`
+	Error   string   `json:"error,omitempty"`  // first of Errors
+	Errors  []string `json:"errors,omitempty"` // every problem found, located by file, line and column
+	RpcType string   `json:"rpcType,omitempty"`
+	Feeds   int      `json:"feeds,omitempty"`
+	Rpc     string   `json:"rpc,omitempty"` // RPC server version or connection error, set with --rpc
+	Valid   bool     `json:"valid"`
+}
+
+func init() {
+	parser.AddCommand("validate",
+		"Validate the config file",
+		"Parse every task of the config file, report the errors found and exit with a non-zero code if any.",
+		&validateCommand{})
+}
+
+// Execute validates the config file given by --conf.
+func (c *validateCommand) Execute(args []string) error {
+	src, err := loadYAMLConfig(opt.Config)
+	if err != nil {
+		return err
+	}
+	cc := newConverter()
+
+	valid := true
+	reports := make([]TaskReport, 0, len(src.Tasks))
+	for _, name := range src.Names() {
+		report := TaskReport{Task: name}
+		task, errs := src.ParseTask(name, cc)
+		if len(errs) > 0 {
+			for _, err := range errs {
+				report.Errors = append(report.Errors, err.Error())
+			}
+			report.Error = report.Errors[0]
+			reports = append(reports, report)
+			valid = false
+			continue
+		}
+		report.RpcType = task.ServerConfig.RpcType
+		report.Feeds = len(task.FeedUrls)
+		report.Valid = true
+		if c.Rpc {
+			version, err := checkRpc(task)
+			if err != nil {
+				report.Rpc = "unreachable: " + err.Error()
+				report.Valid = false
+				valid = false
+			} else {
+				report.Rpc = "ok " + version
+			}
+		}
+		reports = append(reports, report)
+	}
+
+	if c.Json {
+		if err := printJSON(reports); err != nil {
+			return err
+		}
+	} else {
+		for _, report := range reports {
+			if len(report.Errors) > 0 {
+				for _, err := range report.Errors {
+					fmt.Printf("error: %s\n", err)
+				}
+				continue
+			}
+			fmt.Printf("%s: ok (%s, %d feeds)\n", report.Task, report.RpcType, report.Feeds)
+			if report.Rpc != "" {
+				fmt.Printf("%s: rpc %s\n", report.Task, report.Rpc)
+			}
+		}
+	}
+
+	if !valid {
+		return errors.New("configuration is invalid: " + opt.Config)
+	}
+	return nil
+}
+
+// checkRpc connects to the RPC server of the task, or failing that to its fallbacks, and returns its version.
+// The clients are not taken from the pool, whose clients outlive the timeout.
+func checkRpc(t *Task) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var errs []error
+	for _, server := range append([]ServerConfig{t.ServerConfig}, t.Fallbacks...) {
+		client, err := t.dialRpcClient(ctx, server)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		version, err := client.Version()
+		client.CloseRpc()
+		if err == nil {
+			return version, nil
+		}
+		errs = append(errs, err)
+	}
+	return "", errors.Join(errs...)
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// varRef matches a variable reference such as ${vars.group}.
+var varRef = regexp.MustCompile(`\$\{vars\.([A-Za-z0-9_-]+)\}`)
+
+// parseVarsConfig processes the vars section, a map of names to scalar values.
+func parseVarsConfig(v interface{}) (map[string]string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	raw, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid 'vars': must be a map of names to values")
+	}
+	vars := make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch value.(type) {
+		case string, int, int64, float64, bool:
+			vars[name] = convertToString(value)
+		default:
+			return nil, errors.New("invalid 'vars': value of '" + name + "' is not a scalar")
+		}
+	}
+	return vars, nil
+}
+
+// interpolateVars replaces variable references in every string of v, a value of the config file.
+// Values inserted into a 'pattern' are escaped so that they match literally.
+func interpolateVars(v interface{}, vars map[string]string) (interface{}, error) {
+	return interpolate(v, vars, false)
+}
+
+func interpolate(v interface{}, vars map[string]string, quote bool) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		var err error
+		result := varRef.ReplaceAllStringFunc(v, func(ref string) string {
+			name := varRef.FindStringSubmatch(ref)[1]
+			value, exists := vars[name]
+			if !exists {
+				err = errors.New("undefined variable '" + ref + "'")
+				return ref
+			}
+			if quote {
+				return regexp.QuoteMeta(value)
+			}
+			return value
+		})
+		return result, err
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			var err error
+			if result[i], err = interpolate(item, vars, quote); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			var err error
+			if result[key], err = interpolate(item, vars, quote || strings.ToLower(key) == "pattern"); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	default:
+		return v, nil
+	}
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInterpolateVars(t *testing.T) {
+	vars := map[string]string{"group": "Sub.Group", "res": "1080p", "season": "2"}
+	tests := []struct {
+		name string
+		v    interface{}
+		want interface{} // nil if an error is expected
+	}{
+		{"no reference", "plain", "plain"},
+		{"string", "${vars.group}, ${vars.res}", "Sub.Group, 1080p"},
+		{"unknown syntax kept", "$vars.group ${group} ${vars.}", "$vars.group ${group} ${vars.}"},
+		{"list", []interface{}{"${vars.res}", 5}, []interface{}{"1080p", 5}},
+		{
+			"filter",
+			map[string]interface{}{"include": []interface{}{"${vars.group}, S${vars.season}"}, "maxAge": 24},
+			map[string]interface{}{"include": []interface{}{"Sub.Group, S2"}, "maxAge": 24},
+		},
+		{
+			"pattern escaped",
+			map[string]interface{}{"tag": "title", "pattern": `\[${vars.group}\] (\w+)`},
+			map[string]interface{}{"tag": "title", "pattern": `\[Sub\.Group\] (\w+)`},
+		},
+		{
+			"extracter list",
+			[]interface{}{map[string]interface{}{"Pattern": "${vars.res}", "template": "${vars.group}"}},
+			[]interface{}{map[string]interface{}{"Pattern": "1080p", "template": "Sub.Group"}},
+		},
+		{"undefined", "${vars.missing}", nil},
+		{"undefined nested", map[string]interface{}{"exclude": []interface{}{"${vars.missing}"}}, nil},
+	}
+	for _, tt := range tests {
+		got, err := interpolateVars(tt.v, vars)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%s: interpolateVars(%v) = %v, want an error", tt.name, tt.v, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: interpolateVars(%v) failed: %v", tt.name, tt.v, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: interpolateVars(%v) = %v, want %v", tt.name, tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestParseVarsConfig(t *testing.T) {
+	vars, err := parseVarsConfig(map[string]interface{}{"group": "SubGroup", "season": 2, "hevc": true})
+	if want := map[string]string{"group": "SubGroup", "season": "2", "hevc": "true"}; err != nil || !reflect.DeepEqual(vars, want) {
+		t.Errorf("parseVarsConfig() = %v, %v, want %v", vars, err, want)
+	}
+	for _, v := range []interface{}{"group", []interface{}{"a"}, map[string]interface{}{"list": []interface{}{"a"}}} {
+		if _, err := parseVarsConfig(v); err == nil {
+			t.Errorf("parseVarsConfig(%v) succeeded, want an error", v)
+		}
+	}
+}
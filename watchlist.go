@@ -0,0 +1,180 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// watchlistKey is the task key turning the task into a template stamped out once per watchlist title.
+const watchlistKey = "watchlist"
+
+// aliasSeparator separates the aliases of a title on a line of a watchlist, e.g. "Sousou no Frieren | Frieren".
+const aliasSeparator = "|"
+
+// resolveWatchlists makes the relative watchlist files of the task, the template one and the one of its
+// filter, relative to dir, the directory of the config file defining it. It returns the watchlist files.
+func resolveWatchlists(task map[string]interface{}, dir string) []string {
+	var files []string
+	resolve := func(section map[string]interface{}) {
+		file, ok := section[watchlistKey].(string)
+		if !ok || file == "" {
+			return
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+			section[watchlistKey] = file
+		}
+		files = append(files, file)
+	}
+	resolve(task)
+	if key, exists := lookupKey(task, "filter"); exists {
+		if filter, ok := task[key].(map[string]interface{}); ok {
+			resolve(filter)
+		}
+	}
+	return files
+}
+
+// expandWatchlists replaces every task with a watchlist by one task per title, named "<task>/<title>".
+// The title, the first of its aliases, is available to the generated tasks as ${vars.title}. The watchlist
+// of a filter is replaced by its titles and their aliases added to the include keywords.
+func expandWatchlists(config map[string]interface{}) error {
+	for name, value := range config {
+		task, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if err := expandFilterWatchlist(task); err != nil {
+			return fmt.Errorf("task '%s': %w", name, err)
+		}
+		list, exists := task[watchlistKey]
+		if !exists {
+			continue
+		}
+		entries, err := parseWatchlist(list)
+		if err != nil {
+			return fmt.Errorf("task '%s': %w", name, err)
+		}
+		delete(config, name)
+		for _, entry := range entries {
+			title := watchlistAliases(entry)[0]
+			generated := make(map[string]interface{}, len(task))
+			for k, v := range task {
+				generated[k] = v
+			}
+			delete(generated, watchlistKey)
+			vars := map[string]interface{}{"title": title}
+			if taskVars, ok := task["vars"].(map[string]interface{}); ok {
+				for k, v := range taskVars {
+					vars[k] = v
+				}
+				vars["title"] = title
+			}
+			generated["vars"] = vars
+
+			generatedName := name + "/" + title
+			if _, exists := config[generatedName]; exists {
+				return fmt.Errorf("task '%s' generated from watchlist is already defined", generatedName)
+			}
+			config[generatedName] = generated
+		}
+	}
+	return nil
+}
+
+// expandFilterWatchlist adds the titles of the watchlist of the filter of the task, and their aliases, to
+// its include keywords. The filter is copied, it may be shared with other tasks through the defaults.
+func expandFilterWatchlist(task map[string]interface{}) error {
+	key, exists := lookupKey(task, "filter")
+	if !exists {
+		return nil
+	}
+	filter, ok := task[key].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	list, exists := filter[watchlistKey]
+	if !exists {
+		return nil
+	}
+	entries, err := parseWatchlist(list)
+	if err != nil {
+		return fmt.Errorf("invalid 'watchlist' in 'filter': %w", err)
+	}
+	expanded := make(map[string]interface{}, len(filter))
+	for k, v := range filter {
+		expanded[k] = v
+	}
+	delete(expanded, watchlistKey)
+	var include []interface{}
+	switch v := expanded["include"].(type) {
+	case []interface{}:
+		include = append(include, v...)
+	case string:
+		include = append(include, v)
+	}
+	for _, entry := range entries {
+		for _, alias := range watchlistAliases(entry) {
+			include = append(include, alias)
+		}
+	}
+	expanded["include"] = include
+	task[key] = expanded
+	return nil
+}
+
+// watchlistAliases returns the aliases of a line of a watchlist, the title first.
+func watchlistAliases(entry string) []string {
+	var aliases []string
+	for _, alias := range strings.Split(entry, aliasSeparator) {
+		if alias = strings.TrimSpace(alias); alias != "" {
+			aliases = append(aliases, alias)
+		}
+	}
+	if len(aliases) == 0 {
+		return []string{entry}
+	}
+	return aliases
+}
+
+// parseWatchlist returns the titles of a watchlist, either a list or a file with one title per line.
+// Blank lines and lines starting with '#' are ignored.
+func parseWatchlist(v interface{}) ([]string, error) {
+	var titles []string
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if title := strings.TrimSpace(convertToString(item)); title != "" {
+				titles = append(titles, title)
+			}
+		}
+	case string:
+		file, err := os.Open(v)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if title := strings.TrimSpace(scanner.Text()); title != "" && !strings.HasPrefix(title, "#") {
+				titles = append(titles, title)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("invalid 'watchlist': must be a list of titles or a file")
+	}
+	return titles, nil
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+// webhookKeys are the settings of a webhook channel.
+var webhookKeys = []string{"url", "urlFile", "url_file", "method", "headers", "body", "contentType"}
+
+// webhookFuncs are the functions of webhook body templates besides the builtin ones.
+var webhookFuncs = template.FuncMap{
+	// json encodes a value as JSON, e.g. a string with its quotes, to be inserted in a JSON body
+	"json": func(v interface{}) (string, error) {
+		content, err := json.Marshal(v)
+		return string(content), err
+	},
+	"size": formatSize,
+}
+
+// webhookNotifier sends events to any URL, with a body built by a template.
+type webhookNotifier struct {
+	url         string
+	method      string
+	header      http.Header
+	body        *template.Template // nil sends the event as JSON
+	contentType string
+}
+
+// newWebhookNotifier creates a webhook channel from its settings: the URL, and optionally the method,
+// headers, body template and its content type.
+func newWebhookNotifier(settings map[string]interface{}) (Notifier, error) {
+	if err := checkNotifierSettings("webhook", settings, webhookKeys, "url"); err != nil {
+		return nil, err
+	}
+	target, err := getSecret(settings, "url")
+	if err != nil {
+		return nil, err
+	}
+	if u, err := url.Parse(target); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, errors.New("invalid 'url' in webhook: must be an http or https URL")
+	}
+	n := &webhookNotifier{
+		url:         target,
+		method:      strings.ToUpper(getStringOrDefault(settings["method"], http.MethodPost)),
+		header:      http.Header{},
+		contentType: getStringOrDefault(settings["contentType"], "application/json"),
+	}
+	switch n.method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return nil, errors.New("invalid 'method' in webhook: must be POST, PUT or PATCH")
+	}
+	if v, exists := settings["headers"]; exists {
+		headers, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("invalid 'headers' in webhook: must be a map of names to values")
+		}
+		for name, value := range headers {
+			n.header.Set(name, convertToString(value))
+		}
+	}
+	if v, exists := settings["body"]; exists {
+		source, ok := v.(string)
+		if !ok {
+			return nil, errors.New("invalid 'body' in webhook: must be a template")
+		}
+		if n.body, err = parseWebhookTemplate(source); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// parseWebhookTemplate parses a body template and checks it against an event of each type.
+func parseWebhookTemplate(source string) (*template.Template, error) {
+	t, err := template.New("body").Funcs(webhookFuncs).Parse(source)
+	if err != nil {
+		return nil, errors.New("invalid 'body' in webhook: " + err.Error())
+	}
+	for _, e := range []*Event{
+		{Type: eventAdded, Torrent: &HistoryEntry{}},
+		{Type: eventError, Error: "error"},
+		{Type: eventApproval, Waiting: 1},
+	} {
+		if err := t.Execute(&bytes.Buffer{}, e); err != nil {
+			return nil, errors.New("invalid 'body' in webhook: " + err.Error())
+		}
+	}
+	return t, nil
+}
+
+// Notify sends the event to the URL.
+func (n *webhookNotifier) Notify(ctx context.Context, e *Event) error {
+	var body bytes.Buffer
+	if n.body == nil {
+		if err := json.NewEncoder(&body).Encode(e); err != nil {
+			return err
+		}
+	} else if err := n.body.Execute(&body, e); err != nil {
+		return fmt.Errorf("body template: %w", err)
+	}
+	return send(ctx, n.method, n.url, n.contentType, body.Bytes(), n.header)
+}
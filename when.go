@@ -0,0 +1,149 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"errors"
+	"html"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/mmcdole/gofeed"
+)
+
+// whenEnv is the item as seen by a 'when' expression. Sizes are in bytes and may be compared
+// with the KB, MB, GB and TB constants, e.g. size < 8 * GB; unknown numbers are 0.
+type whenEnv struct {
+	Title       string    `expr:"title"`
+	Description string    `expr:"description"`
+	Link        string    `expr:"link"`
+	Author      string    `expr:"author"`
+	Categories  []string  `expr:"categories"`
+	Size        int64     `expr:"size"`
+	Seeders     int       `expr:"seeders"`
+	Leechers    int       `expr:"leechers"`
+	PubDate     time.Time `expr:"pubDate"`
+	Age         float64   `expr:"age"` // hours since pubDate
+	KB          int64     `expr:"KB"`
+	MB          int64     `expr:"MB"`
+	GB          int64     `expr:"GB"`
+	TB          int64     `expr:"TB"`
+}
+
+// parseWhen compiles the 'when' expression of a task.
+func parseWhen(v interface{}) (*vm.Program, error) {
+	source, ok := v.(string)
+	if !ok || strings.TrimSpace(source) == "" {
+		return nil, errors.New("invalid 'when': must be an expression")
+	}
+	program, err := expr.Compile(source, expr.Env(whenEnv{}), expr.AsBool())
+	if err != nil {
+		return nil, errors.New("invalid 'when': " + err.Error())
+	}
+	return program, nil
+}
+
+// FilterWhen checks if an item should be skipped based on the 'when' expression of the task.
+// An expression failing on an item skips it. It also returns the reason of the decision.
+func (f *Feed) FilterWhen(item *gofeed.Item) (bool, string) {
+	if f.When == nil {
+		return false, ""
+	}
+	matched, err := expr.Run(f.When, newWhenEnv(item, time.Now()))
+	if err != nil {
+		slog.Warn("Failed to evaluate 'when'", "title", item.Title, "err", err)
+		return true, "'when' failed: " + err.Error()
+	}
+	if matched != true {
+		return true, "'when' is false"
+	}
+	return false, ""
+}
+
+// newWhenEnv collects the values of an item for a 'when' expression. Seeders, leechers and sizes not given
+// by an enclosure are taken from extension elements such as nyaa:seeders and nyaa:size.
+func newWhenEnv(item *gofeed.Item, now time.Time) whenEnv {
+	env := whenEnv{
+		Title:       html.UnescapeString(item.Title),
+		Description: html.UnescapeString(item.Description),
+		Link:        item.Link,
+		Categories:  item.Categories,
+		KB:          1 << 10,
+		MB:          1 << 20,
+		GB:          1 << 30,
+		TB:          1 << 40,
+	}
+	if len(item.Authors) > 0 {
+		env.Author = strings.TrimSpace(item.Authors[0].Name + " " + item.Authors[0].Email)
+	}
+	if age, ok := itemAge(item, now); ok {
+		env.PubDate = now.Add(-age)
+		env.Age = age.Hours()
+	}
+	for _, enclosure := range item.Enclosures {
+		if size, err := strconv.ParseInt(enclosure.Length, 10, 64); err == nil && size > 0 {
+			env.Size = size
+		}
+	}
+	for _, elements := range item.Extensions {
+		for name, exts := range elements {
+			if len(exts) == 0 {
+				continue
+			}
+			value := strings.TrimSpace(exts[0].Value)
+			switch strings.ToLower(name) {
+			case "seeders", "seeds":
+				env.Seeders, _ = strconv.Atoi(value)
+			case "leechers", "peers":
+				env.Leechers, _ = strconv.Atoi(value)
+			case "size", "contentlength":
+				if env.Size == 0 {
+					env.Size = parseSize(value)
+				}
+			}
+		}
+	}
+	return env
+}
+
+var sizePattern = regexp.MustCompile(`^(?i)([\d.]+)\s*([KMGT]?)(i?B)?$`)
+
+// parseSize parses a size such as "1.4 GiB", "700 MB" or a number of bytes. It returns 0 if the size is invalid.
+func parseSize(s string) int64 {
+	m := sizePattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0
+	}
+	exponent := 0
+	if m[2] != "" {
+		exponent = strings.Index("KMGT", strings.ToUpper(m[2])) + 1
+	}
+	return int64(n * float64(int64(1)<<(10*exponent)))
+}
+
+// formatSize formats a number of bytes, e.g. "1.4 GiB".
+func formatSize(size int64) string {
+	if size < 1<<10 {
+		return strconv.FormatInt(size, 10) + " B"
+	}
+	exponent := 0
+	value := float64(size)
+	for value >= 1<<10 && exponent < 4 {
+		value /= 1 << 10
+		exponent++
+	}
+	return strconv.FormatFloat(value, 'f', 1, 64) + " " + "KMGT"[exponent-1:exponent] + "iB"
+}
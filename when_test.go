@@ -0,0 +1,149 @@
+/*
+ * Copyright (C) 2024 Picking-gh <picking@woft.name>
+ *
+ * SPDX-License-Identifier: MIT
+ */
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64 // 0 if invalid
+	}{
+		{"1.4 GiB", 1503238553},
+		{"700 MB", 700 << 20},
+		{"700MiB", 700 << 20},
+		{"1.5k", 1536},
+		{"2 tb", 2 << 40},
+		{"123456", 123456},
+		{"123456 B", 123456},
+		{"", 0},
+		{"big", 0},
+		{"-5 MB", 0},
+		{"1.2.3 GB", 0},
+		{"5 PB", 0},
+	}
+	for _, tt := range tests {
+		if got := parseSize(tt.s); got != tt.want {
+			t.Errorf("parseSize(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+// nyaaExtensions returns the extension elements of a nyaa.si item.
+func nyaaExtensions(values map[string]string) ext.Extensions {
+	elements := make(map[string][]ext.Extension)
+	for name, value := range values {
+		elements[name] = []ext.Extension{{Name: name, Value: value}}
+	}
+	return ext.Extensions{"nyaa": elements}
+}
+
+func TestNewWhenEnv(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name              string
+		item              *gofeed.Item
+		size              int64
+		seeders, leechers int
+	}{
+		{"nothing", &gofeed.Item{}, 0, 0, 0},
+		{
+			"nyaa",
+			&gofeed.Item{Extensions: nyaaExtensions(map[string]string{"seeders": " 12 ", "leechers": "3", "size": "1.4 GiB"})},
+			1503238553, 12, 3,
+		},
+		{
+			"enclosure before nyaa:size",
+			&gofeed.Item{
+				Enclosures: []*gofeed.Enclosure{{URL: "http://a/1.torrent", Length: "1000"}},
+				Extensions: nyaaExtensions(map[string]string{"size": "1.4 GiB"}),
+			},
+			1000, 0, 0,
+		},
+		{
+			"empty enclosure length",
+			&gofeed.Item{
+				Enclosures: []*gofeed.Enclosure{{URL: "http://a/1.torrent", Length: "0"}},
+				Extensions: nyaaExtensions(map[string]string{"size": "700 MB"}),
+			},
+			700 << 20, 0, 0,
+		},
+		{
+			"invalid values",
+			&gofeed.Item{Extensions: nyaaExtensions(map[string]string{"seeders": "many", "size": "huge"})},
+			0, 0, 0,
+		},
+		{
+			"torznab names",
+			&gofeed.Item{Extensions: ext.Extensions{"torrent": {
+				"seeds":         {{Name: "seeds", Value: "7"}},
+				"peers":         {{Name: "peers", Value: "9"}},
+				"contentLength": {{Name: "contentLength", Value: "2048"}},
+			}}},
+			2048, 7, 9,
+		},
+	}
+	for _, tt := range tests {
+		env := newWhenEnv(tt.item, now)
+		if env.Size != tt.size || env.Seeders != tt.seeders || env.Leechers != tt.leechers {
+			t.Errorf("%s: newWhenEnv() size, seeders, leechers = %d, %d, %d, want %d, %d, %d",
+				tt.name, env.Size, env.Seeders, env.Leechers, tt.size, tt.seeders, tt.leechers)
+		}
+	}
+}
+
+func TestParseWhen(t *testing.T) {
+	tests := []struct {
+		v       interface{}
+		wantErr bool
+	}{
+		{"size < 8 * GB && seeders >= 10", false},
+		{`"Anime" in categories || title contains "1080p"`, false},
+		{"age < 24", false},
+		{nil, true},
+		{5, true},
+		{" ", true},
+		{"size <", true},
+		{"size + 1", true},
+		{"rating > 5", true},
+	}
+	for _, tt := range tests {
+		if _, err := parseWhen(tt.v); (err != nil) != tt.wantErr {
+			t.Errorf("parseWhen(%v) = %v, want an error: %v", tt.v, err, tt.wantErr)
+		}
+	}
+}
+
+func TestWhenSize(t *testing.T) {
+	program, err := parseWhen("size < 8 * GB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		size string
+		want bool
+	}{
+		{"1.4 GiB", true},
+		{"7.9 GiB", true},
+		{"8 GiB", false},
+		{"10.5 GiB", false},
+	}
+	for _, tt := range tests {
+		item := &gofeed.Item{Extensions: nyaaExtensions(map[string]string{"size": tt.size})}
+		if got, err := expr.Run(program, newWhenEnv(item, now)); err != nil || got != tt.want {
+			t.Errorf("size < 8 * GB with a size of %s = %v, %v, want %v", tt.size, got, err, tt.want)
+		}
+	}
+}